@@ -0,0 +1,125 @@
+// Command admin runs maintenance tasks against the shop database. Run it from src/admin
+// so the database path resolves the same way it does for the API server.
+//
+//	go run . set-role -email jane@example.com -role staff
+//	go run . register-queries -manifest persisted-query-manifest.json
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/persisted"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: admin <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  set-role -email <email> -role <customer|staff|admin>")
+	fmt.Fprintln(os.Stderr, "  reset-2fa -email <email>")
+	fmt.Fprintln(os.Stderr, "  register-queries -manifest <persisted-query-manifest.json>")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	if err := database.InitDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer database.CloseDB()
+
+	switch os.Args[1] {
+	case "set-role":
+		setRole(os.Args[2:])
+	case "reset-2fa":
+		resetTwoFactor(os.Args[2:])
+	case "register-queries":
+		registerQueries(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+// setRole changes the role of the user with the given email
+func setRole(args []string) {
+	fs := flag.NewFlagSet("set-role", flag.ExitOnError)
+	email := fs.String("email", "", "email of the user")
+	role := fs.String("role", "", "customer, staff or admin")
+	fs.Parse(args)
+
+	switch *role {
+	case database.RoleCustomer, database.RoleStaff, database.RoleAdmin:
+	default:
+		log.Fatalf("invalid role %q", *role)
+	}
+
+	db := database.GetDB()
+	user, err := database.GetUserByEmail(db, *email)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := database.SetUserRole(db, user.ID, *role); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s is now %s\n", user.Email, *role)
+}
+
+// resetTwoFactor turns off two-factor authentication for a user who lost their
+// authenticator and recovery codes, and ends their sessions
+func resetTwoFactor(args []string) {
+	fs := flag.NewFlagSet("reset-2fa", flag.ExitOnError)
+	email := fs.String("email", "", "email of the user")
+	fs.Parse(args)
+
+	db := database.GetDB()
+	user, err := database.GetUserByEmail(db, *email)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := database.DisableTOTP(db, user.ID); err != nil {
+		log.Fatal(err)
+	}
+	if err := database.DeleteUserSessions(db, user.ID); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("two-factor authentication reset for %s\n", user.Email)
+}
+
+// registerQueries registers the operations of a client's persisted query manifest, so they
+// can be sent by hash and run when the server only allows registered operations
+func registerQueries(args []string) {
+	fs := flag.NewFlagSet("register-queries", flag.ExitOnError)
+	path := fs.String("manifest", "", "path to a persisted query manifest")
+	fs.Parse(args)
+
+	f, err := os.Open(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	manifest, err := persisted.ReadManifest(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	queries := make([]database.PersistedQuery, len(manifest.Operations))
+	for i, op := range manifest.Operations {
+		queries[i] = database.PersistedQuery{Hash: op.ID, Name: op.Name, Body: op.Body}
+	}
+	var added int
+	err = database.WithTx(database.GetDB(), func(tx *sql.Tx) error {
+		added, err = database.RegisterPersistedQueries(tx, queries)
+		return err
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("registered %d of %d operations (%d already registered)\n", added, len(queries), len(queries)-added)
+}
@@ -1,12 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 
+	"go-graphql-ecom/auth"
 	"go-graphql-ecom/database"
 	"go-graphql-ecom/graphql"
+	"go-graphql-ecom/invoice"
+	"go-graphql-ecom/notify"
+	"go-graphql-ecom/orders"
+	"go-graphql-ecom/payment"
+	"go-graphql-ecom/persisted"
+	"go-graphql-ecom/pricing"
+	"go-graphql-ecom/ratelimit"
+	"go-graphql-ecom/storage"
 
 	"github.com/graphql-go/handler"
 )
@@ -19,17 +31,138 @@ func main() {
 	}
 	defer database.CloseDB()
 
-	// Create a GraphQL HTTP handler with our schema
+	// Initialize media storage for uploaded files
+	store, err := storage.NewLocalStore("../../data/media", "/media/")
+	if err != nil {
+		log.Fatalf("Failed to initialize media storage: %v", err)
+	}
+	storage.SetStore(store)
+
+	// Initialize tax calculation from the tax rate table. Prices exclude tax unless
+	// PRICES_INCLUDE_TAX is set to true.
+	rates, err := database.GetAllTaxRates(database.GetDB())
+	if err != nil {
+		log.Fatalf("Failed to load tax rates: %v", err)
+	}
+	pricing.SetTaxCalculator(pricing.NewTableTaxCalculator(rates, os.Getenv("PRICES_INCLUDE_TAX") == "true"))
+
+	// Customers may place orders before verifying their email address unless
+	// REQUIRE_EMAIL_VERIFICATION is set to true
+	orders.SetRequireVerifiedEmail(os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true")
+
+	// Payments go through the deterministic mock provider until a real gateway is configured
+	payment.SetProvider(payment.NewMockProvider())
+
+	// Send queued emails through SMTP when SMTP_ADDR is set, otherwise drop them as .eml
+	// files into data/mail for development
+	notify.SetConfig(notify.Config{
+		From:     envOr("MAIL_FROM", "shop@example.com"),
+		ShopName: envOr("SHOP_NAME", "Go Shop"),
+		BaseURL:  envOr("SHOP_URL", "http://localhost:8081"),
+	})
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		notify.SetTransport(&notify.SMTPTransport{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		})
+	} else {
+		mail, err := notify.NewFileTransport("../../data/mail")
+		if err != nil {
+			log.Fatalf("Failed to initialize mail drop: %v", err)
+		}
+		notify.SetTransport(mail)
+	}
+	go notify.NewDispatcher(database.GetDB()).Run(context.Background())
+
+	// Limit each client (user, API key or IP address) to a budget of query cost points that
+	// refills continuously. RATE_LIMIT_BUDGET=0 turns the limit off.
+	budget, err := strconv.Atoi(envOr("RATE_LIMIT_BUDGET", "1000"))
+	if err != nil {
+		log.Fatalf("Invalid RATE_LIMIT_BUDGET: %v", err)
+	}
+	refill, err := strconv.ParseFloat(envOr("RATE_LIMIT_REFILL", "20"), 64)
+	if err != nil || refill <= 0 {
+		log.Fatalf("Invalid RATE_LIMIT_REFILL: %q", os.Getenv("RATE_LIMIT_REFILL"))
+	}
+	if budget > 0 {
+		ratelimit.SetLimiter(ratelimit.New(budget, refill))
+	}
+
+	// Reject queries nested deeper than MAX_QUERY_DEPTH or estimated to cost more than
+	// MAX_QUERY_COST points before running them; 0 turns a limit off
+	maxDepth, err := strconv.Atoi(envOr("MAX_QUERY_DEPTH", "10"))
+	if err != nil {
+		log.Fatalf("Invalid MAX_QUERY_DEPTH: %v", err)
+	}
+	maxCost, err := strconv.Atoi(envOr("MAX_QUERY_COST", "1000"))
+	if err != nil {
+		log.Fatalf("Invalid MAX_QUERY_COST: %v", err)
+	}
+	graphql.SetQueryLimits(graphql.QueryLimits{MaxDepth: maxDepth, MaxCost: maxCost})
+
+	// Accept batches of up to MAX_BATCH_SIZE operations in one request (0 allows any number),
+	// running BATCH_WORKERS of them at a time
+	maxBatchSize, err := strconv.Atoi(envOr("MAX_BATCH_SIZE", "10"))
+	if err != nil || maxBatchSize < 0 {
+		log.Fatalf("Invalid MAX_BATCH_SIZE: %q", os.Getenv("MAX_BATCH_SIZE"))
+	}
+	batchWorkers, err := strconv.Atoi(envOr("BATCH_WORKERS", "4"))
+	if err != nil || batchWorkers < 1 {
+		log.Fatalf("Invalid BATCH_WORKERS: %q", os.Getenv("BATCH_WORKERS"))
+	}
+	graphql.SetBatchLimits(graphql.BatchLimits{MaxSize: maxBatchSize, Workers: batchWorkers})
+
+	// Let clients send queries by hash, remembering up to APQ_CACHE_SIZE of them (0 turns
+	// automatic persisted queries off). PERSISTED_QUERIES=strict only runs operations
+	// registered with the admin register-queries command.
+	apqCacheSize, err := strconv.Atoi(envOr("APQ_CACHE_SIZE", "1000"))
+	if err != nil {
+		log.Fatalf("Invalid APQ_CACHE_SIZE: %v", err)
+	}
+	persistedQueries := graphql.PersistedQueries{Strict: os.Getenv("PERSISTED_QUERIES") == "strict"}
+	if apqCacheSize > 0 {
+		persistedQueries.Cache = persisted.NewCache(apqCacheSize)
+	}
+	graphql.SetPersistedQueries(persistedQueries)
+
+	// Create a GraphiQL-enabled handler with our schema
 	h := handler.New(&handler.Config{
 		Schema:   &graphql.Schema,
 		Pretty:   true,
 		GraphiQL: true,
+		// Report errors with codes and mask internal ones, as /graphql does
+		FormatErrorFn: graphql.FormatError,
 	})
 
-	// Set up GraphQL endpoint
-	http.Handle("/graphql", h)
+	// Set up GraphQL endpoint (JSON and multipart upload requests, and WebSocket connections
+	// for subscriptions). Requests carrying a session token are authenticated as its user,
+	// those with an X-API-Key header as that key.
+	http.Handle("/graphql", auth.Middleware(auth.APIKeyMiddleware(http.HandlerFunc(graphql.Handler))))
+	// GraphiQL runs whatever is typed into it, so it is left out when only registered
+	// operations may run. Its operations go through the /graphql handler, rate limit included.
+	if !persistedQueries.Strict {
+		http.Handle("/graphiql", auth.Middleware(auth.APIKeyMiddleware(graphql.GraphiQL(h))))
+	}
+
+	// Serve invoice downloads to their customer and to staff
+	http.Handle("/invoices/", auth.Middleware(http.HandlerFunc(invoice.Handler)))
+
+	// Serve uploaded media
+	http.Handle("/media/", http.StripPrefix("/media/", store.Handler()))
 
 	// Start server
 	fmt.Println("Server is running on http://localhost:8081/graphql")
+	if !persistedQueries.Strict {
+		fmt.Println("GraphiQL is available on http://localhost:8081/graphiql")
+	}
 	log.Fatal(http.ListenAndServe(":8081", nil))
 }
+
+// envOr returns an environment variable, or fallback when it is not set
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
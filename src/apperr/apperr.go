@@ -0,0 +1,135 @@
+// Package apperr defines the errors the API reports to clients. Each carries a code that
+// clients can act on; errors without one are internal and are not shown to clients.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Code classifies an error for clients
+type Code string
+
+// Error codes
+const (
+	CodeNotFound          Code = "NOT_FOUND"
+	CodeValidation        Code = "VALIDATION"
+	CodeConflict          Code = "CONFLICT"
+	CodeInsufficientStock Code = "INSUFFICIENT_STOCK"
+	CodeUnauthenticated   Code = "UNAUTHENTICATED"
+	CodeForbidden         Code = "FORBIDDEN"
+	CodeInternal          Code = "INTERNAL"
+)
+
+// Error is an error a client can be told about
+type Error struct {
+	Code    Code
+	Message string
+	// Field names the input the error is about, if any
+	Field string
+	// Details holds machine-readable facts about the error, such as the product that is
+	// out of stock
+	Details map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Extensions returns the code, field and details for the extensions of a GraphQL error
+func (e *Error) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.Code}
+	if e.Field != "" {
+		extensions["field"] = e.Field
+	}
+	for key, value := range e.Details {
+		extensions[key] = value
+	}
+	return extensions
+}
+
+// New returns an error with a code
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Newf returns an error with a code and a formatted message
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// NotFound returns the error for a missing resource, e.g. NotFound("user")
+func NotFound(resource string) *Error {
+	return &Error{
+		Code:    CodeNotFound,
+		Message: resource + " not found",
+		Details: map[string]interface{}{"resource": resource},
+	}
+}
+
+// Invalid returns a validation error about an input field
+func Invalid(field, message string) *Error {
+	return &Error{Code: CodeValidation, Message: message, Field: field}
+}
+
+// Invalidf returns a validation error about an input field with a formatted message
+func Invalidf(field, format string, args ...interface{}) *Error {
+	return &Error{Code: CodeValidation, Message: fmt.Sprintf(format, args...), Field: field}
+}
+
+// Violation is one problem with an input
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Violations returns a validation error reporting every problem with an input at once. The
+// violations are listed under "violations" in the details.
+func Violations(violations []Violation) *Error {
+	e := &Error{
+		Code:    CodeValidation,
+		Details: map[string]interface{}{"violations": violations},
+	}
+	if len(violations) == 1 {
+		e.Message = violations[0].Message
+		e.Field = violations[0].Field
+		return e
+	}
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		messages[i] = v.Message
+	}
+	e.Message = fmt.Sprintf("%d invalid arguments: %s", len(violations), strings.Join(messages, "; "))
+	return e
+}
+
+// InsufficientStock returns the error for asking for more units of a product than are left
+func InsufficientStock(productID, requested, available int) *Error {
+	return &Error{
+		Code:    CodeInsufficientStock,
+		Message: fmt.Sprintf("insufficient stock for product %d: %d requested, %d available", productID, requested, available),
+		Details: map[string]interface{}{
+			"productId": productID,
+			"requested": requested,
+			"available": available,
+		},
+	}
+}
+
+// As returns the first *Error in err's chain
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// CodeOf returns the code of an error, or CodeInternal if it has none
+func CodeOf(err error) Code {
+	if e, ok := As(err); ok {
+		return e.Code
+	}
+	return CodeInternal
+}
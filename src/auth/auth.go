@@ -0,0 +1,177 @@
+// Package auth handles passwords, login sessions and the user attached to a request.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SessionTTL is how long a login session lasts
+const SessionTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidCredentials = apperr.New(apperr.CodeUnauthenticated, "invalid email or password")
+	ErrUnauthenticated    = apperr.New(apperr.CodeUnauthenticated, "authentication required")
+	ErrForbidden          = apperr.New(apperr.CodeForbidden, "not allowed")
+)
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	tokenKey
+	apiKeyKey
+)
+
+// HashPassword hashes a password for storage
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether a password matches a stored hash. Accounts created before
+// passwords were hashed still hold the plain password; those are compared directly.
+func CheckPassword(stored, password string) bool {
+	if isHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
+
+func isHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// NewToken returns a random secret token
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken returns the hash under which a token is stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate checks a user's credentials. Users with two-factor authentication must also
+// give a TOTP or recovery code as otp. Plain passwords left from before hashing are upgraded
+// to a hash on the first successful login.
+func Authenticate(db *sql.DB, email, password, otp string) (*database.User, error) {
+	user, err := database.GetUserByEmail(db, strings.TrimSpace(email))
+	if err != nil || !CheckPassword(user.Password, password) {
+		return nil, ErrInvalidCredentials
+	}
+	if user.TOTPEnabled {
+		if err := VerifySecondFactor(db, user, otp); err != nil {
+			return nil, err
+		}
+	}
+	if !isHash(user.Password) {
+		hash, err := HashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		if err := database.SetUserPassword(db, user.ID, hash); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// StartSession creates a login session for a user and returns its token
+func StartSession(db *sql.DB, user *database.User) (string, time.Time, error) {
+	token, err := NewToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(SessionTTL).UTC().Truncate(time.Second)
+	if err := database.CreateSession(db, user.ID, HashToken(token), expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// EndSession logs out the session a token belongs to
+func EndSession(db *sql.DB, token string) error {
+	return database.DeleteSession(db, HashToken(token))
+}
+
+// Middleware attaches the user of a "Authorization: Bearer <token>" header to the request
+// context. Requests without a valid token continue anonymously.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token != "" {
+			if ctx, err := WithSession(r.Context(), database.GetDB(), token); err == nil {
+				r = r.WithContext(ctx)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithSession returns a context carrying the user of a session token and the token itself,
+// or ErrUnauthenticated if the session doesn't exist or has expired
+func WithSession(ctx context.Context, db *sql.DB, token string) (context.Context, error) {
+	user, err := database.GetSessionUser(db, HashToken(token))
+	if err != nil {
+		return ctx, ErrUnauthenticated
+	}
+	ctx = context.WithValue(ctx, userKey, user)
+	return context.WithValue(ctx, tokenKey, token), nil
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// WithUser returns a context carrying the authenticated user
+func WithUser(ctx context.Context, user *database.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// UserFromContext returns the authenticated user of a request, or nil
+func UserFromContext(ctx context.Context) *database.User {
+	if ctx == nil {
+		return nil
+	}
+	user, _ := ctx.Value(userKey).(*database.User)
+	return user
+}
+
+// TokenFromContext returns the session token a request was authenticated with
+func TokenFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	token, _ := ctx.Value(tokenKey).(string)
+	return token
+}
+
+// IsStaff reports whether a user works for the shop
+func IsStaff(user *database.User) bool {
+	return user != nil && (user.Role == database.RoleStaff || user.Role == database.RoleAdmin)
+}
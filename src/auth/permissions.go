@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+)
+
+// Permission allows a group of staff operations
+type Permission string
+
+// Permissions
+const (
+	PermManageCatalog       Permission = "catalog:write"
+	PermManagePricing       Permission = "pricing:write"
+	PermManageOrders        Permission = "orders:write"
+	PermManageNotifications Permission = "notifications:write"
+	PermManageAPIKeys       Permission = "apikeys:write"
+	PermViewUsers           Permission = "users:read"
+)
+
+// ErrTwoFactorRequired is returned to staff who haven't enabled two-factor authentication
+var ErrTwoFactorRequired = apperr.New(apperr.CodeForbidden, "enable two-factor authentication to use staff permissions")
+
+// rolePermissions lists what each role may do. Customers have no staff permissions.
+var rolePermissions = map[string][]Permission{
+	database.RoleStaff: {PermManageCatalog, PermManagePricing, PermManageOrders, PermManageNotifications},
+	database.RoleAdmin: {PermManageCatalog, PermManagePricing, PermManageOrders, PermManageNotifications, PermManageAPIKeys, PermViewUsers},
+}
+
+// HasPermission reports whether a role grants a permission
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresTwoFactor reports whether a user must use two-factor authentication before
+// their role's permissions apply. Staff and admins must.
+func RequiresTwoFactor(user *database.User) bool {
+	return IsStaff(user)
+}
+
+// Authorize checks that the request's user may use a permission. Requests made with an API
+// key instead of a session need the permission among the key's scopes.
+func Authorize(ctx context.Context, perm Permission) error {
+	user := UserFromContext(ctx)
+	if user == nil {
+		if key := APIKeyFromContext(ctx); key != nil {
+			if !key.HasScope(string(perm)) {
+				return ErrForbidden
+			}
+			return nil
+		}
+		return ErrUnauthenticated
+	}
+	if !HasPermission(user.Role, perm) {
+		return ErrForbidden
+	}
+	if RequiresTwoFactor(user) && !user.TOTPEnabled {
+		return ErrTwoFactorRequired
+	}
+	return nil
+}
+
+// AuthorizeOwner checks that the request's user owns a resource, or else may use a
+// permission that covers everyone's
+func AuthorizeOwner(ctx context.Context, ownerID int, perm Permission) error {
+	if user := UserFromContext(ctx); user != nil && user.ID == ownerID {
+		return nil
+	}
+	return Authorize(ctx, perm)
+}
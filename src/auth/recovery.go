@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/notify"
+)
+
+// Lifetimes of the links sent by email
+const (
+	PasswordResetTTL     = time.Hour
+	EmailVerificationTTL = 48 * time.Hour
+)
+
+// MinPasswordLength is the shortest password accepted when one is changed
+const MinPasswordLength = 8
+
+var (
+	ErrPasswordTooShort = apperr.Invalid("password", "password must be at least 8 characters")
+	ErrInvalidToken     = apperr.Invalid("token", "link is invalid or has expired")
+)
+
+// Register creates a customer account with a hashed password and emails a link to verify
+// the address
+func Register(db *sql.DB, name, email, password string) (*database.User, error) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	var user *database.User
+	err = database.WithTx(db, func(tx *sql.Tx) error {
+		user, err = database.CreateUser(tx, name, strings.TrimSpace(email), hash)
+		if err != nil {
+			return err
+		}
+		return sendVerification(tx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	notify.Wake()
+	return user, nil
+}
+
+// ResendVerification emails a new verification link, replacing earlier ones
+func ResendVerification(db *sql.DB, user *database.User) error {
+	if user.EmailVerified {
+		return nil
+	}
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		if err := database.InvalidateUserTokens(tx, user.ID, database.TokenPurposeEmailVerification); err != nil {
+			return err
+		}
+		return sendVerification(tx, user)
+	})
+	if err != nil {
+		return err
+	}
+	notify.Wake()
+	return nil
+}
+
+func sendVerification(tx *sql.Tx, user *database.User) error {
+	token, err := issueUserToken(tx, user.ID, database.TokenPurposeEmailVerification, EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return notify.EmailVerification(tx, user, token, "48 hours")
+}
+
+// VerifyEmail marks the address of the token's user as verified
+func VerifyEmail(db *sql.DB, token string) (*database.User, error) {
+	var userID int
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		var err error
+		userID, err = database.ConsumeUserToken(tx, database.TokenPurposeEmailVerification, HashToken(token))
+		if err != nil {
+			return ErrInvalidToken
+		}
+		return database.SetEmailVerified(tx, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetUserByID(db, userID)
+}
+
+// RequestPasswordReset emails a password reset link to the account with this address.
+// Unknown addresses are ignored without an error, so the result doesn't reveal which
+// addresses have accounts.
+func RequestPasswordReset(db *sql.DB, email string) error {
+	user, err := database.GetUserByEmail(db, strings.TrimSpace(email))
+	if err != nil {
+		return nil
+	}
+	err = database.WithTx(db, func(tx *sql.Tx) error {
+		if err := database.InvalidateUserTokens(tx, user.ID, database.TokenPurposePasswordReset); err != nil {
+			return err
+		}
+		token, err := issueUserToken(tx, user.ID, database.TokenPurposePasswordReset, PasswordResetTTL)
+		if err != nil {
+			return err
+		}
+		return notify.PasswordReset(tx, user, token, "1 hour")
+	})
+	if err != nil {
+		return err
+	}
+	notify.Wake()
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token. Every session of the user is
+// ended, and since the link arrived by email the address counts as verified.
+func ResetPassword(db *sql.DB, token, newPassword string) error {
+	if len(newPassword) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	return database.WithTx(db, func(tx *sql.Tx) error {
+		userID, err := database.ConsumeUserToken(tx, database.TokenPurposePasswordReset, HashToken(token))
+		if err != nil {
+			return ErrInvalidToken
+		}
+		if err := database.SetUserPassword(tx, userID, hash); err != nil {
+			return err
+		}
+		if err := database.SetEmailVerified(tx, userID); err != nil {
+			return err
+		}
+		return database.DeleteUserSessions(tx, userID)
+	})
+}
+
+// issueUserToken stores the hash of a new token and returns the token itself
+func issueUserToken(tx *sql.Tx, userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+	err = database.CreateUserToken(tx, userID, purpose, HashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
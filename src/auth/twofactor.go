@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"strings"
+	"time"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/notify"
+
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RecoveryCodeCount is how many recovery codes a user is given at a time
+const RecoveryCodeCount = 10
+
+var (
+	ErrOTPRequired             = apperr.New(apperr.CodeUnauthenticated, "two-factor code required")
+	ErrInvalidOTP              = apperr.New(apperr.CodeUnauthenticated, "invalid two-factor code")
+	ErrTwoFactorAlreadyEnabled = apperr.New(apperr.CodeConflict, "two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled    = apperr.New(apperr.CodeConflict, "start two-factor enrollment first")
+	ErrTwoFactorNotEnabled     = apperr.New(apperr.CodeConflict, "two-factor authentication is not enabled")
+)
+
+// Enrollment is what a user needs to add their account to an authenticator app
+type Enrollment struct {
+	Secret string
+	URI    string
+	QRCode []byte // PNG encoding of URI
+}
+
+// EnrollTwoFactor generates a new TOTP secret for a user. It is not enforced until
+// ConfirmTwoFactor proves the authenticator app produces matching codes.
+func EnrollTwoFactor(db *sql.DB, user *database.User) (*Enrollment, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.SetPendingTOTPSecret(db, user.ID, secret); err != nil {
+		return nil, err
+	}
+	uri := totpURI(secret, notify.GetConfig().ShopName, user.Email)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+	return &Enrollment{Secret: secret, URI: uri, QRCode: png}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user enters a code from their
+// authenticator, and returns their recovery codes. Every other session of the user is
+// ended, so only sessions that passed the second factor remain.
+func ConfirmTwoFactor(db *sql.DB, user *database.User, sessionToken, code string) ([]string, error) {
+	var codes []string
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		current, err := database.GetUserByID(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if current.TOTPEnabled {
+			return ErrTwoFactorAlreadyEnabled
+		}
+		if current.TOTPSecret == "" {
+			return ErrTwoFactorNotEnrolled
+		}
+		if err := checkTOTP(tx, current, code); err != nil {
+			return err
+		}
+		if err := database.EnableTOTP(tx, current.ID); err != nil {
+			return err
+		}
+		if codes, err = replaceRecoveryCodes(tx, current.ID); err != nil {
+			return err
+		}
+		return database.DeleteOtherSessions(tx, current.ID, HashToken(sessionToken))
+	})
+	return codes, err
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking a current code
+func DisableTwoFactor(db *sql.DB, user *database.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	return database.WithTx(db, func(tx *sql.Tx) error {
+		if err := VerifySecondFactor(tx, user, code); err != nil {
+			return err
+		}
+		return database.DisableTOTP(tx, user.ID)
+	})
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes after checking a current code
+func RegenerateRecoveryCodes(db *sql.DB, user *database.User, code string) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	var codes []string
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		if err := VerifySecondFactor(tx, user, code); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// VerifySecondFactor accepts a TOTP code or an unused recovery code, each only once
+func VerifySecondFactor(db database.Querier, user *database.User, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrOTPRequired
+	}
+	if err := checkTOTP(db, user, code); err != ErrInvalidOTP {
+		return err
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	codes, err := database.GetUnusedRecoveryCodes(db, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, c := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(c.CodeHash), []byte(normalized)) != nil {
+			continue
+		}
+		used, err := database.UseRecoveryCode(db, c.ID)
+		if err != nil {
+			return err
+		}
+		if used {
+			return nil
+		}
+	}
+	return ErrInvalidOTP
+}
+
+// checkTOTP accepts a TOTP code that hasn't been used before
+func checkTOTP(db database.Querier, user *database.User, code string) error {
+	step, ok := matchTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return ErrInvalidOTP
+	}
+	fresh, err := database.UseTOTPStep(db, user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidOTP
+	}
+	return nil
+}
+
+// replaceRecoveryCodes generates new recovery codes, stores their hashes and returns them
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32NoPadding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hash, err := bcrypt.GenerateFromPassword([]byte(raw), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = string(hash)
+	}
+	if err := database.ReplaceRecoveryCodes(tx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
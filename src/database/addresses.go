@@ -0,0 +1,227 @@
+package database
+
+import (
+	"database/sql"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Order address kinds
+const (
+	AddressKindShipping = "shipping"
+	AddressKindBilling  = "billing"
+)
+
+// Address represents a postal address saved in a user's address book
+type Address struct {
+	ID                int
+	UserID            int
+	Name              string
+	Line1             string
+	Line2             string
+	City              string
+	Region            string
+	PostalCode        string
+	Country           string
+	Phone             string
+	IsDefaultShipping bool
+	IsDefaultBilling  bool
+	CreatedAt         string
+}
+
+// OrderAddress is a copy of an address taken when an order is placed. It is never
+// updated, so editing or deleting the address book entry leaves the order untouched.
+type OrderAddress struct {
+	ID         int
+	OrderID    int
+	Kind       string
+	Name       string
+	Line1      string
+	Line2      string
+	City       string
+	Region     string
+	PostalCode string
+	Country    string
+	Phone      string
+	CreatedAt  string
+}
+
+// Address operations
+
+const addressColumns = `id, user_id, name, line1, line2, city, region, postal_code, country, phone, is_default_shipping, is_default_billing, created_at`
+
+func scanAddress(row interface{ Scan(...interface{}) error }, address *Address) error {
+	return row.Scan(&address.ID, &address.UserID, &address.Name, &address.Line1, &address.Line2, &address.City, &address.Region,
+		&address.PostalCode, &address.Country, &address.Phone, &address.IsDefaultShipping, &address.IsDefaultBilling, &address.CreatedAt)
+}
+
+// GetAddressByID retrieves an address by ID
+func GetAddressByID(db Querier, id int) (*Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM addresses WHERE id = ?`
+
+	var address Address
+	err := scanAddress(db.QueryRow(query, id), &address)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("address")
+		}
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+// GetAddressesByUserID retrieves the address book of a user, defaults first
+func GetAddressesByUserID(db Querier, userID int) ([]Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM addresses WHERE user_id = ?
+	ORDER BY is_default_shipping DESC, is_default_billing DESC, id`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addresses []Address
+	for rows.Next() {
+		var address Address
+		if err := scanAddress(rows, &address); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+
+	return addresses, rows.Err()
+}
+
+// GetDefaultAddress retrieves the default shipping or billing address of a user, or nil if none is set
+func GetDefaultAddress(db Querier, userID int, kind string) (*Address, error) {
+	column := "is_default_shipping"
+	if kind == AddressKindBilling {
+		column = "is_default_billing"
+	}
+
+	var address Address
+	err := scanAddress(db.QueryRow(`SELECT `+addressColumns+` FROM addresses WHERE user_id = ? AND `+column+` = 1`, userID), &address)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &address, nil
+}
+
+// CreateAddress adds an address to a user's address book. The first address of a user
+// becomes the default shipping and billing address.
+func CreateAddress(db *sql.DB, address *Address) (*Address, error) {
+	if _, err := GetUserByID(db, address.UserID); err != nil {
+		return nil, err
+	}
+
+	var id int64
+	err := WithTx(db, func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM addresses WHERE user_id = ?`, address.UserID).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			address.IsDefaultShipping = true
+			address.IsDefaultBilling = true
+		}
+		if err := clearDefaultAddresses(tx, address.UserID, 0, address.IsDefaultShipping, address.IsDefaultBilling); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`INSERT INTO addresses (user_id, name, line1, line2, city, region, postal_code, country, phone, is_default_shipping, is_default_billing)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			address.UserID, address.Name, address.Line1, address.Line2, address.City, address.Region, address.PostalCode,
+			address.Country, address.Phone, address.IsDefaultShipping, address.IsDefaultBilling)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetAddressByID(db, int(id))
+}
+
+// UpdateAddress saves changes to an address. Orders placed with it keep their own copy.
+func UpdateAddress(db *sql.DB, address *Address) (*Address, error) {
+	err := WithTx(db, func(tx *sql.Tx) error {
+		if err := clearDefaultAddresses(tx, address.UserID, address.ID, address.IsDefaultShipping, address.IsDefaultBilling); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE addresses SET name = ?, line1 = ?, line2 = ?, city = ?, region = ?, postal_code = ?, country = ?, phone = ?,
+			is_default_shipping = ?, is_default_billing = ? WHERE id = ?`,
+			address.Name, address.Line1, address.Line2, address.City, address.Region, address.PostalCode, address.Country,
+			address.Phone, address.IsDefaultShipping, address.IsDefaultBilling, address.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetAddressByID(db, address.ID)
+}
+
+// DeleteAddress removes an address from a user's address book
+func DeleteAddress(db *sql.DB, id int) error {
+	result, err := db.Exec(`DELETE FROM addresses WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return apperr.NotFound("address")
+	}
+	return nil
+}
+
+// clearDefaultAddresses unsets the default flags on a user's other addresses so only one
+// address is the default of each kind
+func clearDefaultAddresses(tx *sql.Tx, userID, keepID int, shipping, billing bool) error {
+	if shipping {
+		if _, err := tx.Exec(`UPDATE addresses SET is_default_shipping = 0 WHERE user_id = ? AND id != ?`, userID, keepID); err != nil {
+			return err
+		}
+	}
+	if billing {
+		if _, err := tx.Exec(`UPDATE addresses SET is_default_billing = 0 WHERE user_id = ? AND id != ?`, userID, keepID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OrderAddress operations
+
+const orderAddressColumns = `id, order_id, kind, name, line1, line2, city, region, postal_code, country, phone, created_at`
+
+// GetOrderAddress retrieves the shipping or billing address recorded on an order, or nil if there is none
+func GetOrderAddress(db Querier, orderID int, kind string) (*OrderAddress, error) {
+	query := `SELECT ` + orderAddressColumns + ` FROM order_addresses WHERE order_id = ? AND kind = ?`
+
+	var a OrderAddress
+	err := db.QueryRow(query, orderID, kind).Scan(&a.ID, &a.OrderID, &a.Kind, &a.Name, &a.Line1, &a.Line2, &a.City,
+		&a.Region, &a.PostalCode, &a.Country, &a.Phone, &a.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SnapshotOrderAddress copies an address onto an order
+func SnapshotOrderAddress(db Querier, orderID int, kind string, address *Address) error {
+	_, err := db.Exec(`INSERT INTO order_addresses (order_id, kind, name, line1, line2, city, region, postal_code, country, phone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		orderID, kind, address.Name, address.Line1, address.Line2, address.City, address.Region, address.PostalCode,
+		address.Country, address.Phone)
+	return err
+}
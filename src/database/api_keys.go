@@ -0,0 +1,151 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"go-graphql-ecom/apperr"
+)
+
+// APIKey lets another system call the API without a user session. Only a hash of the key
+// is stored; the prefix identifies it in lists and logs.
+type APIKey struct {
+	ID         int
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	CreatedBy  int
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// HasScope reports whether a key was granted a scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// API key operations
+
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, created_by, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }, key *APIKey) error {
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedBy, &expiresAt, &lastUsedAt,
+		&revokedAt, &key.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	key.ExpiresAt = nullTime(expiresAt)
+	key.LastUsedAt = nullTime(lastUsedAt)
+	key.RevokedAt = nullTime(revokedAt)
+	return nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// GetAPIKeyByID retrieves an API key by ID
+func GetAPIKeyByID(db Querier, id int) (*APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = ?`
+
+	var key APIKey
+	err := scanAPIKey(db.QueryRow(query, id), &key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("API key")
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// GetActiveAPIKey retrieves the API key with a hash if it is neither revoked nor expired
+func GetActiveAPIKey(db Querier, keyHash string) (*APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys
+		WHERE key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`
+
+	var key APIKey
+	err := scanAPIKey(db.QueryRow(query, keyHash, time.Now().UTC()), &key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("API key")
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// GetAllAPIKeys retrieves all API keys, newest first
+func GetAllAPIKeys(db Querier) ([]APIKey, error) {
+	rows, err := db.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var key APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// CreateAPIKey stores an API key and sets its ID
+func CreateAPIKey(db Querier, key *APIKey) error {
+	var expiresAt interface{}
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.UTC()
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	result, err := db.Exec(`INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, ","), key.CreatedBy, expiresAt, now)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	key.ID = int(id)
+	key.CreatedAt = now
+	return nil
+}
+
+// RevokeAPIKey stops an API key from working. Revoking it again has no effect.
+func RevokeAPIKey(db Querier, id int) error {
+	_, err := db.Exec(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now().UTC(), id)
+	return err
+}
+
+// TouchAPIKey records that an API key was used. To spare a write on every request the
+// time is only updated once a minute.
+func TouchAPIKey(db Querier, id int) error {
+	now := time.Now().UTC()
+	_, err := db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)`,
+		now, id, now.Add(-time.Minute))
+	return err
+}
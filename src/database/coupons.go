@@ -0,0 +1,330 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Coupon types
+const (
+	CouponTypePercentage   = "percentage"
+	CouponTypeFixedAmount  = "fixed_amount"
+	CouponTypeFreeShipping = "free_shipping"
+)
+
+// Discount sources recorded on order discount lines
+const (
+	DiscountSourceCoupon = "coupon"
+)
+
+// Coupon represents a discount code
+type Coupon struct {
+	ID             int
+	Code           string
+	Description    string
+	Type           string
+	Value          float64
+	StartsAt       *time.Time
+	EndsAt         *time.Time
+	MaxUses        int
+	MaxUsesPerUser int
+	MinOrderValue  float64
+	Active         bool
+	CreatedAt      string
+	ProductIDs     []int
+	Categories     []string
+}
+
+// CouponRedemption records a coupon applied to an order
+type CouponRedemption struct {
+	ID        int
+	CouponID  int
+	UserID    int
+	OrderID   int
+	CreatedAt string
+	// RedeemedAt is set once the order is placed; until then the coupon is only applied
+	RedeemedAt *string
+}
+
+// OrderDiscount is a discount line recorded on an order
+type OrderDiscount struct {
+	ID          int
+	OrderID     int
+	Source      string
+	SourceID    int
+	Code        string
+	Description string
+	Amount      float64
+}
+
+// Coupon operations
+
+const couponColumns = `id, code, description, type, value, starts_at, ends_at, max_uses, max_uses_per_user, min_order_value, active, created_at`
+
+func scanCoupon(row interface{ Scan(...interface{}) error }, coupon *Coupon) error {
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(&coupon.ID, &coupon.Code, &coupon.Description, &coupon.Type, &coupon.Value, &startsAt, &endsAt,
+		&coupon.MaxUses, &coupon.MaxUsesPerUser, &coupon.MinOrderValue, &coupon.Active, &coupon.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if startsAt.Valid {
+		coupon.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		coupon.EndsAt = &endsAt.Time
+	}
+	return nil
+}
+
+// loadCouponScope fills in the products and categories a coupon is restricted to
+func loadCouponScope(db Querier, coupon *Coupon) error {
+	rows, err := db.Query(`SELECT product_id FROM coupon_products WHERE coupon_id = ? ORDER BY product_id`, coupon.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		coupon.ProductIDs = append(coupon.ProductIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Query(`SELECT category FROM coupon_categories WHERE coupon_id = ? ORDER BY category`, coupon.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			return err
+		}
+		coupon.Categories = append(coupon.Categories, category)
+	}
+	return rows.Err()
+}
+
+// GetCouponByID retrieves a coupon by ID
+func GetCouponByID(db Querier, id int) (*Coupon, error) {
+	query := `SELECT ` + couponColumns + ` FROM coupons WHERE id = ?`
+
+	var coupon Coupon
+	err := scanCoupon(db.QueryRow(query, id), &coupon)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("coupon")
+		}
+		return nil, err
+	}
+
+	if err := loadCouponScope(db, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// GetCouponByCode retrieves a coupon by its code, ignoring case
+func GetCouponByCode(db Querier, code string) (*Coupon, error) {
+	query := `SELECT ` + couponColumns + ` FROM coupons WHERE code = ?`
+
+	var coupon Coupon
+	err := scanCoupon(db.QueryRow(query, strings.TrimSpace(code)), &coupon)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("coupon")
+		}
+		return nil, err
+	}
+
+	if err := loadCouponScope(db, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// GetAllCoupons retrieves all coupons
+func GetAllCoupons(db *sql.DB) ([]Coupon, error) {
+	rows, err := db.Query(`SELECT ` + couponColumns + ` FROM coupons ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var coupons []Coupon
+	for rows.Next() {
+		var coupon Coupon
+		if err := scanCoupon(rows, &coupon); err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, coupon)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range coupons {
+		if err := loadCouponScope(db, &coupons[i]); err != nil {
+			return nil, err
+		}
+	}
+	return coupons, nil
+}
+
+// CreateCoupon creates a coupon together with its product and category scope
+func CreateCoupon(db *sql.DB, coupon *Coupon) (*Coupon, error) {
+	var id int64
+	err := WithTx(db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO coupons (code, description, type, value, starts_at, ends_at, max_uses, max_uses_per_user, min_order_value, active)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			strings.TrimSpace(coupon.Code), coupon.Description, coupon.Type, coupon.Value, coupon.StartsAt, coupon.EndsAt,
+			coupon.MaxUses, coupon.MaxUsesPerUser, coupon.MinOrderValue, coupon.Active)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return &apperr.Error{Code: apperr.CodeConflict, Message: "a coupon with this code already exists", Field: "code"}
+			}
+			return err
+		}
+		id, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		for _, productID := range coupon.ProductIDs {
+			if _, err := GetProductByID(tx, productID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO coupon_products (coupon_id, product_id) VALUES (?, ?)`, id, productID); err != nil {
+				return err
+			}
+		}
+		for _, category := range coupon.Categories {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO coupon_categories (coupon_id, category) VALUES (?, ?)`, id, category); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetCouponByID(db, int(id))
+}
+
+// SetCouponActive enables or disables a coupon
+func SetCouponActive(db *sql.DB, id int, active bool) (*Coupon, error) {
+	if _, err := db.Exec(`UPDATE coupons SET active = ? WHERE id = ?`, active, id); err != nil {
+		return nil, err
+	}
+	return GetCouponByID(db, id)
+}
+
+// CouponRedemption operations
+
+// CountCouponRedemptions counts how often a coupon has been used on placed orders, ignoring
+// the given order
+func CountCouponRedemptions(db Querier, couponID, excludeOrderID int) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM coupon_redemptions
+		WHERE coupon_id = ? AND order_id != ? AND redeemed_at IS NOT NULL`,
+		couponID, excludeOrderID).Scan(&count)
+	return count, err
+}
+
+// CountUserCouponRedemptions counts how often a user has used a coupon on placed orders,
+// ignoring the given order
+func CountUserCouponRedemptions(db Querier, couponID, userID, excludeOrderID int) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM coupon_redemptions
+		WHERE coupon_id = ? AND user_id = ? AND order_id != ? AND redeemed_at IS NOT NULL`,
+		couponID, userID, excludeOrderID).Scan(&count)
+	return count, err
+}
+
+// GetCouponRedemptionByOrderID retrieves the coupon applied to an order, or nil if there is none
+func GetCouponRedemptionByOrderID(db Querier, orderID int) (*CouponRedemption, error) {
+	var redemption CouponRedemption
+	err := db.QueryRow(`SELECT id, coupon_id, user_id, order_id, created_at, redeemed_at FROM coupon_redemptions WHERE order_id = ?`, orderID).
+		Scan(&redemption.ID, &redemption.CouponID, &redemption.UserID, &redemption.OrderID, &redemption.CreatedAt, &redemption.RedeemedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// SetOrderCoupon records that a coupon is applied to an order, replacing any previous coupon
+func SetOrderCoupon(db Querier, orderID, userID, couponID int) error {
+	_, err := db.Exec(`INSERT INTO coupon_redemptions (coupon_id, user_id, order_id) VALUES (?, ?, ?)
+		ON CONFLICT (order_id) DO UPDATE SET coupon_id = excluded.coupon_id, user_id = excluded.user_id,
+			created_at = CURRENT_TIMESTAMP, redeemed_at = NULL`,
+		couponID, userID, orderID)
+	return err
+}
+
+// RedeemOrderCoupon counts the coupon applied to an order as used
+func RedeemOrderCoupon(db Querier, orderID int) error {
+	_, err := db.Exec(`UPDATE coupon_redemptions SET redeemed_at = CURRENT_TIMESTAMP WHERE order_id = ?`, orderID)
+	return err
+}
+
+// ReleaseOrderCoupon gives back the use of the coupon applied to an order, keeping it attached
+func ReleaseOrderCoupon(db Querier, orderID int) error {
+	_, err := db.Exec(`UPDATE coupon_redemptions SET redeemed_at = NULL WHERE order_id = ?`, orderID)
+	return err
+}
+
+// RemoveOrderCoupon detaches the coupon applied to an order
+func RemoveOrderCoupon(db Querier, orderID int) error {
+	_, err := db.Exec(`DELETE FROM coupon_redemptions WHERE order_id = ?`, orderID)
+	return err
+}
+
+// OrderDiscount operations
+
+// GetOrderDiscountsByOrderID retrieves the discount lines of an order
+func GetOrderDiscountsByOrderID(db Querier, orderID int) ([]OrderDiscount, error) {
+	rows, err := db.Query(`SELECT id, order_id, source, source_id, code, description, amount FROM order_discounts WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discounts []OrderDiscount
+	for rows.Next() {
+		var discount OrderDiscount
+		err := rows.Scan(&discount.ID, &discount.OrderID, &discount.Source, &discount.SourceID, &discount.Code, &discount.Description, &discount.Amount)
+		if err != nil {
+			return nil, err
+		}
+		discounts = append(discounts, discount)
+	}
+	return discounts, rows.Err()
+}
+
+// ReplaceOrderDiscounts replaces the discount lines of an order coming from the given source
+func ReplaceOrderDiscounts(db Querier, orderID int, source string, discounts []OrderDiscount) error {
+	if _, err := db.Exec(`DELETE FROM order_discounts WHERE order_id = ? AND source = ?`, orderID, source); err != nil {
+		return err
+	}
+	for _, d := range discounts {
+		_, err := db.Exec(`INSERT INTO order_discounts (order_id, source, source_id, code, description, amount) VALUES (?, ?, ?, ?, ?, ?)`,
+			orderID, source, d.SourceID, d.Code, d.Description, d.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
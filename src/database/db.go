@@ -2,12 +2,13 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"sync"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // DB is the database connection
@@ -16,6 +17,13 @@ var (
 	once sync.Once
 )
 
+// Querier is implemented by both *sql.DB and *sql.Tx so operations can run inside a transaction
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // InitDB initializes the database connection
 func InitDB() error {
 	var err error
@@ -41,6 +49,12 @@ func InitDB() error {
 			log.Fatal(err)
 		}
 
+		// Use write-ahead logging so readers don't block on the writers running alongside
+		// them, such as the email dispatcher
+		if _, err = DB.Exec("PRAGMA journal_mode=WAL"); err != nil {
+			log.Fatal(err)
+		}
+
 		fmt.Println("Connected to SQLite database")
 
 		// Create tables if they don't exist
@@ -78,6 +92,12 @@ func createTables() {
 		log.Fatal(err)
 	}
 
+	addColumn("users", "role", "TEXT NOT NULL DEFAULT 'customer'")
+	addColumn("users", "email_verified", "BOOLEAN NOT NULL DEFAULT 0")
+	addColumn("users", "totp_secret", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "totp_enabled", "BOOLEAN NOT NULL DEFAULT 0")
+	addColumn("users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0")
+
 	// Create Products table
 	productsTable := `
 	CREATE TABLE IF NOT EXISTS products (
@@ -94,6 +114,16 @@ func createTables() {
 		log.Fatal(err)
 	}
 
+	// Columns added after the initial schema
+	addColumn("products", "average_rating", "REAL NOT NULL DEFAULT 0")
+	addColumn("products", "review_count", "INTEGER NOT NULL DEFAULT 0")
+	addColumn("products", "category", "TEXT NOT NULL DEFAULT ''")
+	addColumn("products", "tax_class", "TEXT NOT NULL DEFAULT 'standard'")
+	addColumn("products", "weight", "REAL NOT NULL DEFAULT 0")
+	addColumn("products", "length", "REAL NOT NULL DEFAULT 0")
+	addColumn("products", "width", "REAL NOT NULL DEFAULT 0")
+	addColumn("products", "height", "REAL NOT NULL DEFAULT 0")
+
 	// Create Orders table
 	ordersTable := `
 	CREATE TABLE IF NOT EXISTS orders (
@@ -110,6 +140,18 @@ func createTables() {
 		log.Fatal(err)
 	}
 
+	addColumn("orders", "subtotal", "REAL NOT NULL DEFAULT 0")
+	addColumn("orders", "discount_total", "REAL NOT NULL DEFAULT 0")
+	addColumn("orders", "free_shipping", "BOOLEAN NOT NULL DEFAULT 0")
+	addColumn("orders", "country", "TEXT NOT NULL DEFAULT ''")
+	addColumn("orders", "region", "TEXT NOT NULL DEFAULT ''")
+	addColumn("orders", "tax_total", "REAL NOT NULL DEFAULT 0")
+	addColumn("orders", "prices_include_tax", "BOOLEAN NOT NULL DEFAULT 0")
+	addColumn("orders", "shipping_method_id", "INTEGER NOT NULL DEFAULT 0")
+	addColumn("orders", "shipping_total", "REAL NOT NULL DEFAULT 0")
+	addColumn("orders", "cancellation_reason", "TEXT NOT NULL DEFAULT ''")
+	addColumn("orders", "cancelled_at", "DATETIME")
+
 	// Create OrderItems table
 	orderItemsTable := `
 	CREATE TABLE IF NOT EXISTS order_items (
@@ -127,9 +169,690 @@ func createTables() {
 		log.Fatal(err)
 	}
 
+	addColumn("order_items", "tax_base", "REAL NOT NULL DEFAULT 0")
+	addColumn("order_items", "tax_rate", "REAL NOT NULL DEFAULT 0")
+	addColumn("order_items", "tax_name", "TEXT NOT NULL DEFAULT ''")
+	addColumn("order_items", "tax_amount", "REAL NOT NULL DEFAULT 0")
+
+	// Create ProductImages table
+	productImagesTable := `
+	CREATE TABLE IF NOT EXISTS product_images (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		storage_key TEXT NOT NULL,
+		thumbnail_key TEXT NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (product_id) REFERENCES products (id)
+	);
+	`
+	_, err = DB.Exec(productImagesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create Reviews table
+	reviewsTable := `
+	CREATE TABLE IF NOT EXISTS reviews (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		rating INTEGER NOT NULL CHECK (rating BETWEEN 1 AND 5),
+		title TEXT NOT NULL DEFAULT '',
+		body TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (product_id, user_id),
+		FOREIGN KEY (product_id) REFERENCES products (id),
+		FOREIGN KEY (user_id) REFERENCES users (id)
+	);
+	`
+	_, err = DB.Exec(reviewsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create Wishlists table
+	wishlistsTable := `
+	CREATE TABLE IF NOT EXISTS wishlists (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		share_token TEXT UNIQUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users (id)
+	);
+	`
+	_, err = DB.Exec(wishlistsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create WishlistItems table
+	wishlistItemsTable := `
+	CREATE TABLE IF NOT EXISTS wishlist_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		wishlist_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		saved_price REAL NOT NULL,
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (wishlist_id, product_id),
+		FOREIGN KEY (wishlist_id) REFERENCES wishlists (id) ON DELETE CASCADE,
+		FOREIGN KEY (product_id) REFERENCES products (id)
+	);
+	`
+	_, err = DB.Exec(wishlistItemsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create Coupons table
+	couponsTable := `
+	CREATE TABLE IF NOT EXISTS coupons (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		description TEXT NOT NULL DEFAULT '',
+		type TEXT NOT NULL,
+		value REAL NOT NULL DEFAULT 0,
+		starts_at TIMESTAMP,
+		ends_at TIMESTAMP,
+		max_uses INTEGER NOT NULL DEFAULT 0,
+		max_uses_per_user INTEGER NOT NULL DEFAULT 0,
+		min_order_value REAL NOT NULL DEFAULT 0,
+		active BOOLEAN NOT NULL DEFAULT 1,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err = DB.Exec(couponsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create CouponProducts table restricting a coupon to specific products
+	couponProductsTable := `
+	CREATE TABLE IF NOT EXISTS coupon_products (
+		coupon_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		PRIMARY KEY (coupon_id, product_id),
+		FOREIGN KEY (coupon_id) REFERENCES coupons (id),
+		FOREIGN KEY (product_id) REFERENCES products (id)
+	);
+	`
+	_, err = DB.Exec(couponProductsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create CouponCategories table restricting a coupon to product categories
+	couponCategoriesTable := `
+	CREATE TABLE IF NOT EXISTS coupon_categories (
+		coupon_id INTEGER NOT NULL,
+		category TEXT NOT NULL COLLATE NOCASE,
+		PRIMARY KEY (coupon_id, category),
+		FOREIGN KEY (coupon_id) REFERENCES coupons (id)
+	);
+	`
+	_, err = DB.Exec(couponCategoriesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create CouponRedemptions table; an order can hold at most one coupon
+	couponRedemptionsTable := `
+	CREATE TABLE IF NOT EXISTS coupon_redemptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		coupon_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		order_id INTEGER NOT NULL UNIQUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (coupon_id) REFERENCES coupons (id),
+		FOREIGN KEY (user_id) REFERENCES users (id),
+		FOREIGN KEY (order_id) REFERENCES orders (id)
+	);
+	`
+	_, err = DB.Exec(couponRedemptionsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// A coupon applied to a cart only counts as used once the order is placed. Coupons on
+	// orders placed before this was tracked were counted when applied.
+	if addColumn("coupon_redemptions", "redeemed_at", "DATETIME") {
+		_, err = DB.Exec(`UPDATE coupon_redemptions SET redeemed_at = created_at
+			WHERE order_id IN (SELECT id FROM orders WHERE status NOT IN ('cart', 'cancelled'))`)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Create OrderDiscounts table holding the discount lines of an order
+	orderDiscountsTable := `
+	CREATE TABLE IF NOT EXISTS order_discounts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		source_id INTEGER NOT NULL,
+		code TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL,
+		amount REAL NOT NULL,
+		FOREIGN KEY (order_id) REFERENCES orders (id)
+	);
+	`
+	_, err = DB.Exec(orderDiscountsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create Promotions table
+	promotionsTable := `
+	CREATE TABLE IF NOT EXISTS promotions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT 1,
+		starts_at TIMESTAMP,
+		ends_at TIMESTAMP,
+		buy_quantity INTEGER NOT NULL DEFAULT 0,
+		get_quantity INTEGER NOT NULL DEFAULT 0,
+		bundle_price REAL NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err = DB.Exec(promotionsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create PromotionProducts table
+	promotionProductsTable := `
+	CREATE TABLE IF NOT EXISTS promotion_products (
+		promotion_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL DEFAULT 1,
+		PRIMARY KEY (promotion_id, product_id),
+		FOREIGN KEY (promotion_id) REFERENCES promotions (id),
+		FOREIGN KEY (product_id) REFERENCES products (id)
+	);
+	`
+	_, err = DB.Exec(promotionProductsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create PromotionTiers table
+	promotionTiersTable := `
+	CREATE TABLE IF NOT EXISTS promotion_tiers (
+		promotion_id INTEGER NOT NULL,
+		min_quantity INTEGER NOT NULL,
+		unit_price REAL NOT NULL,
+		PRIMARY KEY (promotion_id, min_quantity),
+		FOREIGN KEY (promotion_id) REFERENCES promotions (id)
+	);
+	`
+	_, err = DB.Exec(promotionTiersTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create OrderItemPromotions table recording the promotions applied to each order line
+	orderItemPromotionsTable := `
+	CREATE TABLE IF NOT EXISTS order_item_promotions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		order_item_id INTEGER NOT NULL,
+		promotion_id INTEGER NOT NULL,
+		description TEXT NOT NULL,
+		discount REAL NOT NULL,
+		FOREIGN KEY (order_id) REFERENCES orders (id),
+		FOREIGN KEY (order_item_id) REFERENCES order_items (id),
+		FOREIGN KEY (promotion_id) REFERENCES promotions (id)
+	);
+	`
+	_, err = DB.Exec(orderItemPromotionsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create TaxRates table; an empty region applies to the whole country
+	taxRatesTable := `
+	CREATE TABLE IF NOT EXISTS tax_rates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		country TEXT NOT NULL COLLATE NOCASE,
+		region TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+		tax_class TEXT NOT NULL DEFAULT 'standard',
+		name TEXT NOT NULL,
+		rate REAL NOT NULL,
+		UNIQUE (country, region, tax_class)
+	);
+	`
+	_, err = DB.Exec(taxRatesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create Addresses table
+	addressesTable := `
+	CREATE TABLE IF NOT EXISTS addresses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		line1 TEXT NOT NULL,
+		line2 TEXT NOT NULL DEFAULT '',
+		city TEXT NOT NULL,
+		region TEXT NOT NULL DEFAULT '',
+		postal_code TEXT NOT NULL DEFAULT '',
+		country TEXT NOT NULL,
+		phone TEXT NOT NULL DEFAULT '',
+		is_default_shipping BOOLEAN NOT NULL DEFAULT 0,
+		is_default_billing BOOLEAN NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+	`
+	_, err = DB.Exec(addressesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create OrderAddresses table; rows are snapshots taken when an order is placed
+	orderAddressesTable := `
+	CREATE TABLE IF NOT EXISTS order_addresses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		name TEXT NOT NULL,
+		line1 TEXT NOT NULL,
+		line2 TEXT NOT NULL DEFAULT '',
+		city TEXT NOT NULL,
+		region TEXT NOT NULL DEFAULT '',
+		postal_code TEXT NOT NULL DEFAULT '',
+		country TEXT NOT NULL,
+		phone TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id),
+		UNIQUE (order_id, kind)
+	);
+	`
+	_, err = DB.Exec(orderAddressesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create ShippingMethods table
+	shippingMethodsTable := `
+	CREATE TABLE IF NOT EXISTS shipping_methods (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		carrier TEXT NOT NULL DEFAULT '',
+		base_rate REAL NOT NULL DEFAULT 0,
+		rate_per_kg REAL NOT NULL DEFAULT 0,
+		free_threshold REAL NOT NULL DEFAULT 0,
+		active BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err = DB.Exec(shippingMethodsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create Shipments table
+	shipmentsTable := `
+	CREATE TABLE IF NOT EXISTS shipments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		carrier TEXT NOT NULL,
+		tracking_number TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		shipped_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		delivered_at DATETIME,
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	);
+	`
+	_, err = DB.Exec(shipmentsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create ShipmentItems table
+	shipmentItemsTable := `
+	CREATE TABLE IF NOT EXISTS shipment_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		shipment_id INTEGER NOT NULL,
+		order_item_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		FOREIGN KEY (shipment_id) REFERENCES shipments(id),
+		FOREIGN KEY (order_item_id) REFERENCES order_items(id)
+	);
+	`
+	_, err = DB.Exec(shipmentItemsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create Payments table; every authorization attempt is a row
+	paymentsTable := `
+	CREATE TABLE IF NOT EXISTS payments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		reference TEXT NOT NULL DEFAULT '',
+		amount REAL NOT NULL,
+		captured_amount REAL NOT NULL DEFAULT 0,
+		refunded_amount REAL NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		failure_reason TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	);
+	`
+	_, err = DB.Exec(paymentsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create Returns table
+	returnsTable := `
+	CREATE TABLE IF NOT EXISTS returns (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		refund_amount REAL NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	);
+	`
+	_, err = DB.Exec(returnsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create ReturnItems table
+	returnItemsTable := `
+	CREATE TABLE IF NOT EXISTS return_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		return_id INTEGER NOT NULL,
+		order_item_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		FOREIGN KEY (return_id) REFERENCES returns(id),
+		FOREIGN KEY (order_item_id) REFERENCES order_items(id)
+	);
+	`
+	_, err = DB.Exec(returnItemsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create InventoryMovements table; every stock change after a product is created is recorded here
+	inventoryMovementsTable := `
+	CREATE TABLE IF NOT EXISTS inventory_movements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		reason TEXT NOT NULL,
+		order_id INTEGER,
+		return_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (product_id) REFERENCES products(id)
+	);
+	`
+	_, err = DB.Exec(inventoryMovementsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create Sessions table; only a hash of each token is stored
+	sessionsTable := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+	`
+	_, err = DB.Exec(sessionsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create Invoices table; each invoice keeps a copy of the order as it was when issued
+	invoicesTable := `
+	CREATE TABLE IF NOT EXISTS invoices (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL UNIQUE,
+		number TEXT NOT NULL UNIQUE,
+		customer_name TEXT NOT NULL DEFAULT '',
+		customer_email TEXT NOT NULL DEFAULT '',
+		lines TEXT NOT NULL,
+		taxes TEXT NOT NULL,
+		billing_address TEXT,
+		shipping_address TEXT,
+		subtotal REAL NOT NULL,
+		discount_total REAL NOT NULL DEFAULT 0,
+		shipping_total REAL NOT NULL DEFAULT 0,
+		tax_total REAL NOT NULL DEFAULT 0,
+		total REAL NOT NULL,
+		prices_include_tax BOOLEAN NOT NULL DEFAULT 0,
+		issued_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	);
+	`
+	_, err = DB.Exec(invoicesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create InvoiceSequence table; a single counter row keeps invoice numbers gap-free
+	invoiceSequenceTable := `
+	CREATE TABLE IF NOT EXISTS invoice_sequence (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		last_number INTEGER NOT NULL
+	);
+	INSERT OR IGNORE INTO invoice_sequence (id, last_number) VALUES (1, 0);
+	`
+	_, err = DB.Exec(invoiceSequenceTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create EmailOutbox table; emails are queued here in the transaction that triggers them
+	// and sent once it has committed
+	emailOutboxTable := `
+	CREATE TABLE IF NOT EXISTS email_outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		recipient TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		text_body TEXT NOT NULL,
+		html_body TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		sent_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_email_outbox_due ON email_outbox (status, next_attempt_at);
+	`
+	_, err = DB.Exec(emailOutboxTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create UserTokens table for password reset and email verification links; like
+	// sessions, only a hash of each token is stored
+	userTokensTable := `
+	CREATE TABLE IF NOT EXISTS user_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		purpose TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+	`
+	_, err = DB.Exec(userTokensTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create RecoveryCodes table; one-time codes that stand in for a lost authenticator,
+	// stored hashed
+	recoveryCodesTable := `
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+	`
+	_, err = DB.Exec(recoveryCodesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create ApiKeys table for server-to-server integrations. Only a hash of each key is
+	// stored; scopes are a comma-separated list of permissions.
+	apiKeysTable := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL UNIQUE,
+		key_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL DEFAULT '',
+		created_by INTEGER NOT NULL,
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		revoked_at DATETIME,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (created_by) REFERENCES users(id)
+	);
+	`
+	_, err = DB.Exec(apiKeysTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create PersistedQueries table; the operations registered from client manifests, keyed
+	// by the SHA-256 hash of their text
+	persistedQueriesTable := `
+	CREATE TABLE IF NOT EXISTS persisted_queries (
+		hash TEXT PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT '',
+		body TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	`
+	_, err = DB.Exec(persistedQueriesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	fmt.Println("Tables created successfully")
 }
 
+// addColumn adds a column to an existing table unless it is already present, reporting
+// whether it was added
+func addColumn(table, column, definition string) bool {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			log.Fatal(err)
+		}
+		if name == column {
+			return false
+		}
+	}
+	rows.Close()
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return true
+}
+
+// WithTx runs fn inside a transaction, committing if it returns nil and rolling back otherwise.
+// Work registered with AfterCommit runs once the transaction has committed.
+func WithTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		takeCommitHooks(tx)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		takeCommitHooks(tx)
+		return err
+	}
+	for _, f := range takeCommitHooks(tx) {
+		f()
+	}
+	return nil
+}
+
+var (
+	commitHooksMu sync.Mutex
+	commitHooks   = make(map[*sql.Tx][]func())
+)
+
+// AfterCommit runs f once the transaction started by WithTx that db belongs to has committed,
+// or straight away when db is not a transaction. f doesn't run if the transaction rolls back.
+func AfterCommit(db Querier, f func()) {
+	tx, ok := db.(*sql.Tx)
+	if !ok {
+		f()
+		return
+	}
+	commitHooksMu.Lock()
+	commitHooks[tx] = append(commitHooks[tx], f)
+	commitHooksMu.Unlock()
+}
+
+// takeCommitHooks removes and returns the work registered for a transaction
+func takeCommitHooks(tx *sql.Tx) []func() {
+	commitHooksMu.Lock()
+	defer commitHooksMu.Unlock()
+	hooks := commitHooks[tx]
+	delete(commitHooks, tx)
+	return hooks
+}
+
+// isUniqueViolation reports whether an insert or update failed on a UNIQUE constraint
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
 // CloseDB closes the database connection
 func CloseDB() {
 	if DB != nil {
@@ -140,7 +863,7 @@ func CloseDB() {
 
 // GetAllOrders retrieves all orders from the database
 func GetAllOrders() ([]*Order, error) {
-	rows, err := DB.Query("SELECT id, user_id, status, total, created_at FROM orders")
+	rows, err := DB.Query("SELECT " + orderColumns + " FROM orders")
 	if err != nil {
 		return nil, err
 	}
@@ -149,7 +872,7 @@ func GetAllOrders() ([]*Order, error) {
 	var orders []*Order
 	for rows.Next() {
 		order := &Order{}
-		err := rows.Scan(&order.ID, &order.UserID, &order.Status, &order.Total, &order.CreatedAt)
+		err := scanOrder(rows, order)
 		if err != nil {
 			return nil, err
 		}
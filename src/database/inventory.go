@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/events"
+)
+
+// Inventory movement reasons
+const (
+	InventoryReasonSale         = "sale"
+	InventoryReasonReturn       = "return"
+	InventoryReasonCancellation = "cancellation"
+)
+
+// InventoryMovement records a change to a product's inventory. Quantity is negative
+// when stock leaves the warehouse.
+type InventoryMovement struct {
+	ID        int
+	ProductID int
+	Quantity  int
+	Reason    string
+	OrderID   int
+	ReturnID  int
+	CreatedAt string
+}
+
+// InventoryMovement operations
+
+// RecordInventoryMovement changes a product's inventory and records why. Stock never goes below
+// zero. The new inventory is published as an events.StockChanged event once committed.
+func RecordInventoryMovement(db Querier, movement *InventoryMovement) error {
+	result, err := db.Exec(`UPDATE products SET inventory = inventory + ? WHERE id = ? AND inventory + ? >= 0`,
+		movement.Quantity, movement.ProductID, movement.Quantity)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		product, err := GetProductByID(db, movement.ProductID)
+		if err != nil {
+			return err
+		}
+		return apperr.InsufficientStock(product.ID, -movement.Quantity, product.Inventory)
+	}
+
+	_, err = db.Exec(`INSERT INTO inventory_movements (product_id, quantity, reason, order_id, return_id) VALUES (?, ?, ?, ?, ?)`,
+		movement.ProductID, movement.Quantity, movement.Reason, nullableID(movement.OrderID), nullableID(movement.ReturnID))
+	if err != nil {
+		return err
+	}
+
+	var inventory int
+	if err := db.QueryRow(`SELECT inventory FROM products WHERE id = ?`, movement.ProductID).Scan(&inventory); err != nil {
+		return err
+	}
+	AfterCommit(db, func() {
+		events.Publish(events.Event{Kind: events.StockChanged, ProductID: movement.ProductID, Inventory: inventory})
+	})
+	return nil
+}
+
+// GetInventoryMovementsByProductID retrieves the most recent inventory movements of a product
+func GetInventoryMovementsByProductID(db *sql.DB, productID, limit int) ([]InventoryMovement, error) {
+	rows, err := db.Query(`SELECT id, product_id, quantity, reason, COALESCE(order_id, 0), COALESCE(return_id, 0), created_at
+		FROM inventory_movements WHERE product_id = ? ORDER BY id DESC LIMIT ?`, productID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []InventoryMovement
+	for rows.Next() {
+		var m InventoryMovement
+		if err := rows.Scan(&m.ID, &m.ProductID, &m.Quantity, &m.Reason, &m.OrderID, &m.ReturnID, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+	return movements, rows.Err()
+}
+
+// nullableID stores a zero ID as NULL
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
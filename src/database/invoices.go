@@ -0,0 +1,160 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Invoice is the accounting record of a paid order. Lines, taxes and addresses are copied
+// from the order when the invoice is issued and never change afterwards.
+type Invoice struct {
+	ID               int
+	OrderID          int
+	Number           string
+	CustomerName     string
+	CustomerEmail    string
+	Lines            []InvoiceLine
+	Taxes            []TaxBreakdown
+	BillingAddress   *OrderAddress
+	ShippingAddress  *OrderAddress
+	Subtotal         float64
+	DiscountTotal    float64
+	ShippingTotal    float64
+	TaxTotal         float64
+	Total            float64
+	PricesIncludeTax bool
+	IssuedAt         string
+}
+
+// InvoiceLine is an order item as it was invoiced
+type InvoiceLine struct {
+	ProductID   int
+	Description string
+	Quantity    int
+	UnitPrice   float64
+	Amount      float64
+	TaxName     string
+	TaxRate     float64
+	TaxAmount   float64
+}
+
+// Invoice operations
+
+const invoiceColumns = `id, order_id, number, customer_name, customer_email, lines, taxes, billing_address, shipping_address,
+	subtotal, discount_total, shipping_total, tax_total, total, prices_include_tax, issued_at`
+
+func scanInvoice(row interface{ Scan(...interface{}) error }, invoice *Invoice) error {
+	var lines, taxes string
+	var billing, shipping sql.NullString
+	err := row.Scan(&invoice.ID, &invoice.OrderID, &invoice.Number, &invoice.CustomerName, &invoice.CustomerEmail, &lines, &taxes,
+		&billing, &shipping, &invoice.Subtotal, &invoice.DiscountTotal, &invoice.ShippingTotal, &invoice.TaxTotal, &invoice.Total,
+		&invoice.PricesIncludeTax, &invoice.IssuedAt)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(lines), &invoice.Lines); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(taxes), &invoice.Taxes); err != nil {
+		return err
+	}
+	if billing.Valid {
+		if err := json.Unmarshal([]byte(billing.String), &invoice.BillingAddress); err != nil {
+			return err
+		}
+	}
+	if shipping.Valid {
+		if err := json.Unmarshal([]byte(shipping.String), &invoice.ShippingAddress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetInvoiceByID retrieves an invoice by ID
+func GetInvoiceByID(db Querier, id int) (*Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE id = ?`
+
+	var invoice Invoice
+	err := scanInvoice(db.QueryRow(query, id), &invoice)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("invoice")
+		}
+		return nil, err
+	}
+
+	return &invoice, nil
+}
+
+// GetInvoiceByOrderID retrieves the invoice of an order, or nil if none has been issued
+func GetInvoiceByOrderID(db Querier, orderID int) (*Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE order_id = ?`
+
+	var invoice Invoice
+	err := scanInvoice(db.QueryRow(query, orderID), &invoice)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &invoice, nil
+}
+
+// NextInvoiceNumber takes the next number from the invoice sequence. It must run in the
+// transaction that inserts the invoice so a rollback also returns the number.
+func NextInvoiceNumber(tx *sql.Tx) (int, error) {
+	var number int
+	err := tx.QueryRow(`UPDATE invoice_sequence SET last_number = last_number + 1 WHERE id = 1 RETURNING last_number`).Scan(&number)
+	return number, err
+}
+
+// CreateInvoice stores an invoice and sets its ID
+func CreateInvoice(db Querier, invoice *Invoice) error {
+	lines, err := json.Marshal(invoice.Lines)
+	if err != nil {
+		return err
+	}
+	taxes, err := json.Marshal(invoice.Taxes)
+	if err != nil {
+		return err
+	}
+	billing, err := nullableJSON(invoice.BillingAddress)
+	if err != nil {
+		return err
+	}
+	shipping, err := nullableJSON(invoice.ShippingAddress)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec(`INSERT INTO invoices (order_id, number, customer_name, customer_email, lines, taxes, billing_address,
+		shipping_address, subtotal, discount_total, shipping_total, tax_total, total, prices_include_tax)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		invoice.OrderID, invoice.Number, invoice.CustomerName, invoice.CustomerEmail, string(lines), string(taxes), billing, shipping,
+		invoice.Subtotal, invoice.DiscountTotal, invoice.ShippingTotal, invoice.TaxTotal, invoice.Total, invoice.PricesIncludeTax)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	invoice.ID = int(id)
+	return nil
+}
+
+func nullableJSON(address *OrderAddress) (interface{}, error) {
+	if address == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(address)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
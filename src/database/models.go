@@ -2,36 +2,96 @@ package database
 
 import (
 	"database/sql"
-	"errors"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/events"
 )
 
 // User represents a user in the system
 type User struct {
-	ID        int
-	Name      string
-	Email     string
-	Password  string
-	CreatedAt string
+	ID            int
+	Name          string
+	Email         string
+	Password      string
+	Role          string
+	EmailVerified bool
+	TOTPSecret    string
+	TOTPEnabled   bool
+	TOTPLastStep  int64
+	CreatedAt     string
 }
 
+// User roles
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
 // Product represents a product in the system
 type Product struct {
-	ID          int
-	Name        string
-	Description string
-	Price       float64
-	Inventory   int
-	CreatedAt   string
+	ID            int
+	Name          string
+	Description   string
+	Price         float64
+	Inventory     int
+	Category      string
+	TaxClass      string
+	Weight        float64
+	Length        float64
+	Width         float64
+	Height        float64
+	CreatedAt     string
+	AverageRating float64
+	ReviewCount   int
 }
 
+// ProductImage represents an image attached to a product
+type ProductImage struct {
+	ID           int
+	ProductID    int
+	Filename     string
+	ContentType  string
+	StorageKey   string
+	ThumbnailKey string
+	Width        int
+	Height       int
+	CreatedAt    string
+}
+
+// Order statuses
+const (
+	OrderStatusCart              = "cart"
+	OrderStatusPending           = "pending"
+	OrderStatusAuthorized        = "authorized"
+	OrderStatusPaid              = "paid"
+	OrderStatusPartiallyShipped  = "partially_shipped"
+	OrderStatusShipped           = "shipped"
+	OrderStatusDelivered         = "delivered"
+	OrderStatusCancelled         = "cancelled"
+	OrderStatusPartiallyRefunded = "partially_refunded"
+	OrderStatusRefunded          = "refunded"
+)
+
 // Order represents an order in the system
 type Order struct {
-	ID        int
-	UserID    int
-	Status    string
-	Total     float64
-	CreatedAt string
-	Items     []OrderItem
+	ID                 int
+	UserID             int
+	Status             string
+	Country            string
+	Region             string
+	Subtotal           float64
+	DiscountTotal      float64
+	FreeShipping       bool
+	TaxTotal           float64
+	PricesIncludeTax   bool
+	ShippingMethodID   int
+	ShippingTotal      float64
+	Total              float64
+	CancellationReason string
+	CancelledAt        *string
+	CreatedAt          string
+	Items              []OrderItem
 }
 
 // OrderItem represents an item in an order
@@ -41,20 +101,47 @@ type OrderItem struct {
 	ProductID int
 	Quantity  int
 	Price     float64
+	TaxBase   float64
+	TaxRate   float64
+	TaxName   string
+	TaxAmount float64
 	Product   *Product
 }
 
 // User operations
 
+const userColumns = `id, name, email, password, role, email_verified, totp_secret, totp_enabled, totp_last_step, created_at`
+
+func scanUser(row interface{ Scan(...interface{}) error }, user *User) error {
+	return row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.EmailVerified, &user.TOTPSecret,
+		&user.TOTPEnabled, &user.TOTPLastStep, &user.CreatedAt)
+}
+
 // GetUserByID retrieves a user by ID
-func GetUserByID(db *sql.DB, id int) (*User, error) {
-	query := `SELECT id, name, email, password, created_at FROM users WHERE id = ?`
+func GetUserByID(db Querier, id int) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+
+	var user User
+	err := scanUser(db.QueryRow(query, id), &user)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("user")
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by email address, ignoring case
+func GetUserByEmail(db Querier, email string) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = ? COLLATE NOCASE`
 
 	var user User
-	err := db.QueryRow(query, id).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt)
+	err := scanUser(db.QueryRow(query, email), &user)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, apperr.NotFound("user")
 		}
 		return nil, err
 	}
@@ -62,9 +149,33 @@ func GetUserByID(db *sql.DB, id int) (*User, error) {
 	return &user, nil
 }
 
+// SetUserPassword stores a new password hash for a user
+func SetUserPassword(db Querier, id int, passwordHash string) error {
+	_, err := db.Exec(`UPDATE users SET password = ? WHERE id = ?`, passwordHash, id)
+	return err
+}
+
+// SetUserRole changes the role of a user
+func SetUserRole(db Querier, id int, role string) error {
+	result, err := db.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return apperr.NotFound("user")
+	}
+	return nil
+}
+
+// SetEmailVerified marks a user's email address as verified
+func SetEmailVerified(db Querier, id int) error {
+	_, err := db.Exec(`UPDATE users SET email_verified = 1 WHERE id = ?`, id)
+	return err
+}
+
 // GetAllUsers retrieves all users
 func GetAllUsers(db *sql.DB) ([]User, error) {
-	query := `SELECT id, name, email, created_at FROM users`
+	query := `SELECT ` + userColumns + ` FROM users`
 
 	rows, err := db.Query(query)
 	if err != nil {
@@ -75,7 +186,7 @@ func GetAllUsers(db *sql.DB) ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt)
+		err := scanUser(rows, &user)
 		if err != nil {
 			return nil, err
 		}
@@ -85,12 +196,15 @@ func GetAllUsers(db *sql.DB) ([]User, error) {
 	return users, nil
 }
 
-// CreateUser creates a new user
-func CreateUser(db *sql.DB, name, email, password string) (*User, error) {
+// CreateUser creates a new user. The password must already be hashed.
+func CreateUser(db Querier, name, email, password string) (*User, error) {
 	query := `INSERT INTO users (name, email, password) VALUES (?, ?, ?)`
 
 	result, err := db.Exec(query, name, email, password)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, &apperr.Error{Code: apperr.CodeConflict, Message: "email is already registered", Field: "email"}
+		}
 		return nil, err
 	}
 
@@ -104,15 +218,24 @@ func CreateUser(db *sql.DB, name, email, password string) (*User, error) {
 
 // Product operations
 
+// productColumns lists the products columns read by scanProduct
+const productColumns = `id, name, description, price, inventory, category, tax_class, weight, length, width, height, created_at, average_rating, review_count`
+
+// scanProduct scans a row selected with productColumns
+func scanProduct(row interface{ Scan(...interface{}) error }, product *Product) error {
+	return row.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Inventory, &product.Category, &product.TaxClass,
+		&product.Weight, &product.Length, &product.Width, &product.Height, &product.CreatedAt, &product.AverageRating, &product.ReviewCount)
+}
+
 // GetProductByID retrieves a product by ID
-func GetProductByID(db *sql.DB, id int) (*Product, error) {
-	query := `SELECT id, name, description, price, inventory, created_at FROM products WHERE id = ?`
+func GetProductByID(db Querier, id int) (*Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products WHERE id = ?`
 
 	var product Product
-	err := DB.QueryRow(query, id).Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Inventory, &product.CreatedAt)
+	err := scanProduct(db.QueryRow(query, id), &product)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("product not found")
+			return nil, apperr.NotFound("product")
 		}
 		return nil, err
 	}
@@ -122,7 +245,7 @@ func GetProductByID(db *sql.DB, id int) (*Product, error) {
 
 // GetAllProducts retrieves all products
 func GetAllProducts(db *sql.DB) ([]Product, error) {
-	query := `SELECT id, name, description, price, inventory, created_at FROM products`
+	query := `SELECT ` + productColumns + ` FROM products`
 
 	rows, err := db.Query(query)
 	if err != nil {
@@ -133,7 +256,7 @@ func GetAllProducts(db *sql.DB) ([]Product, error) {
 	var products []Product
 	for rows.Next() {
 		var product Product
-		err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Inventory, &product.CreatedAt)
+		err := scanProduct(rows, &product)
 		if err != nil {
 			return nil, err
 		}
@@ -144,10 +267,13 @@ func GetAllProducts(db *sql.DB) ([]Product, error) {
 }
 
 // CreateProduct creates a new product
-func CreateProduct(db *sql.DB, name, description string, price float64, inventory int) (*Product, error) {
-	query := `INSERT INTO products (name, description, price, inventory) VALUES (?, ?, ?, ?)`
+func CreateProduct(db *sql.DB, name, description, category, taxClass string, price float64, inventory int) (*Product, error) {
+	query := `INSERT INTO products (name, description, category, tax_class, price, inventory) VALUES (?, ?, ?, ?, ?, ?)`
 
-	result, err := DB.Exec(query, name, description, price, inventory)
+	if taxClass == "" {
+		taxClass = TaxClassStandard
+	}
+	result, err := db.Exec(query, name, description, category, taxClass, price, inventory)
 	if err != nil {
 		return nil, err
 	}
@@ -160,17 +286,93 @@ func CreateProduct(db *sql.DB, name, description string, price float64, inventor
 	return GetProductByID(db, int(id))
 }
 
+// ProductImage operations
+
+// GetProductImageByID retrieves a product image by ID
+func GetProductImageByID(db *sql.DB, id int) (*ProductImage, error) {
+	query := `SELECT id, product_id, filename, content_type, storage_key, thumbnail_key, width, height, created_at FROM product_images WHERE id = ?`
+
+	var image ProductImage
+	err := db.QueryRow(query, id).Scan(&image.ID, &image.ProductID, &image.Filename, &image.ContentType, &image.StorageKey, &image.ThumbnailKey, &image.Width, &image.Height, &image.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("product image")
+		}
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+// GetProductImagesByProductID retrieves all images for a product
+func GetProductImagesByProductID(db *sql.DB, productID int) ([]ProductImage, error) {
+	query := `SELECT id, product_id, filename, content_type, storage_key, thumbnail_key, width, height, created_at FROM product_images WHERE product_id = ? ORDER BY id`
+
+	rows, err := db.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []ProductImage
+	for rows.Next() {
+		var image ProductImage
+		err := rows.Scan(&image.ID, &image.ProductID, &image.Filename, &image.ContentType, &image.StorageKey, &image.ThumbnailKey, &image.Width, &image.Height, &image.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
+
+// CreateProductImage records an uploaded product image
+func CreateProductImage(db *sql.DB, image *ProductImage) (*ProductImage, error) {
+	query := `INSERT INTO product_images (product_id, filename, content_type, storage_key, thumbnail_key, width, height) VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := db.Exec(query, image.ProductID, image.Filename, image.ContentType, image.StorageKey, image.ThumbnailKey, image.Width, image.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return GetProductImageByID(db, int(id))
+}
+
 // Order operations
 
+// orderColumns lists the orders columns read by scanOrder
+const orderColumns = `id, user_id, status, country, region, subtotal, discount_total, free_shipping, tax_total, prices_include_tax, shipping_method_id, shipping_total, total, cancellation_reason, cancelled_at, created_at`
+
+// scanOrder scans a row selected with orderColumns
+func scanOrder(row interface{ Scan(...interface{}) error }, order *Order) error {
+	var cancelledAt sql.NullString
+	err := row.Scan(&order.ID, &order.UserID, &order.Status, &order.Country, &order.Region, &order.Subtotal, &order.DiscountTotal,
+		&order.FreeShipping, &order.TaxTotal, &order.PricesIncludeTax, &order.ShippingMethodID, &order.ShippingTotal, &order.Total,
+		&order.CancellationReason, &cancelledAt, &order.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if cancelledAt.Valid {
+		order.CancelledAt = &cancelledAt.String
+	}
+	return nil
+}
+
 // GetOrderByID retrieves an order by ID
-func GetOrderByID(db *sql.DB, id int) (*Order, error) {
-	query := `SELECT id, user_id, status, total, created_at FROM orders WHERE id = ?`
+func GetOrderByID(db Querier, id int) (*Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = ?`
 
 	var order Order
-	err := DB.QueryRow(query, id).Scan(&order.ID, &order.UserID, &order.Status, &order.Total, &order.CreatedAt)
+	err := scanOrder(db.QueryRow(query, id), &order)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("order not found")
+			return nil, apperr.NotFound("order")
 		}
 		return nil, err
 	}
@@ -187,7 +389,7 @@ func GetOrderByID(db *sql.DB, id int) (*Order, error) {
 
 // GetOrdersByUserID retrieves all orders for a user
 func GetOrdersByUserID(db *sql.DB, userID int) ([]Order, error) {
-	query := `SELECT id, user_id, status, total, created_at FROM orders WHERE user_id = ?`
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE user_id = ?`
 
 	rows, err := db.Query(query, userID)
 	if err != nil {
@@ -198,7 +400,7 @@ func GetOrdersByUserID(db *sql.DB, userID int) ([]Order, error) {
 	var orders []Order
 	for rows.Next() {
 		var order Order
-		err := rows.Scan(&order.ID, &order.UserID, &order.Status, &order.Total, &order.CreatedAt)
+		err := scanOrder(rows, &order)
 		if err != nil {
 			return nil, err
 		}
@@ -216,11 +418,11 @@ func GetOrdersByUserID(db *sql.DB, userID int) ([]Order, error) {
 	return orders, nil
 }
 
-// CreateOrder creates a new order
-func CreateOrder(db *sql.DB, userID int, status string, total float64) (*Order, error) {
-	query := `INSERT INTO orders (user_id, status, total) VALUES (?, ?, ?)`
+// CreateOrder creates a new, empty order in the cart status
+func CreateOrder(db *sql.DB, userID int) (*Order, error) {
+	query := `INSERT INTO orders (user_id, status, total) VALUES (?, ?, 0)`
 
-	result, err := db.Exec(query, userID, status, total)
+	result, err := db.Exec(query, userID, OrderStatusCart)
 	if err != nil {
 		return nil, err
 	}
@@ -233,11 +435,66 @@ func CreateOrder(db *sql.DB, userID int, status string, total float64) (*Order,
 	return GetOrderByID(db, int(id))
 }
 
+// UpdateOrderTotals stores the calculated amounts of an order
+func UpdateOrderTotals(db Querier, order *Order) error {
+	_, err := db.Exec(`UPDATE orders SET subtotal = ?, discount_total = ?, free_shipping = ?, tax_total = ?, prices_include_tax = ?,
+		shipping_total = ?, total = ? WHERE id = ?`,
+		order.Subtotal, order.DiscountTotal, order.FreeShipping, order.TaxTotal, order.PricesIncludeTax,
+		order.ShippingTotal, order.Total, order.ID)
+	return err
+}
+
+// UpdateOrderStatus sets the status of an order. A change is published as an
+// events.OrderStatusChanged event once committed.
+func UpdateOrderStatus(db Querier, orderID int, status string) error {
+	result, err := db.Exec(`UPDATE orders SET status = ? WHERE id = ? AND status != ?`, status, orderID, status)
+	if err != nil {
+		return err
+	}
+	publishStatusChange(db, result, orderID, status)
+	return nil
+}
+
+// CancelOrder marks an order cancelled and records why
+func CancelOrder(db Querier, orderID int, reason string) error {
+	result, err := db.Exec(`UPDATE orders SET status = ?, cancellation_reason = ?, cancelled_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		OrderStatusCancelled, reason, orderID)
+	if err != nil {
+		return err
+	}
+	publishStatusChange(db, result, orderID, OrderStatusCancelled)
+	return nil
+}
+
+// publishStatusChange publishes the new status of an order if the update changed it
+func publishStatusChange(db Querier, result sql.Result, orderID int, status string) {
+	if n, _ := result.RowsAffected(); n == 0 {
+		return
+	}
+	AfterCommit(db, func() {
+		events.Publish(events.Event{Kind: events.OrderStatusChanged, OrderID: orderID, Status: status})
+	})
+}
+
+// SetOrderLocation sets the country and region an order is taxed in
+func SetOrderLocation(db Querier, orderID int, country, region string) error {
+	_, err := db.Exec(`UPDATE orders SET country = ?, region = ? WHERE id = ?`, country, region, orderID)
+	return err
+}
+
 // OrderItem operations
 
+// orderItemColumns lists the order_items columns read by scanOrderItem
+const orderItemColumns = `id, order_id, product_id, quantity, price, tax_base, tax_rate, tax_name, tax_amount`
+
+// scanOrderItem scans a row selected with orderItemColumns
+func scanOrderItem(row interface{ Scan(...interface{}) error }, item *OrderItem) error {
+	return row.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price, &item.TaxBase, &item.TaxRate, &item.TaxName, &item.TaxAmount)
+}
+
 // GetOrderItemsByOrderID retrieves all items for an order
-func GetOrderItemsByOrderID(db *sql.DB, orderID int) ([]OrderItem, error) {
-	query := `SELECT id, order_id, product_id, quantity, price FROM order_items WHERE order_id = ?`
+func GetOrderItemsByOrderID(db Querier, orderID int) ([]OrderItem, error) {
+	query := `SELECT ` + orderItemColumns + ` FROM order_items WHERE order_id = ? ORDER BY id`
 
 	rows, err := db.Query(query, orderID)
 	if err != nil {
@@ -248,7 +505,7 @@ func GetOrderItemsByOrderID(db *sql.DB, orderID int) ([]OrderItem, error) {
 	var items []OrderItem
 	for rows.Next() {
 		var item OrderItem
-		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price)
+		err := scanOrderItem(rows, &item)
 		if err != nil {
 			return nil, err
 		}
@@ -266,11 +523,33 @@ func GetOrderItemsByOrderID(db *sql.DB, orderID int) ([]OrderItem, error) {
 	return items, nil
 }
 
+// GetOrderItemByID retrieves an order item with its product
+func GetOrderItemByID(db Querier, id int) (*OrderItem, error) {
+	query := `SELECT ` + orderItemColumns + ` FROM order_items WHERE id = ?`
+
+	var item OrderItem
+	err := scanOrderItem(db.QueryRow(query, id), &item)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("order item")
+		}
+		return nil, err
+	}
+
+	product, err := GetProductByID(db, item.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	item.Product = product
+
+	return &item, nil
+}
+
 // AddOrderItem adds an item to an order
-func AddOrderItem(db *sql.DB, orderID, productID, quantity int, price float64) (*OrderItem, error) {
+func AddOrderItem(db Querier, orderID, productID, quantity int, price float64) (*OrderItem, error) {
 	query := `INSERT INTO order_items (order_id, product_id, quantity, price) VALUES (?, ?, ?, ?)`
 
-	result, err := DB.Exec(query, orderID, productID, quantity, price)
+	result, err := db.Exec(query, orderID, productID, quantity, price)
 	if err != nil {
 		return nil, err
 	}
@@ -282,8 +561,7 @@ func AddOrderItem(db *sql.DB, orderID, productID, quantity int, price float64) (
 
 	// Retrieve the created order item
 	var orderItem OrderItem
-	err = DB.QueryRow("SELECT id, order_id, product_id, quantity, price FROM order_items WHERE id = ?", id).
-		Scan(&orderItem.ID, &orderItem.OrderID, &orderItem.ProductID, &orderItem.Quantity, &orderItem.Price)
+	err = scanOrderItem(db.QueryRow("SELECT "+orderItemColumns+" FROM order_items WHERE id = ?", id), &orderItem)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"database/sql"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Outbox email statuses
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSent    = "sent"
+	EmailStatusFailed  = "failed"
+)
+
+// OutboxEmail is a rendered email waiting to be sent, or the record of one that was
+type OutboxEmail struct {
+	ID            int
+	Kind          string
+	Recipient     string
+	Subject       string
+	TextBody      string
+	HTMLBody      string
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt string
+	SentAt        *string
+	CreatedAt     string
+}
+
+// OutboxEmail operations
+
+const outboxEmailColumns = `id, kind, recipient, subject, text_body, html_body, status, attempts, last_error, next_attempt_at, sent_at, created_at`
+
+func scanOutboxEmail(row interface{ Scan(...interface{}) error }, email *OutboxEmail) error {
+	return row.Scan(&email.ID, &email.Kind, &email.Recipient, &email.Subject, &email.TextBody, &email.HTMLBody, &email.Status,
+		&email.Attempts, &email.LastError, &email.NextAttemptAt, &email.SentAt, &email.CreatedAt)
+}
+
+// GetOutboxEmailByID retrieves an outbox email by ID
+func GetOutboxEmailByID(db Querier, id int) (*OutboxEmail, error) {
+	query := `SELECT ` + outboxEmailColumns + ` FROM email_outbox WHERE id = ?`
+
+	var email OutboxEmail
+	err := scanOutboxEmail(db.QueryRow(query, id), &email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("email")
+		}
+		return nil, err
+	}
+
+	return &email, nil
+}
+
+// GetOutboxEmails retrieves outbox emails, newest first, optionally only those with a status
+func GetOutboxEmails(db Querier, status string, limit int) ([]OutboxEmail, error) {
+	query := `SELECT ` + outboxEmailColumns + ` FROM email_outbox WHERE ? = '' OR status = ? ORDER BY id DESC LIMIT ?`
+	return queryOutboxEmails(db, query, status, status, limit)
+}
+
+// GetDueOutboxEmails retrieves pending emails whose next attempt is due, oldest first
+func GetDueOutboxEmails(db Querier, limit int) ([]OutboxEmail, error) {
+	query := `SELECT ` + outboxEmailColumns + ` FROM email_outbox
+	WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP ORDER BY id LIMIT ?`
+	return queryOutboxEmails(db, query, limit)
+}
+
+func queryOutboxEmails(db Querier, query string, args ...interface{}) ([]OutboxEmail, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []OutboxEmail
+	for rows.Next() {
+		var email OutboxEmail
+		if err := scanOutboxEmail(rows, &email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+// EnqueueEmail adds an email to the outbox. Called inside a transaction, the email is only
+// seen by the sender once the transaction commits.
+func EnqueueEmail(db Querier, email *OutboxEmail) error {
+	result, err := db.Exec(`INSERT INTO email_outbox (kind, recipient, subject, text_body, html_body) VALUES (?, ?, ?, ?, ?)`,
+		email.Kind, email.Recipient, email.Subject, email.TextBody, email.HTMLBody)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	email.ID = int(id)
+	return nil
+}
+
+// MarkEmailSent records that an email was delivered to the mail server
+func MarkEmailSent(db Querier, id int) error {
+	_, err := db.Exec(`UPDATE email_outbox SET status = 'sent', attempts = attempts + 1, last_error = '',
+		sent_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	return err
+}
+
+// MarkEmailAttemptFailed records a failed attempt. The email is retried after delaySeconds,
+// or marked failed when giveUp is set.
+func MarkEmailAttemptFailed(db Querier, id int, reason string, delaySeconds int, giveUp bool) error {
+	status := EmailStatusPending
+	if giveUp {
+		status = EmailStatusFailed
+	}
+	_, err := db.Exec(`UPDATE email_outbox SET status = ?, attempts = attempts + 1, last_error = ?,
+		next_attempt_at = datetime('now', '+' || ? || ' seconds') WHERE id = ?`, status, reason, delaySeconds, id)
+	return err
+}
+
+// RetryEmail puts a failed email back in the queue to be sent now
+func RetryEmail(db Querier, id int) error {
+	result, err := db.Exec(`UPDATE email_outbox SET status = 'pending', next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = 'failed'`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := GetOutboxEmailByID(db, id); err != nil {
+			return err
+		}
+		return apperr.New(apperr.CodeConflict, "only failed emails can be retried")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Payment statuses
+const (
+	PaymentStatusAuthorized        = "authorized"
+	PaymentStatusCaptured          = "captured"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+	PaymentStatusVoided            = "voided"
+	PaymentStatusFailed            = "failed"
+)
+
+// Payment is an attempt to pay for an order through a payment provider
+type Payment struct {
+	ID             int
+	OrderID        int
+	Provider       string
+	Reference      string
+	Amount         float64
+	CapturedAmount float64
+	RefundedAmount float64
+	Status         string
+	FailureReason  string
+	CreatedAt      string
+	UpdatedAt      string
+}
+
+// Payment operations
+
+const paymentColumns = `id, order_id, provider, reference, amount, captured_amount, refunded_amount, status, failure_reason, created_at, updated_at`
+
+func scanPayment(row interface{ Scan(...interface{}) error }, payment *Payment) error {
+	return row.Scan(&payment.ID, &payment.OrderID, &payment.Provider, &payment.Reference, &payment.Amount, &payment.CapturedAmount,
+		&payment.RefundedAmount, &payment.Status, &payment.FailureReason, &payment.CreatedAt, &payment.UpdatedAt)
+}
+
+// GetPaymentByID retrieves a payment by ID
+func GetPaymentByID(db Querier, id int) (*Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE id = ?`
+
+	var payment Payment
+	err := scanPayment(db.QueryRow(query, id), &payment)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("payment")
+		}
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// GetPaymentsByOrderID retrieves all payment attempts of an order, oldest first
+func GetPaymentsByOrderID(db Querier, orderID int) ([]Payment, error) {
+	rows, err := db.Query(`SELECT `+paymentColumns+` FROM payments WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []Payment
+	for rows.Next() {
+		var payment Payment
+		if err := scanPayment(rows, &payment); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// CreatePayment records a payment attempt
+func CreatePayment(db Querier, payment *Payment) (*Payment, error) {
+	result, err := db.Exec(`INSERT INTO payments (order_id, provider, reference, amount, captured_amount, refunded_amount, status, failure_reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		payment.OrderID, payment.Provider, payment.Reference, payment.Amount, payment.CapturedAmount,
+		payment.RefundedAmount, payment.Status, payment.FailureReason)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return GetPaymentByID(db, int(id))
+}
+
+// UpdatePayment stores the amounts and status of a payment
+func UpdatePayment(db Querier, payment *Payment) error {
+	_, err := db.Exec(`UPDATE payments SET captured_amount = ?, refunded_amount = ?, status = ?, failure_reason = ?,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		payment.CapturedAmount, payment.RefundedAmount, payment.Status, payment.FailureReason, payment.ID)
+	return err
+}
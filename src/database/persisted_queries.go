@@ -0,0 +1,51 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"go-graphql-ecom/apperr"
+)
+
+// PersistedQuery is an operation registered ahead of time, which clients send by hash
+// instead of in full
+type PersistedQuery struct {
+	Hash      string
+	Name      string
+	Body      string
+	CreatedAt time.Time
+}
+
+// Persisted query operations
+
+// GetPersistedQuery retrieves a registered operation by the SHA-256 hash of its text
+func GetPersistedQuery(db Querier, hash string) (*PersistedQuery, error) {
+	var q PersistedQuery
+	err := db.QueryRow(`SELECT hash, name, body, created_at FROM persisted_queries WHERE hash = ?`, hash).
+		Scan(&q.Hash, &q.Name, &q.Body, &q.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("persisted query")
+		}
+		return nil, err
+	}
+	return &q, nil
+}
+
+// RegisterPersistedQueries stores operations, skipping those already registered, and
+// returns how many were new
+func RegisterPersistedQueries(db Querier, queries []PersistedQuery) (int, error) {
+	added := 0
+	now := time.Now().UTC()
+	for _, q := range queries {
+		result, err := db.Exec(`INSERT OR IGNORE INTO persisted_queries (hash, name, body, created_at) VALUES (?, ?, ?, ?)`,
+			q.Hash, q.Name, q.Body, now)
+		if err != nil {
+			return added, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,268 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Promotion types
+const (
+	PromotionTypeBuyXGetY    = "buy_x_get_y"
+	PromotionTypeTieredPrice = "tiered_price"
+	PromotionTypeBundle      = "bundle"
+)
+
+// DiscountSourcePromotion marks order discount lines created by automatic promotions
+const DiscountSourcePromotion = "promotion"
+
+// Promotion represents a rule that discounts order items automatically
+type Promotion struct {
+	ID          int
+	Name        string
+	Type        string
+	Active      bool
+	StartsAt    *time.Time
+	EndsAt      *time.Time
+	BuyQuantity int
+	GetQuantity int
+	BundlePrice float64
+	CreatedAt   string
+	Products    []PromotionProduct
+	Tiers       []PromotionTier
+}
+
+// PromotionProduct is a product a promotion applies to. For bundles, Quantity is the
+// number of units of the product in one bundle.
+type PromotionProduct struct {
+	ProductID int
+	Quantity  int
+}
+
+// PromotionTier is a volume price: buying at least MinQuantity units costs UnitPrice each
+type PromotionTier struct {
+	MinQuantity int
+	UnitPrice   float64
+}
+
+// AppliedPromotion records the discount a promotion gave an order item
+type AppliedPromotion struct {
+	ID          int
+	OrderID     int
+	OrderItemID int
+	PromotionID int
+	Description string
+	Discount    float64
+}
+
+// ActiveAt reports whether the promotion is enabled and inside its validity window
+func (p *Promotion) ActiveAt(now time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil && now.Before(*p.StartsAt) {
+		return false
+	}
+	if p.EndsAt != nil && !now.Before(*p.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// Promotion operations
+
+const promotionColumns = `id, name, type, active, starts_at, ends_at, buy_quantity, get_quantity, bundle_price, created_at`
+
+func scanPromotion(row interface{ Scan(...interface{}) error }, promotion *Promotion) error {
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(&promotion.ID, &promotion.Name, &promotion.Type, &promotion.Active, &startsAt, &endsAt,
+		&promotion.BuyQuantity, &promotion.GetQuantity, &promotion.BundlePrice, &promotion.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if startsAt.Valid {
+		promotion.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		promotion.EndsAt = &endsAt.Time
+	}
+	return nil
+}
+
+// loadPromotionRules fills in the products and tiers of a promotion
+func loadPromotionRules(db Querier, promotion *Promotion) error {
+	rows, err := db.Query(`SELECT product_id, quantity FROM promotion_products WHERE promotion_id = ? ORDER BY product_id`, promotion.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var product PromotionProduct
+		if err := rows.Scan(&product.ProductID, &product.Quantity); err != nil {
+			return err
+		}
+		promotion.Products = append(promotion.Products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Query(`SELECT min_quantity, unit_price FROM promotion_tiers WHERE promotion_id = ? ORDER BY min_quantity`, promotion.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tier PromotionTier
+		if err := rows.Scan(&tier.MinQuantity, &tier.UnitPrice); err != nil {
+			return err
+		}
+		promotion.Tiers = append(promotion.Tiers, tier)
+	}
+	return rows.Err()
+}
+
+func queryPromotions(db Querier, query string, args ...interface{}) ([]Promotion, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promotions []Promotion
+	for rows.Next() {
+		var promotion Promotion
+		if err := scanPromotion(rows, &promotion); err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range promotions {
+		if err := loadPromotionRules(db, &promotions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return promotions, nil
+}
+
+// GetPromotionByID retrieves a promotion by ID
+func GetPromotionByID(db Querier, id int) (*Promotion, error) {
+	query := `SELECT ` + promotionColumns + ` FROM promotions WHERE id = ?`
+
+	var promotion Promotion
+	err := scanPromotion(db.QueryRow(query, id), &promotion)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("promotion")
+		}
+		return nil, err
+	}
+
+	if err := loadPromotionRules(db, &promotion); err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// GetAllPromotions retrieves all promotions
+func GetAllPromotions(db *sql.DB) ([]Promotion, error) {
+	return queryPromotions(db, `SELECT `+promotionColumns+` FROM promotions ORDER BY id`)
+}
+
+// GetActivePromotions retrieves the enabled promotions; validity windows are checked by the caller
+func GetActivePromotions(db Querier) ([]Promotion, error) {
+	return queryPromotions(db, `SELECT `+promotionColumns+` FROM promotions WHERE active = 1 ORDER BY id`)
+}
+
+// CreatePromotion creates a promotion together with its products and tiers
+func CreatePromotion(db *sql.DB, promotion *Promotion) (*Promotion, error) {
+	var id int64
+	err := WithTx(db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO promotions (name, type, active, starts_at, ends_at, buy_quantity, get_quantity, bundle_price)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			promotion.Name, promotion.Type, promotion.Active, promotion.StartsAt, promotion.EndsAt,
+			promotion.BuyQuantity, promotion.GetQuantity, promotion.BundlePrice)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		for _, product := range promotion.Products {
+			if _, err := GetProductByID(tx, product.ProductID); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO promotion_products (promotion_id, product_id, quantity) VALUES (?, ?, ?)`,
+				id, product.ProductID, product.Quantity)
+			if err != nil {
+				return err
+			}
+		}
+		for _, tier := range promotion.Tiers {
+			_, err := tx.Exec(`INSERT INTO promotion_tiers (promotion_id, min_quantity, unit_price) VALUES (?, ?, ?)`,
+				id, tier.MinQuantity, tier.UnitPrice)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetPromotionByID(db, int(id))
+}
+
+// SetPromotionActive enables or disables a promotion
+func SetPromotionActive(db *sql.DB, id int, active bool) (*Promotion, error) {
+	if _, err := db.Exec(`UPDATE promotions SET active = ? WHERE id = ?`, active, id); err != nil {
+		return nil, err
+	}
+	return GetPromotionByID(db, id)
+}
+
+// AppliedPromotion operations
+
+// GetAppliedPromotionsByOrderItemID retrieves the promotions applied to an order item
+func GetAppliedPromotionsByOrderItemID(db Querier, orderItemID int) ([]AppliedPromotion, error) {
+	rows, err := db.Query(`SELECT id, order_id, order_item_id, promotion_id, description, discount
+		FROM order_item_promotions WHERE order_item_id = ? ORDER BY id`, orderItemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []AppliedPromotion
+	for rows.Next() {
+		var a AppliedPromotion
+		if err := rows.Scan(&a.ID, &a.OrderID, &a.OrderItemID, &a.PromotionID, &a.Description, &a.Discount); err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// ReplaceAppliedPromotions replaces the promotions recorded on the items of an order
+func ReplaceAppliedPromotions(db Querier, orderID int, applied []AppliedPromotion) error {
+	if _, err := db.Exec(`DELETE FROM order_item_promotions WHERE order_id = ?`, orderID); err != nil {
+		return err
+	}
+	for _, a := range applied {
+		_, err := db.Exec(`INSERT INTO order_item_promotions (order_id, order_item_id, promotion_id, description, discount) VALUES (?, ?, ?, ?, ?)`,
+			orderID, a.OrderItemID, a.PromotionID, a.Description, a.Discount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Return statuses
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+)
+
+// Return is a customer's request to send back items of an order
+type Return struct {
+	ID           int
+	OrderID      int
+	Status       string
+	Reason       string
+	Note         string
+	RefundAmount float64
+	CreatedAt    string
+	UpdatedAt    string
+	Items        []ReturnItem
+}
+
+// ReturnItem is the quantity of an order item being returned
+type ReturnItem struct {
+	ID          int
+	ReturnID    int
+	OrderItemID int
+	Quantity    int
+}
+
+// Return operations
+
+const returnColumns = `id, order_id, status, reason, note, refund_amount, created_at, updated_at`
+
+func scanReturn(row interface{ Scan(...interface{}) error }, ret *Return) error {
+	return row.Scan(&ret.ID, &ret.OrderID, &ret.Status, &ret.Reason, &ret.Note, &ret.RefundAmount, &ret.CreatedAt, &ret.UpdatedAt)
+}
+
+// loadReturnItems fills in the items of a return
+func loadReturnItems(db Querier, ret *Return) error {
+	rows, err := db.Query(`SELECT id, return_id, order_item_id, quantity FROM return_items WHERE return_id = ? ORDER BY id`, ret.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item ReturnItem
+		if err := rows.Scan(&item.ID, &item.ReturnID, &item.OrderItemID, &item.Quantity); err != nil {
+			return err
+		}
+		ret.Items = append(ret.Items, item)
+	}
+	return rows.Err()
+}
+
+func queryReturns(db Querier, query string, args ...interface{}) ([]Return, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var returns []Return
+	for rows.Next() {
+		var ret Return
+		if err := scanReturn(rows, &ret); err != nil {
+			return nil, err
+		}
+		returns = append(returns, ret)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range returns {
+		if err := loadReturnItems(db, &returns[i]); err != nil {
+			return nil, err
+		}
+	}
+	return returns, nil
+}
+
+// GetReturnByID retrieves a return with its items
+func GetReturnByID(db Querier, id int) (*Return, error) {
+	query := `SELECT ` + returnColumns + ` FROM returns WHERE id = ?`
+
+	var ret Return
+	err := scanReturn(db.QueryRow(query, id), &ret)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("return")
+		}
+		return nil, err
+	}
+
+	if err := loadReturnItems(db, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetReturnsByOrderID retrieves the returns of an order
+func GetReturnsByOrderID(db Querier, orderID int) ([]Return, error) {
+	return queryReturns(db, `SELECT `+returnColumns+` FROM returns WHERE order_id = ? ORDER BY id`, orderID)
+}
+
+// GetReturns retrieves all returns, optionally only those with the given status
+func GetReturns(db Querier, status string) ([]Return, error) {
+	if status == "" {
+		return queryReturns(db, `SELECT `+returnColumns+` FROM returns ORDER BY id`)
+	}
+	return queryReturns(db, `SELECT `+returnColumns+` FROM returns WHERE status = ? ORDER BY id`, status)
+}
+
+// GetReturnedQuantities returns how many units of each item of an order are in returns
+// that have not been rejected
+func GetReturnedQuantities(db Querier, orderID int) (map[int]int, error) {
+	rows, err := db.Query(`
+	SELECT ri.order_item_id, SUM(ri.quantity)
+	FROM return_items ri
+	JOIN returns r ON r.id = ri.return_id
+	WHERE r.order_id = ? AND r.status != ?
+	GROUP BY ri.order_item_id`, orderID, ReturnStatusRejected)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	returned := make(map[int]int)
+	for rows.Next() {
+		var itemID, quantity int
+		if err := rows.Scan(&itemID, &quantity); err != nil {
+			return nil, err
+		}
+		returned[itemID] = quantity
+	}
+	return returned, rows.Err()
+}
+
+// CreateReturn records a return request and its items. Callers validate the quantities.
+func CreateReturn(db Querier, ret *Return) (int, error) {
+	result, err := db.Exec(`INSERT INTO returns (order_id, status, reason) VALUES (?, ?, ?)`,
+		ret.OrderID, ReturnStatusRequested, ret.Reason)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range ret.Items {
+		_, err := db.Exec(`INSERT INTO return_items (return_id, order_item_id, quantity) VALUES (?, ?, ?)`,
+			id, item.OrderItemID, item.Quantity)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(id), nil
+}
+
+// UpdateReturn stores the status, note and refund of a return
+func UpdateReturn(db Querier, ret *Return) error {
+	_, err := db.Exec(`UPDATE returns SET status = ?, note = ?, refund_amount = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		ret.Status, ret.Note, ret.RefundAmount, ret.ID)
+	return err
+}
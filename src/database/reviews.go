@@ -0,0 +1,197 @@
+package database
+
+import (
+	"database/sql"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Review represents a customer's review of a product
+type Review struct {
+	ID        int
+	ProductID int
+	UserID    int
+	Rating    int
+	Title     string
+	Body      string
+	CreatedAt string
+	UpdatedAt string
+}
+
+// ErrReviewNotAllowed is returned when a user has not received the product they try to review
+var ErrReviewNotAllowed = apperr.New(apperr.CodeForbidden, "only customers with a delivered order containing this product can review it")
+
+// ErrAlreadyReviewed is returned when a user reviews the same product twice
+var ErrAlreadyReviewed = apperr.New(apperr.CodeConflict, "user has already reviewed this product")
+
+const reviewColumns = `id, product_id, user_id, rating, title, body, created_at, updated_at`
+
+func scanReview(row interface{ Scan(...interface{}) error }, review *Review) error {
+	return row.Scan(&review.ID, &review.ProductID, &review.UserID, &review.Rating, &review.Title, &review.Body, &review.CreatedAt, &review.UpdatedAt)
+}
+
+// GetReviewByID retrieves a review by ID
+func GetReviewByID(db Querier, id int) (*Review, error) {
+	query := `SELECT ` + reviewColumns + ` FROM reviews WHERE id = ?`
+
+	var review Review
+	err := scanReview(db.QueryRow(query, id), &review)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("review")
+		}
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// GetReviewsByProductID retrieves a page of reviews for a product, newest first
+func GetReviewsByProductID(db *sql.DB, productID, limit, offset int) ([]Review, error) {
+	query := `SELECT ` + reviewColumns + ` FROM reviews WHERE product_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := db.Query(query, productID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []Review
+	for rows.Next() {
+		var review Review
+		if err := scanReview(rows, &review); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, rows.Err()
+}
+
+// HasDeliveredProduct reports whether the user has a delivered order containing the product
+func HasDeliveredProduct(db Querier, userID, productID int) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM orders o
+		JOIN order_items oi ON oi.order_id = o.id
+		WHERE o.user_id = ? AND oi.product_id = ? AND o.status = ?
+	)`
+
+	var exists bool
+	err := db.QueryRow(query, userID, productID, OrderStatusDelivered).Scan(&exists)
+	return exists, err
+}
+
+// CreateReview adds a review and refreshes the product's rating summary in one transaction
+func CreateReview(db *sql.DB, userID, productID, rating int, title, body string) (*Review, error) {
+	var review *Review
+	err := WithTx(db, func(tx *sql.Tx) error {
+		if _, err := GetProductByID(tx, productID); err != nil {
+			return err
+		}
+
+		allowed, err := HasDeliveredProduct(tx, userID, productID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrReviewNotAllowed
+		}
+
+		var exists bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM reviews WHERE user_id = ? AND product_id = ?)`, userID, productID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrAlreadyReviewed
+		}
+
+		result, err := tx.Exec(`INSERT INTO reviews (product_id, user_id, rating, title, body) VALUES (?, ?, ?, ?, ?)`,
+			productID, userID, rating, title, body)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		if err := refreshProductRating(tx, productID); err != nil {
+			return err
+		}
+
+		review, err = GetReviewByID(tx, int(id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+// UpdateReview changes the given fields of a review; nil values are left untouched
+func UpdateReview(db *sql.DB, id int, rating *int, title, body *string) (*Review, error) {
+	var review *Review
+	err := WithTx(db, func(tx *sql.Tx) error {
+		existing, err := GetReviewByID(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if rating != nil {
+			existing.Rating = *rating
+		}
+		if title != nil {
+			existing.Title = *title
+		}
+		if body != nil {
+			existing.Body = *body
+		}
+
+		_, err = tx.Exec(`UPDATE reviews SET rating = ?, title = ?, body = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			existing.Rating, existing.Title, existing.Body, id)
+		if err != nil {
+			return err
+		}
+
+		if err := refreshProductRating(tx, existing.ProductID); err != nil {
+			return err
+		}
+
+		review, err = GetReviewByID(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+// DeleteReview removes a review and refreshes the product's rating summary
+func DeleteReview(db *sql.DB, id int) error {
+	return WithTx(db, func(tx *sql.Tx) error {
+		review, err := GetReviewByID(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM reviews WHERE id = ?`, id); err != nil {
+			return err
+		}
+
+		return refreshProductRating(tx, review.ProductID)
+	})
+}
+
+// refreshProductRating recomputes the denormalized average rating and review count of a product
+func refreshProductRating(tx *sql.Tx, productID int) error {
+	_, err := tx.Exec(`
+	UPDATE products SET
+		average_rating = (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE product_id = ?),
+		review_count = (SELECT COUNT(*) FROM reviews WHERE product_id = ?)
+	WHERE id = ?`, productID, productID, productID)
+	return err
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Session operations
+
+// CreateSession stores a login session identified by the hash of its token
+func CreateSession(db Querier, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(`INSERT INTO sessions (user_id, token_hash, expires_at) VALUES (?, ?, ?)`,
+		userID, tokenHash, expiresAt.UTC())
+	return err
+}
+
+// GetSessionUser retrieves the user of a session that has not expired
+func GetSessionUser(db Querier, tokenHash string) (*User, error) {
+	var userID int
+	err := db.QueryRow(`SELECT user_id FROM sessions WHERE token_hash = ? AND expires_at > ?`,
+		tokenHash, time.Now().UTC()).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("session")
+		}
+		return nil, err
+	}
+	return GetUserByID(db, userID)
+}
+
+// DeleteUserSessions ends every session of a user
+func DeleteUserSessions(db Querier, userID int) error {
+	_, err := db.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+	return err
+}
+
+// DeleteOtherSessions ends every session of a user except the one with keepTokenHash
+func DeleteOtherSessions(db Querier, userID int, keepTokenHash string) error {
+	_, err := db.Exec(`DELETE FROM sessions WHERE user_id = ? AND token_hash != ?`, userID, keepTokenHash)
+	return err
+}
+
+// DeleteSession ends a session
+func DeleteSession(db Querier, tokenHash string) error {
+	_, err := db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
+	return err
+}
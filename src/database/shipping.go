@@ -0,0 +1,285 @@
+package database
+
+import (
+	"database/sql"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Shipping method types
+const (
+	ShippingMethodFlatRate          = "flat_rate"
+	ShippingMethodWeightBased       = "weight_based"
+	ShippingMethodFreeOverThreshold = "free_over_threshold"
+)
+
+// Shipment statuses
+const (
+	ShipmentStatusShipped   = "shipped"
+	ShipmentStatusDelivered = "delivered"
+)
+
+// ShippingMethod is a way of shipping an order and how it is priced. BaseRate is the flat
+// price, or the handling fee of weight-based methods which add RatePerKg per kilogram.
+// Free-over-threshold methods cost BaseRate unless the order is worth at least FreeThreshold.
+type ShippingMethod struct {
+	ID            int
+	Name          string
+	Type          string
+	Carrier       string
+	BaseRate      float64
+	RatePerKg     float64
+	FreeThreshold float64
+	Active        bool
+	CreatedAt     string
+}
+
+// Shipment is a parcel sent for an order. An order can be shipped in several parcels.
+type Shipment struct {
+	ID             int
+	OrderID        int
+	Carrier        string
+	TrackingNumber string
+	Status         string
+	ShippedAt      string
+	DeliveredAt    *string
+	Items          []ShipmentItem
+}
+
+// ShipmentItem is the quantity of an order item sent in a shipment
+type ShipmentItem struct {
+	ID          int
+	ShipmentID  int
+	OrderItemID int
+	Quantity    int
+}
+
+// ShippingMethod operations
+
+const shippingMethodColumns = `id, name, type, carrier, base_rate, rate_per_kg, free_threshold, active, created_at`
+
+func scanShippingMethod(row interface{ Scan(...interface{}) error }, method *ShippingMethod) error {
+	return row.Scan(&method.ID, &method.Name, &method.Type, &method.Carrier, &method.BaseRate, &method.RatePerKg,
+		&method.FreeThreshold, &method.Active, &method.CreatedAt)
+}
+
+// GetShippingMethodByID retrieves a shipping method by ID
+func GetShippingMethodByID(db Querier, id int) (*ShippingMethod, error) {
+	query := `SELECT ` + shippingMethodColumns + ` FROM shipping_methods WHERE id = ?`
+
+	var method ShippingMethod
+	err := scanShippingMethod(db.QueryRow(query, id), &method)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("shipping method")
+		}
+		return nil, err
+	}
+
+	return &method, nil
+}
+
+func queryShippingMethods(db Querier, query string) ([]ShippingMethod, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var methods []ShippingMethod
+	for rows.Next() {
+		var method ShippingMethod
+		if err := scanShippingMethod(rows, &method); err != nil {
+			return nil, err
+		}
+		methods = append(methods, method)
+	}
+	return methods, rows.Err()
+}
+
+// GetAllShippingMethods retrieves all shipping methods
+func GetAllShippingMethods(db Querier) ([]ShippingMethod, error) {
+	return queryShippingMethods(db, `SELECT `+shippingMethodColumns+` FROM shipping_methods ORDER BY id`)
+}
+
+// GetActiveShippingMethods retrieves the shipping methods customers can choose from
+func GetActiveShippingMethods(db Querier) ([]ShippingMethod, error) {
+	return queryShippingMethods(db, `SELECT `+shippingMethodColumns+` FROM shipping_methods WHERE active = 1 ORDER BY id`)
+}
+
+// CreateShippingMethod creates a shipping method
+func CreateShippingMethod(db *sql.DB, method *ShippingMethod) (*ShippingMethod, error) {
+	result, err := db.Exec(`INSERT INTO shipping_methods (name, type, carrier, base_rate, rate_per_kg, free_threshold, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		method.Name, method.Type, method.Carrier, method.BaseRate, method.RatePerKg, method.FreeThreshold, method.Active)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return GetShippingMethodByID(db, int(id))
+}
+
+// SetShippingMethodActive enables or disables a shipping method
+func SetShippingMethodActive(db *sql.DB, id int, active bool) (*ShippingMethod, error) {
+	if _, err := db.Exec(`UPDATE shipping_methods SET active = ? WHERE id = ?`, active, id); err != nil {
+		return nil, err
+	}
+	return GetShippingMethodByID(db, id)
+}
+
+// SetOrderShippingMethod records the shipping method chosen for an order
+func SetOrderShippingMethod(db Querier, orderID, methodID int) error {
+	_, err := db.Exec(`UPDATE orders SET shipping_method_id = ? WHERE id = ?`, methodID, orderID)
+	return err
+}
+
+// SetProductDimensions stores the weight (kg) and dimensions (cm) of a product used for shipping rates
+func SetProductDimensions(db *sql.DB, productID int, weight, length, width, height float64) (*Product, error) {
+	_, err := db.Exec(`UPDATE products SET weight = ?, length = ?, width = ?, height = ? WHERE id = ?`,
+		weight, length, width, height, productID)
+	if err != nil {
+		return nil, err
+	}
+	return GetProductByID(db, productID)
+}
+
+// Shipment operations
+
+const shipmentColumns = `id, order_id, carrier, tracking_number, status, shipped_at, delivered_at`
+
+func scanShipment(row interface{ Scan(...interface{}) error }, shipment *Shipment) error {
+	var deliveredAt sql.NullString
+	err := row.Scan(&shipment.ID, &shipment.OrderID, &shipment.Carrier, &shipment.TrackingNumber, &shipment.Status,
+		&shipment.ShippedAt, &deliveredAt)
+	if err != nil {
+		return err
+	}
+	if deliveredAt.Valid {
+		shipment.DeliveredAt = &deliveredAt.String
+	}
+	return nil
+}
+
+// loadShipmentItems fills in the items of a shipment
+func loadShipmentItems(db Querier, shipment *Shipment) error {
+	rows, err := db.Query(`SELECT id, shipment_id, order_item_id, quantity FROM shipment_items WHERE shipment_id = ? ORDER BY id`, shipment.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item ShipmentItem
+		if err := rows.Scan(&item.ID, &item.ShipmentID, &item.OrderItemID, &item.Quantity); err != nil {
+			return err
+		}
+		shipment.Items = append(shipment.Items, item)
+	}
+	return rows.Err()
+}
+
+// GetShipmentByID retrieves a shipment with its items
+func GetShipmentByID(db Querier, id int) (*Shipment, error) {
+	query := `SELECT ` + shipmentColumns + ` FROM shipments WHERE id = ?`
+
+	var shipment Shipment
+	err := scanShipment(db.QueryRow(query, id), &shipment)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("shipment")
+		}
+		return nil, err
+	}
+
+	if err := loadShipmentItems(db, &shipment); err != nil {
+		return nil, err
+	}
+	return &shipment, nil
+}
+
+// GetShipmentsByOrderID retrieves the shipments of an order with their items
+func GetShipmentsByOrderID(db Querier, orderID int) ([]Shipment, error) {
+	rows, err := db.Query(`SELECT `+shipmentColumns+` FROM shipments WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shipments []Shipment
+	for rows.Next() {
+		var shipment Shipment
+		if err := scanShipment(rows, &shipment); err != nil {
+			return nil, err
+		}
+		shipments = append(shipments, shipment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range shipments {
+		if err := loadShipmentItems(db, &shipments[i]); err != nil {
+			return nil, err
+		}
+	}
+	return shipments, nil
+}
+
+// GetShippedQuantities returns how many units of each item of an order have been shipped
+func GetShippedQuantities(db Querier, orderID int) (map[int]int, error) {
+	rows, err := db.Query(`
+	SELECT si.order_item_id, SUM(si.quantity)
+	FROM shipment_items si
+	JOIN shipments s ON s.id = si.shipment_id
+	WHERE s.order_id = ?
+	GROUP BY si.order_item_id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shipped := make(map[int]int)
+	for rows.Next() {
+		var itemID, quantity int
+		if err := rows.Scan(&itemID, &quantity); err != nil {
+			return nil, err
+		}
+		shipped[itemID] = quantity
+	}
+	return shipped, rows.Err()
+}
+
+// CreateShipment records a shipment and its items. Callers validate the quantities.
+func CreateShipment(db Querier, shipment *Shipment) (int, error) {
+	result, err := db.Exec(`INSERT INTO shipments (order_id, carrier, tracking_number, status) VALUES (?, ?, ?, ?)`,
+		shipment.OrderID, shipment.Carrier, shipment.TrackingNumber, ShipmentStatusShipped)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range shipment.Items {
+		_, err := db.Exec(`INSERT INTO shipment_items (shipment_id, order_item_id, quantity) VALUES (?, ?, ?)`,
+			id, item.OrderItemID, item.Quantity)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(id), nil
+}
+
+// MarkShipmentDelivered records that a shipment has arrived
+func MarkShipmentDelivered(db Querier, id int) error {
+	_, err := db.Exec(`UPDATE shipments SET status = ?, delivered_at = COALESCE(delivered_at, CURRENT_TIMESTAMP) WHERE id = ?`,
+		ShipmentStatusDelivered, id)
+	return err
+}
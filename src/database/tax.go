@@ -0,0 +1,118 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	"go-graphql-ecom/apperr"
+)
+
+// TaxClassStandard is the tax class of products that have no special treatment
+const TaxClassStandard = "standard"
+
+// TaxRate is the rate charged on a tax class in a country or region
+type TaxRate struct {
+	ID       int
+	Country  string
+	Region   string
+	TaxClass string
+	Name     string
+	Rate     float64
+}
+
+// TaxBreakdown sums the tax charged on an order per rate
+type TaxBreakdown struct {
+	Name          string
+	Rate          float64
+	TaxableAmount float64
+	Amount        float64
+}
+
+// TaxRate operations
+
+// GetAllTaxRates retrieves all tax rates
+func GetAllTaxRates(db Querier) ([]TaxRate, error) {
+	rows, err := db.Query(`SELECT id, country, region, tax_class, name, rate FROM tax_rates ORDER BY country, region, tax_class`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []TaxRate
+	for rows.Next() {
+		var rate TaxRate
+		if err := rows.Scan(&rate.ID, &rate.Country, &rate.Region, &rate.TaxClass, &rate.Name, &rate.Rate); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+// SetTaxRate creates or replaces the rate of a tax class in a country or region
+func SetTaxRate(db *sql.DB, rate *TaxRate) (*TaxRate, error) {
+	country := strings.ToUpper(strings.TrimSpace(rate.Country))
+	region := strings.ToUpper(strings.TrimSpace(rate.Region))
+	taxClass := rate.TaxClass
+	if taxClass == "" {
+		taxClass = TaxClassStandard
+	}
+
+	_, err := db.Exec(`INSERT INTO tax_rates (country, region, tax_class, name, rate) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (country, region, tax_class) DO UPDATE SET name = excluded.name, rate = excluded.rate`,
+		country, region, taxClass, rate.Name, rate.Rate)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved TaxRate
+	err = db.QueryRow(`SELECT id, country, region, tax_class, name, rate FROM tax_rates WHERE country = ? AND region = ? AND tax_class = ?`,
+		country, region, taxClass).Scan(&saved.ID, &saved.Country, &saved.Region, &saved.TaxClass, &saved.Name, &saved.Rate)
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// DeleteTaxRate removes a tax rate
+func DeleteTaxRate(db *sql.DB, id int) error {
+	result, err := db.Exec(`DELETE FROM tax_rates WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return apperr.NotFound("tax rate")
+	}
+	return nil
+}
+
+// UpdateOrderItemTax stores the tax calculated for an order item
+func UpdateOrderItemTax(db Querier, item *OrderItem) error {
+	_, err := db.Exec(`UPDATE order_items SET tax_base = ?, tax_rate = ?, tax_name = ?, tax_amount = ? WHERE id = ?`,
+		item.TaxBase, item.TaxRate, item.TaxName, item.TaxAmount, item.ID)
+	return err
+}
+
+// GetOrderTaxBreakdown sums the tax of an order's items per rate
+func GetOrderTaxBreakdown(db Querier, orderID int) ([]TaxBreakdown, error) {
+	rows, err := db.Query(`
+	SELECT tax_name, tax_rate, SUM(tax_base), SUM(tax_amount)
+	FROM order_items
+	WHERE order_id = ? AND tax_name != ''
+	GROUP BY tax_name, tax_rate
+	ORDER BY tax_rate DESC, tax_name`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var breakdown []TaxBreakdown
+	for rows.Next() {
+		var line TaxBreakdown
+		if err := rows.Scan(&line.Name, &line.Rate, &line.TaxableAmount, &line.Amount); err != nil {
+			return nil, err
+		}
+		breakdown = append(breakdown, line)
+	}
+	return breakdown, rows.Err()
+}
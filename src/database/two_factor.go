@@ -0,0 +1,85 @@
+package database
+
+// RecoveryCode is a hashed one-time code that can replace a TOTP code
+type RecoveryCode struct {
+	ID       int
+	UserID   int
+	CodeHash string
+}
+
+// Two-factor operations
+
+// SetPendingTOTPSecret stores a new TOTP secret that is not enforced until it is enabled
+func SetPendingTOTPSecret(db Querier, userID int, secret string) error {
+	_, err := db.Exec(`UPDATE users SET totp_secret = ?, totp_enabled = 0, totp_last_step = 0 WHERE id = ?`, secret, userID)
+	return err
+}
+
+// EnableTOTP starts requiring TOTP codes for a user
+func EnableTOTP(db Querier, userID int) error {
+	_, err := db.Exec(`UPDATE users SET totp_enabled = 1 WHERE id = ? AND totp_secret != ''`, userID)
+	return err
+}
+
+// DisableTOTP removes a user's TOTP secret and recovery codes
+func DisableTOTP(db Querier, userID int) error {
+	_, err := db.Exec(`UPDATE users SET totp_secret = '', totp_enabled = 0, totp_last_step = 0 WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	return err
+}
+
+// UseTOTPStep records the time step of an accepted code. It reports false if that step or
+// a later one was already used, so each code works only once.
+func UseTOTPStep(db Querier, userID int, step int64) (bool, error) {
+	result, err := db.Exec(`UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new hashes
+func ReplaceRecoveryCodes(db Querier, userID int, codeHashes []string) error {
+	if _, err := db.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := db.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUnusedRecoveryCodes retrieves the recovery codes a user has left
+func GetUnusedRecoveryCodes(db Querier, userID int) ([]RecoveryCode, error) {
+	rows, err := db.Query(`SELECT id, user_id, code_hash FROM recovery_codes WHERE user_id = ? AND used_at IS NULL ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []RecoveryCode
+	for rows.Next() {
+		var code RecoveryCode
+		if err := rows.Scan(&code.ID, &code.UserID, &code.CodeHash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// UseRecoveryCode marks a recovery code as used. It reports false if it already was.
+func UseRecoveryCode(db Querier, id int) (bool, error) {
+	result, err := db.Exec(`UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
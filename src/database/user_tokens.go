@@ -0,0 +1,46 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"go-graphql-ecom/apperr"
+)
+
+// User token purposes
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// User token operations
+
+// CreateUserToken stores a single-use token for a user, identified by its hash
+func CreateUserToken(db Querier, userID int, purpose, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(`INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES (?, ?, ?, ?)`,
+		userID, purpose, tokenHash, expiresAt.UTC())
+	return err
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns its user ID. A token
+// can only be consumed once, even by concurrent requests.
+func ConsumeUserToken(db Querier, purpose, tokenHash string) (int, error) {
+	var userID int
+	err := db.QueryRow(`UPDATE user_tokens SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id`, time.Now().UTC(), tokenHash, purpose, time.Now().UTC()).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, apperr.Invalid("token", "token is invalid or has expired")
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// InvalidateUserTokens marks all unused tokens of a user for a purpose as used
+func InvalidateUserTokens(db Querier, userID int, purpose string) error {
+	_, err := db.Exec(`UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL`,
+		time.Now().UTC(), userID, purpose)
+	return err
+}
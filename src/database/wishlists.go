@@ -0,0 +1,341 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+
+	"go-graphql-ecom/apperr"
+)
+
+// Wishlist represents a named list of products saved by a user
+type Wishlist struct {
+	ID         int
+	UserID     int
+	Name       string
+	ShareToken string
+	CreatedAt  string
+}
+
+// WishlistItem represents a product saved to a wishlist together with its price at the time
+type WishlistItem struct {
+	ID           int
+	WishlistID   int
+	ProductID    int
+	SavedPrice   float64
+	CurrentPrice float64
+	AddedAt      string
+}
+
+// PriceDrop returns how much cheaper the product is now than when it was saved
+func (i WishlistItem) PriceDrop() float64 {
+	if i.CurrentPrice < i.SavedPrice {
+		return i.SavedPrice - i.CurrentPrice
+	}
+	return 0
+}
+
+// Wishlist operations
+
+const wishlistColumns = `id, user_id, name, COALESCE(share_token, ''), created_at`
+
+func scanWishlist(row interface{ Scan(...interface{}) error }, wishlist *Wishlist) error {
+	return row.Scan(&wishlist.ID, &wishlist.UserID, &wishlist.Name, &wishlist.ShareToken, &wishlist.CreatedAt)
+}
+
+// GetWishlistByID retrieves a wishlist by ID
+func GetWishlistByID(db Querier, id int) (*Wishlist, error) {
+	query := `SELECT ` + wishlistColumns + ` FROM wishlists WHERE id = ?`
+
+	var wishlist Wishlist
+	err := scanWishlist(db.QueryRow(query, id), &wishlist)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("wishlist")
+		}
+		return nil, err
+	}
+
+	return &wishlist, nil
+}
+
+// GetWishlistByShareToken retrieves a shared wishlist by its public token
+func GetWishlistByShareToken(db *sql.DB, token string) (*Wishlist, error) {
+	query := `SELECT ` + wishlistColumns + ` FROM wishlists WHERE share_token = ?`
+
+	var wishlist Wishlist
+	err := scanWishlist(db.QueryRow(query, token), &wishlist)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("wishlist")
+		}
+		return nil, err
+	}
+
+	return &wishlist, nil
+}
+
+// GetWishlistsByUserID retrieves all wishlists of a user
+func GetWishlistsByUserID(db *sql.DB, userID int) ([]Wishlist, error) {
+	query := `SELECT ` + wishlistColumns + ` FROM wishlists WHERE user_id = ? ORDER BY id`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wishlists []Wishlist
+	for rows.Next() {
+		var wishlist Wishlist
+		if err := scanWishlist(rows, &wishlist); err != nil {
+			return nil, err
+		}
+		wishlists = append(wishlists, wishlist)
+	}
+
+	return wishlists, rows.Err()
+}
+
+// CreateWishlist creates a new named wishlist for a user
+func CreateWishlist(db *sql.DB, userID int, name string) (*Wishlist, error) {
+	if _, err := GetUserByID(db, userID); err != nil {
+		return nil, err
+	}
+
+	result, err := db.Exec(`INSERT INTO wishlists (user_id, name) VALUES (?, ?)`, userID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return GetWishlistByID(db, int(id))
+}
+
+// ShareWishlist assigns a public share token to a wishlist, keeping an existing one
+func ShareWishlist(db *sql.DB, id int) (*Wishlist, error) {
+	wishlist, err := GetWishlistByID(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if wishlist.ShareToken != "" {
+		return wishlist, nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`UPDATE wishlists SET share_token = ? WHERE id = ?`, token, id); err != nil {
+		return nil, err
+	}
+
+	return GetWishlistByID(db, id)
+}
+
+// UnshareWishlist revokes the public share token of a wishlist
+func UnshareWishlist(db *sql.DB, id int) (*Wishlist, error) {
+	if _, err := db.Exec(`UPDATE wishlists SET share_token = NULL WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return GetWishlistByID(db, id)
+}
+
+// WishlistItem operations
+
+const wishlistItemQuery = `
+	SELECT wi.id, wi.wishlist_id, wi.product_id, wi.saved_price, p.price, wi.added_at
+	FROM wishlist_items wi
+	JOIN products p ON p.id = wi.product_id`
+
+func scanWishlistItem(row interface{ Scan(...interface{}) error }, item *WishlistItem) error {
+	return row.Scan(&item.ID, &item.WishlistID, &item.ProductID, &item.SavedPrice, &item.CurrentPrice, &item.AddedAt)
+}
+
+func queryWishlistItems(db Querier, query string, args ...interface{}) ([]WishlistItem, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []WishlistItem
+	for rows.Next() {
+		var item WishlistItem
+		if err := scanWishlistItem(rows, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// GetWishlistItemByID retrieves a wishlist item by ID
+func GetWishlistItemByID(db Querier, id int) (*WishlistItem, error) {
+	var item WishlistItem
+	err := scanWishlistItem(db.QueryRow(wishlistItemQuery+` WHERE wi.id = ?`, id), &item)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperr.NotFound("wishlist item")
+		}
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// GetWishlistItemsByWishlistID retrieves all items of a wishlist
+func GetWishlistItemsByWishlistID(db *sql.DB, wishlistID int) ([]WishlistItem, error) {
+	return queryWishlistItems(db, wishlistItemQuery+` WHERE wi.wishlist_id = ? ORDER BY wi.id`, wishlistID)
+}
+
+// GetWishlistPriceDrops retrieves the items across a user's wishlists whose product
+// is now cheaper than when it was saved
+func GetWishlistPriceDrops(db *sql.DB, userID int) ([]WishlistItem, error) {
+	query := wishlistItemQuery + `
+	JOIN wishlists w ON w.id = wi.wishlist_id
+	WHERE w.user_id = ? AND p.price < wi.saved_price
+	ORDER BY (wi.saved_price - p.price) DESC`
+	return queryWishlistItems(db, query, userID)
+}
+
+// AddToWishlist saves a product to a wishlist at its current price.
+// Adding a product that is already on the list keeps the originally saved price.
+func AddToWishlist(db *sql.DB, wishlistID, productID int) (*WishlistItem, error) {
+	if _, err := GetWishlistByID(db, wishlistID); err != nil {
+		return nil, err
+	}
+	product, err := GetProductByID(db, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`INSERT INTO wishlist_items (wishlist_id, product_id, saved_price) VALUES (?, ?, ?)
+		ON CONFLICT (wishlist_id, product_id) DO NOTHING`, wishlistID, productID, product.Price)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = db.QueryRow(`SELECT id FROM wishlist_items WHERE wishlist_id = ? AND product_id = ?`, wishlistID, productID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetWishlistItemByID(db, id)
+}
+
+// RemoveFromWishlist deletes an item from a wishlist
+func RemoveFromWishlist(db *sql.DB, itemID int) error {
+	result, err := db.Exec(`DELETE FROM wishlist_items WHERE id = ?`, itemID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return apperr.NotFound("wishlist item")
+	}
+	return nil
+}
+
+// MoveWishlistItemToCart adds the product of a wishlist item to the owner's cart at the
+// current price and removes it from the wishlist, in one transaction.
+// Callers are expected to recalculate the cart totals afterwards.
+func MoveWishlistItemToCart(db *sql.DB, itemID, quantity int) (*Order, error) {
+	var cartID int
+	err := WithTx(db, func(tx *sql.Tx) error {
+		item, err := GetWishlistItemByID(tx, itemID)
+		if err != nil {
+			return err
+		}
+		wishlist, err := GetWishlistByID(tx, item.WishlistID)
+		if err != nil {
+			return err
+		}
+		product, err := GetProductByID(tx, item.ProductID)
+		if err != nil {
+			return err
+		}
+
+		cartID, err = getOrCreateCart(tx, wishlist.UserID)
+		if err != nil {
+			return err
+		}
+
+		var existing int
+		err = tx.QueryRow(`SELECT COALESCE(SUM(quantity), 0) FROM order_items WHERE order_id = ? AND product_id = ?`,
+			cartID, product.ID).Scan(&existing)
+		if err != nil {
+			return err
+		}
+		if product.Inventory < existing+quantity {
+			return apperr.InsufficientStock(product.ID, existing+quantity, product.Inventory)
+		}
+
+		if existing > 0 {
+			_, err = tx.Exec(`UPDATE order_items SET quantity = quantity + ?, price = ? WHERE order_id = ? AND product_id = ?`,
+				quantity, product.Price, cartID, product.ID)
+		} else {
+			_, err = tx.Exec(`INSERT INTO order_items (order_id, product_id, quantity, price) VALUES (?, ?, ?, ?)`,
+				cartID, product.ID, quantity, product.Price)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM wishlist_items WHERE id = ?`, itemID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetOrderByID(db, cartID)
+}
+
+// GetCartByUserID retrieves the open cart of a user, if any
+func GetCartByUserID(db *sql.DB, userID int) (*Order, error) {
+	var id int
+	err := db.QueryRow(`SELECT id FROM orders WHERE user_id = ? AND status = ? ORDER BY id DESC LIMIT 1`,
+		userID, OrderStatusCart).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return GetOrderByID(db, id)
+}
+
+// getOrCreateCart returns the ID of the user's open cart, creating an empty one if needed
+func getOrCreateCart(tx *sql.Tx, userID int) (int, error) {
+	var id int
+	err := tx.QueryRow(`SELECT id FROM orders WHERE user_id = ? AND status = ? ORDER BY id DESC LIMIT 1`,
+		userID, OrderStatusCart).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO orders (user_id, status, total) VALUES (?, ?, 0)`, userID, OrderStatusCart)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := result.LastInsertId()
+	return int(newID), err
+}
+
+// newToken returns a random, URL-safe token
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,175 @@
+// Package events is an in-process bus carrying changes to orders and stock to the
+// subscribers interested in them, such as GraphQL subscriptions. Changes are published once
+// the transaction that made them has committed (see database.AfterCommit).
+package events
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event kinds
+const (
+	OrderPlaced        = "order_placed"
+	OrderStatusChanged = "order_status_changed"
+	StockChanged       = "stock_changed"
+)
+
+const (
+	// subscriberBuffer is how many events a subscriber can fall behind by before it misses some
+	subscriberBuffer = 64
+	// historySize is how many recent events are kept for subscribers that resume
+	historySize = 1000
+)
+
+// Event is a change to an order or to a product's stock. IDs increase with every event
+// published, starting over when the process restarts; see Bus.Cursor for IDs that clients keep.
+type Event struct {
+	ID        uint64
+	Kind      string
+	Time      time.Time
+	OrderID   int
+	Status    string
+	ProductID int
+	Inventory int
+}
+
+// Bus delivers published events to subscribers, and keeps the most recent ones so a
+// subscriber that lost its connection can resume where it left off
+type Bus struct {
+	mu sync.Mutex
+	// epoch is when the bus was created; it tells its event IDs apart from those of earlier
+	// runs of the process
+	epoch       string
+	lastID      uint64
+	subscribers map[chan Event]map[string]bool
+	history     []Event
+	historySize int
+}
+
+// NewBus returns a bus without subscribers that keeps historySize recent events
+func NewBus(historySize int) *Bus {
+	return &Bus{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		subscribers: make(map[chan Event]map[string]bool),
+		historySize: historySize,
+	}
+}
+
+// Cursor turns an event ID into one a client can resume from later. It carries the bus's
+// epoch, since IDs start over when the process restarts.
+func (b *Bus) Cursor(id uint64) string {
+	return fmt.Sprintf("%s-%d", b.epoch, id)
+}
+
+// ParseCursor returns the event ID in a cursor made by Cursor. ok is false for cursors that
+// are malformed or come from another run of the process, whose IDs mean nothing here.
+func (b *Bus) ParseCursor(cursor string) (id uint64, ok bool) {
+	epoch, seq, found := strings.Cut(cursor, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(seq, 10, 64)
+	return id, err == nil
+}
+
+// Publish assigns the event an ID and time and sends it to the subscribers of its kind.
+// A subscriber that has fallen behind misses the event rather than holding up the publisher.
+func (b *Bus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	e.ID = b.lastID
+	e.Time = time.Now().UTC()
+	if b.historySize > 0 {
+		if len(b.history) == b.historySize {
+			b.history = append(b.history[:0], b.history[1:]...)
+		}
+		b.history = append(b.history, e)
+	}
+	for ch, kinds := range b.subscribers {
+		if !kinds[e.Kind] {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	return e
+}
+
+// Subscribe returns a channel of the events of the given kinds published from now on. The
+// channel is closed once ctx is done.
+func (b *Bus) Subscribe(ctx context.Context, kinds ...string) <-chan Event {
+	return b.subscribe(ctx, false, 0, kinds)
+}
+
+// SubscribeAfter is like Subscribe, but first delivers the recent events of the given kinds
+// published after the event with ID after. Events older than the history are lost.
+func (b *Bus) SubscribeAfter(ctx context.Context, after uint64, kinds ...string) <-chan Event {
+	return b.subscribe(ctx, true, after, kinds)
+}
+
+func (b *Bus) subscribe(ctx context.Context, replay bool, after uint64, kinds []string) <-chan Event {
+	set := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		set[kind] = true
+	}
+
+	b.mu.Lock()
+	var missed []Event
+	if replay {
+		for _, e := range b.history {
+			if e.ID > after && set[e.Kind] {
+				missed = append(missed, e)
+			}
+		}
+	}
+	ch := make(chan Event, subscriberBuffer+len(missed))
+	for _, e := range missed {
+		ch <- e
+	}
+	b.subscribers[ch] = set
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		close(ch)
+		b.mu.Unlock()
+	}()
+	return ch
+}
+
+var bus = NewBus(historySize)
+
+// Publish publishes an event on the shared bus
+func Publish(e Event) Event {
+	return bus.Publish(e)
+}
+
+// Subscribe subscribes to events on the shared bus
+func Subscribe(ctx context.Context, kinds ...string) <-chan Event {
+	return bus.Subscribe(ctx, kinds...)
+}
+
+// SubscribeAfter resumes a subscription to events on the shared bus
+func SubscribeAfter(ctx context.Context, after uint64, kinds ...string) <-chan Event {
+	return bus.SubscribeAfter(ctx, after, kinds...)
+}
+
+// Cursor turns the ID of an event on the shared bus into one a client can resume from
+func Cursor(id uint64) string {
+	return bus.Cursor(id)
+}
+
+// ParseCursor returns the ID of the event on the shared bus a cursor refers to
+func ParseCursor(cursor string) (uint64, bool) {
+	return bus.ParseCursor(cursor)
+}
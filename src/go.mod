@@ -7,6 +7,11 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.24
 )
 
-require github.com/graphql-go/graphql v0.8.1
+require (
+	github.com/graphql-go/graphql v0.8.1
+	golang.org/x/crypto v0.17.0
+)
+
+require github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 
-require github.com/gorilla/mux v1.8.1 // indirect
+require github.com/gorilla/websocket v1.5.3
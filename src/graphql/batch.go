@@ -0,0 +1,127 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// BatchLimits bounds the batches of operations Handler runs for a single request
+type BatchLimits struct {
+	// MaxSize is the most operations a batch may hold; zero allows any number
+	MaxSize int
+	// Workers is how many operations of a batch run at once
+	Workers int
+}
+
+var (
+	batchMu     sync.RWMutex
+	batchLimits = BatchLimits{MaxSize: 10, Workers: 4}
+)
+
+// SetBatchLimits sets the size and concurrency of batches
+func SetBatchLimits(limits BatchLimits) {
+	batchMu.Lock()
+	defer batchMu.Unlock()
+	batchLimits = limits
+}
+
+// GetBatchLimits returns the size and concurrency of batches
+func GetBatchLimits() BatchLimits {
+	batchMu.RLock()
+	defer batchMu.RUnlock()
+	return batchLimits
+}
+
+// isBatch reports whether a request body is a JSON array of operations
+func isBatch(body json.RawMessage) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+}
+
+// serveBatch runs a batch of operations and answers with an array of their results in the
+// same order. The batch's cost is charged to the rate limit as a whole. Queries run
+// concurrently on a bounded number of workers and share loaders. A mutation waits for the
+// operations before it and runs on its own, and the queries after it get fresh loaders, so
+// every operation sees what the mutations before it wrote. An operation that can't run, for
+// instance because it is too costly, gets a result with just the error.
+func serveBatch(w http.ResponseWriter, r *http.Request, batch []postData) {
+	limits := GetBatchLimits()
+	if len(batch) == 0 {
+		writeError(w, http.StatusBadRequest, "a batch must hold at least one operation")
+		return
+	}
+	if limits.MaxSize > 0 && len(batch) > limits.MaxSize {
+		writeErrorWithExtensions(w, http.StatusBadRequest,
+			fmt.Sprintf("batch of %d operations exceeds the limit of %d", len(batch), limits.MaxSize),
+			map[string]interface{}{"code": "BATCH_TOO_LARGE"})
+		return
+	}
+
+	results := make([]interface{}, len(batch))
+	analyses := make([]queryAnalysis, len(batch))
+	cost := 0
+	for i := range batch {
+		analysis, err := prepare(&batch[i], r.Method == http.MethodGet)
+		if err != nil {
+			results[i] = map[string]interface{}{"errors": err.formatted()}
+			continue
+		}
+		analyses[i] = analysis
+		cost = addCost(cost, analysis.Cost)
+	}
+	if !takeBudget(w, r, cost) {
+		return
+	}
+
+	var queries []int
+	runQueries := func() {
+		ctx := withLoaders(r.Context(), newLoaders())
+		runConcurrently(len(queries), limits.Workers, func(n int) {
+			i := queries[n]
+			results[i] = execute(ctx, batch[i], analyses[i])
+		})
+		queries = nil
+	}
+	for i := range batch {
+		switch {
+		case results[i] != nil:
+		case analyses[i].Mutation:
+			runQueries()
+			results[i] = execute(r.Context(), batch[i], analyses[i])
+		default:
+			queries = append(queries, i)
+		}
+	}
+	runQueries()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// runConcurrently calls run for 0 to n-1 on at most workers goroutines and waits for them
+func runConcurrently(n, workers int, run func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				run(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,98 @@
+package graphql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// cachePolicy is how long a response may be cached, and whether only by the client that
+// asked for it. The zero policy allows no caching.
+type cachePolicy struct {
+	// MaxAge is in seconds
+	MaxAge  int
+	Private bool
+	// unbounded is set on the policy of a field that places no limit of its own, such as a
+	// scalar field, which can be cached as long as its parent
+	unbounded bool
+}
+
+// cacheHints are the fields whose values may be cached, keyed by type and field name. Root
+// fields and fields returning objects need a hint to be cached at all; other fields take their
+// parent's. A response can be cached for as long as the shortest hint among its fields.
+var cacheHints = map[string]cachePolicy{
+	"RootQuery.products": {MaxAge: 60},
+	"RootQuery.product":  {MaxAge: 60},
+	"Product.inventory":  {MaxAge: 10},
+	"Product.images":     {MaxAge: 60},
+	"Product.reviews":    {MaxAge: 60},
+}
+
+// fieldCachePolicy returns the policy of a field given by its hint, or by its kind when it
+// has none
+func fieldCachePolicy(parent, field string, root, object bool) cachePolicy {
+	if hint, ok := cacheHints[parent+"."+field]; ok {
+		return hint
+	}
+	if root || object {
+		return cachePolicy{}
+	}
+	return cachePolicy{unbounded: true}
+}
+
+// restrict narrows a policy to what another one also allows
+func (p cachePolicy) restrict(other cachePolicy) cachePolicy {
+	if other.unbounded {
+		return p
+	}
+	if p.unbounded || other.MaxAge < p.MaxAge {
+		p.MaxAge = other.MaxAge
+	}
+	p.Private = p.Private || other.Private
+	p.unbounded = false
+	return p
+}
+
+// header returns the Cache-Control header for the policy
+func (p cachePolicy) header() string {
+	if p.unbounded || p.MaxAge <= 0 {
+		return "no-store"
+	}
+	scope := "public"
+	if p.Private {
+		scope = "private"
+	}
+	return fmt.Sprintf("%s, max-age=%d", scope, p.MaxAge)
+}
+
+// writeCacheable writes the response to a GET request with caching headers for its policy.
+// A cacheable response gets an ETag of its body, and a request whose If-None-Match header
+// has that tag gets 304 Not Modified without the body.
+func writeCacheable(w http.ResponseWriter, r *http.Request, body []byte, policy cachePolicy) {
+	w.Header().Set("Cache-Control", policy.header())
+	if policy.header() != "no-store" {
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// etagMatches reports whether an If-None-Match header lists a tag, comparing weakly as the
+// header requires
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package graphql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Query cost and depth estimation. Each field costs one point plus the cost of its selections; the
+// selections of a list field are counted once per item it is expected to return, which is
+// its first argument or defaultListSize when it has none.
+const (
+	defaultListSize = 10
+	// mutationFieldCost is charged for each root mutation field on top of its selections,
+	// since mutations write to the database
+	mutationFieldCost = 10
+	// maxCost caps estimates, so huge list sizes can't overflow them. A query reaching it is
+	// over any sensible limit anyway.
+	maxCost = math.MaxInt32
+)
+
+// QueryLimits bounds the queries Handler runs. A zero limit is not enforced.
+type QueryLimits struct {
+	MaxDepth int
+	MaxCost  int
+}
+
+var (
+	limitsMu    sync.RWMutex
+	queryLimits = QueryLimits{MaxDepth: 10, MaxCost: 1000}
+)
+
+// SetQueryLimits sets the depth and cost limits for queries
+func SetQueryLimits(limits QueryLimits) {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	queryLimits = limits
+}
+
+// GetQueryLimits returns the depth and cost limits for queries
+func GetQueryLimits() QueryLimits {
+	limitsMu.RLock()
+	defer limitsMu.RUnlock()
+	return queryLimits
+}
+
+// check returns an error message and code if an analyzed query is over a limit
+func (l QueryLimits) check(a queryAnalysis) (string, string) {
+	if l.MaxDepth > 0 && a.Depth > l.MaxDepth {
+		return fmt.Sprintf("query depth %d exceeds the limit of %d", a.Depth, l.MaxDepth), "QUERY_TOO_DEEP"
+	}
+	if l.MaxCost > 0 && a.Cost > l.MaxCost {
+		return fmt.Sprintf("query cost %d exceeds the limit of %d; request fewer items with first arguments",
+			a.Cost, l.MaxCost), "QUERY_TOO_COMPLEX"
+	}
+	return "", ""
+}
+
+// costExtension reports an analyzed query and the limits in response extensions
+func costExtension(a queryAnalysis, l QueryLimits) map[string]interface{} {
+	return map[string]interface{}{
+		"requestedQueryCost": a.Cost,
+		"maxQueryCost":       l.MaxCost,
+		"depth":              a.Depth,
+		"maxDepth":           l.MaxDepth,
+	}
+}
+
+// queryAnalysis is what static analysis found out about an operation before running it
+type queryAnalysis struct {
+	// Cost is the estimated number of fields resolved
+	Cost int
+	// Depth is the deepest nesting of fields, counting root fields as depth 1
+	Depth int
+	// Cache is how long the result may be cached, going by the cache hints of its fields
+	Cache cachePolicy
+	// Mutation is set for mutation operations
+	Mutation bool
+}
+
+// analyzeQuery estimates the cost and depth of an operation of a parsed document and works out
+// how long its result may be cached. Documents
+// without a matching operation cost one point; execution reports the error.
+func analyzeQuery(doc *ast.Document, operationName string, variables map[string]interface{}) queryAnalysis {
+	a := queryAnalyzer{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+	}
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operation = def
+			}
+		case *ast.FragmentDefinition:
+			a.fragments[def.Name.Value] = def
+		}
+	}
+	if operation == nil {
+		return queryAnalysis{Cost: 1}
+	}
+
+	root := Schema.QueryType()
+	switch operation.Operation {
+	case ast.OperationTypeMutation:
+		root = Schema.MutationType()
+		a.rootFieldCost = mutationFieldCost
+	case ast.OperationTypeSubscription:
+		// A subscription costs what one of its events does
+		root = Schema.SubscriptionType()
+	}
+	result := a.selectionSet(root, operation.SelectionSet, true, map[string]bool{})
+	if result.Cost < 1 {
+		result.Cost = 1
+	}
+	result.Mutation = operation.Operation == ast.OperationTypeMutation
+	return result
+}
+
+type queryAnalyzer struct {
+	fragments     map[string]*ast.FragmentDefinition
+	variables     map[string]interface{}
+	rootFieldCost int
+}
+
+// selectionSet analyzes the selections on a type. visiting holds the fragments being expanded
+// so a fragment that spreads itself is counted only once.
+func (a *queryAnalyzer) selectionSet(parent graphql.Type, set *ast.SelectionSet, root bool, visiting map[string]bool) queryAnalysis {
+	result := queryAnalysis{Cache: cachePolicy{unbounded: true}}
+	if set == nil {
+		return result
+	}
+	add := func(selection queryAnalysis) {
+		result.Cost = addCost(result.Cost, selection.Cost)
+		if selection.Depth > result.Depth {
+			result.Depth = selection.Depth
+		}
+		result.Cache = result.Cache.restrict(selection.Cache)
+	}
+	fields := fieldsOf(parent)
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			field := a.field(parent, fields[selection.Name.Value], selection, root, visiting)
+			if root {
+				field.Cost = addCost(field.Cost, a.rootFieldCost)
+			}
+			add(field)
+		case *ast.InlineFragment:
+			typ := parent
+			if selection.TypeCondition != nil {
+				typ = Schema.Type(selection.TypeCondition.Name.Value)
+			}
+			add(a.selectionSet(typ, selection.SelectionSet, root, visiting))
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := a.fragments[name]
+			if !ok || visiting[name] {
+				continue
+			}
+			visiting[name] = true
+			add(a.selectionSet(Schema.Type(fragment.TypeCondition.Name.Value), fragment.SelectionSet, root, visiting))
+			delete(visiting, name)
+		}
+	}
+	return result
+}
+
+// field analyzes a field of a parent type and its selections. def is nil for fields the
+// schema doesn't have, such as __typename and the introspection fields; those cost one point,
+// their selections aren't counted, and only __typename can be cached.
+func (a *queryAnalyzer) field(parent graphql.Type, def *graphql.FieldDefinition, field *ast.Field, root bool, visiting map[string]bool) queryAnalysis {
+	if def == nil {
+		return queryAnalysis{Cost: 1, Depth: 1, Cache: cachePolicy{unbounded: field.SelectionSet == nil}}
+	}
+	named, _ := graphql.GetNamed(def.Type).(graphql.Type)
+	children := a.selectionSet(named, field.SelectionSet, false, visiting)
+	if isListType(def.Type) {
+		children.Cost = multiplyCost(children.Cost, a.listSize(def, field))
+	}
+	cache := fieldCachePolicy(parent.Name(), def.Name, root, fieldsOf(named) != nil)
+	return queryAnalysis{
+		Cost:  addCost(1, children.Cost),
+		Depth: 1 + children.Depth,
+		Cache: cache.restrict(children.Cache),
+	}
+}
+
+// listSize is the number of items a list field is expected to return
+func (a *queryAnalyzer) listSize(def *graphql.FieldDefinition, field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			// A literal too large to parse is out of range as well
+			n, err := strconv.ParseFloat(value.Value, 64)
+			if err != nil {
+				return maxCost
+			}
+			return clampListSize(n)
+		case *ast.Variable:
+			switch n := a.variables[value.Name.Value].(type) {
+			case float64:
+				return clampListSize(n)
+			case int:
+				return clampListSize(float64(n))
+			}
+		}
+	}
+	for _, arg := range def.Args {
+		if n, ok := arg.DefaultValue.(int); ok && arg.Name() == "first" {
+			return clampListSize(float64(n))
+		}
+	}
+	return defaultListSize
+}
+
+// fieldsOf returns the fields of an object or interface type, or nil for other types
+func fieldsOf(t interface{}) graphql.FieldDefinitionMap {
+	switch t := t.(type) {
+	case *graphql.Object:
+		return t.Fields()
+	case *graphql.Interface:
+		return t.Fields()
+	}
+	return nil
+}
+
+func isListType(t graphql.Type) bool {
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		t = nonNull.OfType
+	}
+	_, ok := t.(*graphql.List)
+	return ok
+}
+
+// clampListSize turns a requested list size into a count between 0 and maxCost
+func clampListSize(n float64) int {
+	switch {
+	case n < 0:
+		return 0
+	case n > maxCost:
+		return maxCost
+	}
+	return int(n)
+}
+
+// addCost adds two costs, stopping at maxCost
+func addCost(a, b int) int {
+	if a > maxCost-b {
+		return maxCost
+	}
+	return a + b
+}
+
+// multiplyCost multiplies two costs, stopping at maxCost
+func multiplyCost(a, b int) int {
+	if a != 0 && b > maxCost/a {
+		return maxCost
+	}
+	return a * b
+}
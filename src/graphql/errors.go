@@ -0,0 +1,59 @@
+package graphql
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+
+	"go-graphql-ecom/apperr"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// FormatError prepares an error from running a query for clients. Errors raised by
+// resolvers get their code and details in extensions. Anything that isn't an apperr.Error,
+// such as a database error, is logged under a correlation ID and reported only as an
+// INTERNAL error with that ID. Errors in the query document itself are left as they are.
+func FormatError(err error) gqlerrors.FormattedError {
+	formatted := gqlerrors.FormatError(err)
+	var located *gqlerrors.Error
+	if !errors.As(err, &located) || located.OriginalError == nil {
+		// Errors from starting a subscription arrive without a location
+		if appErr, ok := apperr.As(err); ok {
+			formatted.Extensions = appErr.Extensions()
+		}
+		return formatted
+	}
+
+	cause := located.OriginalError
+	if appErr, ok := apperr.As(cause); ok {
+		formatted.Message = cause.Error()
+		formatted.Extensions = appErr.Extensions()
+		return formatted
+	}
+
+	id := correlationID()
+	log.Printf("internal error %s at %v: %v", id, formatted.Path, cause)
+	formatted.Message = "internal error (correlation ID " + id + ")"
+	formatted.Extensions = map[string]interface{}{
+		"code":          apperr.CodeInternal,
+		"correlationId": id,
+	}
+	return formatted
+}
+
+// formatErrors applies FormatError to the errors of a result
+func formatErrors(errs []gqlerrors.FormattedError) {
+	for i, err := range errs {
+		errs[i] = FormatError(err.OriginalError())
+	}
+}
+
+// correlationID returns a random ID that ties an error shown to a client to the log entry
+// with its cause
+func correlationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,29 @@
+package graphql
+
+import (
+	"net/http"
+	"strings"
+)
+
+// GraphiQL serves the GraphiQL IDE rendered by ide. Loading the page only renders the IDE:
+// an operation in its URL is filled in but not run. The operations the IDE sends back are
+// handled by Handler, so they are analyzed, limited and charged like any other request.
+func GraphiQL(ide http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isPageLoad(r) {
+			Handler(w, r)
+			return
+		}
+		page := r.Clone(r.Context())
+		page.URL.RawQuery = ""
+		ide.ServeHTTP(w, page)
+	})
+}
+
+// isPageLoad reports whether a request comes from a browser opening the IDE rather than
+// from the IDE itself
+func isPageLoad(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return r.Method == http.MethodGet && strings.Contains(accept, "text/html") &&
+		!strings.Contains(accept, "application/json")
+}
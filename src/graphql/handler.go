@@ -1,48 +1,243 @@
 package graphql
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/gorilla/websocket"
 	"github.com/graphql-go/graphql"
-
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
 )
 
 type postData struct {
-	Query     string                 `json:"query"`
-	Variables map[string]interface{} `json:"variables"`
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
 }
 
-// Handler handles GraphQL HTTP requests
+// Handler handles GraphQL HTTP requests, GET for queries and POST for any operation or a
+// batch of them, and WebSocket connections and event streams for subscriptions
 func Handler(w http.ResponseWriter, r *http.Request) {
-	// Only accept POST requests
-	if r.Method != "POST" {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	if websocket.IsWebSocketUpgrade(r) {
+		serveWebSocket(w, r)
+		return
+	}
+	if acceptsEventStream(r) {
+		serveEventStream(w, r)
 		return
 	}
 
-	// Parse the request body
+	// Read the operation from the URL of a GET request, or the operation or batch of
+	// operations from the body of a POST request
 	var data postData
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"errors": []map[string]interface{}{
-				{
-					"message": "Invalid request body",
-				},
-			},
-		})
+	var batch []postData
+	switch {
+	case r.Method == http.MethodGet:
+		var err error
+		if data, err = postDataFromQuery(r.URL.Query()); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case r.Method != http.MethodPost:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	case strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data"):
+		operations, err := parseMultipartRequest(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if list, ok := operations.([]interface{}); ok {
+			batch = make([]postData, len(list))
+			for i, operation := range list {
+				if batch[i], err = postDataFromMap(operation); err != nil {
+					break
+				}
+			}
+		} else {
+			data, err = postDataFromMap(operations)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		var body json.RawMessage
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err == nil {
+			if isBatch(body) {
+				err = json.Unmarshal(body, &batch)
+			} else {
+				err = json.Unmarshal(body, &data)
+			}
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	if batch != nil {
+		serveBatch(w, r, batch)
+		return
+	}
+
+	analysis, err := prepare(&data, r.Method == http.MethodGet)
+	if err != nil {
+		err.write(w)
 		return
 	}
+	if !takeBudget(w, r, analysis.Cost) {
+		return
+	}
+	ctx := r.Context()
+	if !analysis.Mutation {
+		ctx = withLoaders(ctx, newLoaders())
+	}
+	result := execute(ctx, data, analysis)
+
+	// Responses to GET requests can be cached for as long as their fields allow, unless
+	// something went wrong
+	if r.Method == http.MethodGet {
+		policy := analysis.Cache
+		if len(result.Errors) > 0 {
+			policy = cachePolicy{}
+		}
+		body, _ := json.Marshal(result)
+		writeCacheable(w, r, append(body, '\n'), policy)
+		return
+	}
+
+	// Set content type and return the result
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// prepare gets an operation ready to run: it resolves a persisted query, then analyzes the
+// query and rejects it if it is too deep or costly. readOnly rejects mutations, for requests
+// such as GETs that mustn't change anything. Documents that don't parse cost one point;
+// execution reports the syntax error.
+func prepare(data *postData, readOnly bool) (queryAnalysis, *requestError) {
+	if err := GetPersistedQueries().resolve(data); err != nil {
+		return queryAnalysis{}, err
+	}
+
+	analysis := queryAnalysis{Cost: 1}
+	if doc, err := parser.Parse(parser.ParseParams{Source: data.Query}); err == nil {
+		// A link or image can make a browser send a GET, so it mustn't change anything
+		if readOnly && operationType(doc, data.OperationName) == ast.OperationTypeMutation {
+			return analysis, &requestError{status: http.StatusMethodNotAllowed, message: "mutations must be sent with POST"}
+		}
+		analysis = analyzeQuery(doc, data.OperationName, data.Variables)
+	}
+	limits := GetQueryLimits()
+	if message, code := limits.check(analysis); message != "" {
+		return analysis, &requestError{status: http.StatusBadRequest, message: message, extensions: map[string]interface{}{
+			"code": code,
+			"cost": costExtension(analysis, limits),
+		}}
+	}
+	return analysis, nil
+}
 
-	// Execute the GraphQL query
+// execute runs a prepared operation and reports its cost in the result's extensions
+func execute(ctx context.Context, data postData, analysis queryAnalysis) *graphql.Result {
 	result := graphql.Do(graphql.Params{
 		Schema:         Schema,
 		RequestString:  data.Query,
 		VariableValues: data.Variables,
+		OperationName:  data.OperationName,
+		Context:        ctx,
 	})
 
-	// Set content type and return the result
+	formatErrors(result.Errors)
+	if result.Extensions == nil {
+		result.Extensions = make(map[string]interface{})
+	}
+	result.Extensions["cost"] = costExtension(analysis, GetQueryLimits())
+	return result
+}
+
+// requestError is why an operation can't be run. On its own it is answered with a status and
+// a GraphQL error; in a batch the error is the operation's result.
+type requestError struct {
+	status     int
+	message    string
+	extensions map[string]interface{}
+}
+
+func (e *requestError) write(w http.ResponseWriter) {
+	if e.status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", http.MethodPost)
+	}
+	writeErrorWithExtensions(w, e.status, e.message, e.extensions)
+}
+
+func (e *requestError) formatted() []gqlerrors.FormattedError {
+	err := gqlerrors.NewFormattedError(e.message)
+	err.Extensions = e.extensions
+	return []gqlerrors.FormattedError{err}
+}
+
+// postDataFromMap converts an operation decoded from a multipart request
+func postDataFromMap(operation interface{}) (postData, error) {
+	var data postData
+	fields, ok := operation.(map[string]interface{})
+	if !ok {
+		return data, errors.New("invalid multipart request: operations must be an object")
+	}
+	data.Query, _ = fields["query"].(string)
+	data.OperationName, _ = fields["operationName"].(string)
+	data.Variables, _ = fields["variables"].(map[string]interface{})
+	data.Extensions, _ = fields["extensions"].(map[string]interface{})
+	return data, nil
+}
+
+// postDataFromQuery reads an operation from the query, variables, operationName and
+// extensions parameters of a GET request's URL
+func postDataFromQuery(values url.Values) (postData, error) {
+	data := postData{
+		Query:         values.Get("query"),
+		OperationName: values.Get("operationName"),
+	}
+	if variables := values.Get("variables"); variables != "" {
+		if err := json.Unmarshal([]byte(variables), &data.Variables); err != nil {
+			return data, errors.New("variables must be a JSON object")
+		}
+	}
+	if extensions := values.Get("extensions"); extensions != "" {
+		if err := json.Unmarshal([]byte(extensions), &data.Extensions); err != nil {
+			return data, errors.New("extensions must be a JSON object")
+		}
+	}
+	return data, nil
+}
+
+// writeError writes a GraphQL-shaped error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeErrorWithExtensions(w, status, message, nil)
+}
+
+// writeErrorWithExtensions writes a GraphQL-shaped error response whose error carries
+// extensions such as a machine-readable code
+func writeErrorWithExtensions(w http.ResponseWriter, status int, message string, extensions map[string]interface{}) {
+	formatted := map[string]interface{}{
+		"message": message,
+	}
+	if extensions != nil {
+		formatted["extensions"] = extensions
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]interface{}{formatted},
+	})
 }
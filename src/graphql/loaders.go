@@ -0,0 +1,111 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+
+	"go-graphql-ecom/database"
+)
+
+// Loaders remember the records looked up by ID while serving the queries of an HTTP request,
+// so the queries of a batch, and a record reached through several fields of one query, load
+// each record once. Mutations don't use them, so they read what earlier mutation fields and
+// operations wrote. Streaming transports don't use them either, since what they remember would
+// go stale over the life of a subscription.
+
+// loader fetches records by ID and remembers the results. It is safe for concurrent use;
+// callers asking for a record that is being fetched wait for that fetch.
+type loader struct {
+	fetch   func(id int) (interface{}, error)
+	mu      sync.Mutex
+	results map[int]*loadResult
+}
+
+type loadResult struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newLoader(fetch func(id int) (interface{}, error)) *loader {
+	return &loader{fetch: fetch, results: make(map[int]*loadResult)}
+}
+
+// load returns the record with an ID, fetching it the first time it is asked for
+func (l *loader) load(id int) (interface{}, error) {
+	l.mu.Lock()
+	result, loaded := l.results[id]
+	if !loaded {
+		result = &loadResult{done: make(chan struct{})}
+		l.results[id] = result
+	}
+	l.mu.Unlock()
+
+	if !loaded {
+		func() {
+			defer close(result.done)
+			result.value, result.err = l.fetch(id)
+		}()
+	}
+	<-result.done
+	return result.value, result.err
+}
+
+// loaders are the loaders of a request
+type loaders struct {
+	users    *loader
+	products *loader
+	orders   *loader
+}
+
+func newLoaders() *loaders {
+	return &loaders{
+		users: newLoader(func(id int) (interface{}, error) {
+			return database.GetUserByID(database.GetDB(), id)
+		}),
+		products: newLoader(func(id int) (interface{}, error) {
+			return database.GetProductByID(database.GetDB(), id)
+		}),
+		orders: newLoader(func(id int) (interface{}, error) {
+			return database.GetOrderByID(database.GetDB(), id)
+		}),
+	}
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFromContext(ctx context.Context) *loaders {
+	l, _ := ctx.Value(loadersKey{}).(*loaders)
+	return l
+}
+
+// loadUser returns a user through the request's loaders, or from the database when there
+// are none
+func loadUser(ctx context.Context, id int) (interface{}, error) {
+	if l := loadersFromContext(ctx); l != nil {
+		return l.users.load(id)
+	}
+	return database.GetUserByID(database.GetDB(), id)
+}
+
+// loadProduct returns a product through the request's loaders, or from the database when
+// there are none
+func loadProduct(ctx context.Context, id int) (interface{}, error) {
+	if l := loadersFromContext(ctx); l != nil {
+		return l.products.load(id)
+	}
+	return database.GetProductByID(database.GetDB(), id)
+}
+
+// loadOrder returns an order through the request's loaders, or from the database when there
+// are none
+func loadOrder(ctx context.Context, id int) (interface{}, error) {
+	if l := loadersFromContext(ctx); l != nil {
+		return l.orders.load(id)
+	}
+	return database.GetOrderByID(database.GetDB(), id)
+}
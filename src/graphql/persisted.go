@@ -0,0 +1,125 @@
+package graphql
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/persisted"
+)
+
+// Operations may be sent as automatic persisted queries: the extensions.persistedQuery entry
+// of a request carries the SHA-256 hash of the query, and the query itself is left out once
+// the server has seen it. https://www.apollographql.com/docs/apollo-server/performance/apq
+
+// PersistedQueries configures how operations sent by hash are resolved
+type PersistedQueries struct {
+	// Cache holds the operations clients sent along with their hash, and registered ones
+	// already looked up. Without one clients can only send registered operations by hash.
+	Cache *persisted.Cache
+	// Strict rejects every operation that wasn't registered from a manifest (see the admin
+	// register-queries command)
+	Strict bool
+}
+
+var (
+	persistedMu      sync.RWMutex
+	persistedQueries = PersistedQueries{Cache: persisted.NewCache(1000)}
+)
+
+// SetPersistedQueries sets how persisted queries are resolved
+func SetPersistedQueries(config PersistedQueries) {
+	persistedMu.Lock()
+	defer persistedMu.Unlock()
+	persistedQueries = config
+}
+
+// GetPersistedQueries returns how persisted queries are resolved
+func GetPersistedQueries() PersistedQueries {
+	persistedMu.RLock()
+	defer persistedMu.RUnlock()
+	return persistedQueries
+}
+
+var (
+	// Clients such as Apollo Client recognise this error and retry with the full query, so it
+	// is sent with a 200 like any other GraphQL error
+	errPersistedQueryNotFound = persistedQueryError(http.StatusOK, "PersistedQueryNotFound", "PERSISTED_QUERY_NOT_FOUND")
+	errPersistedQueryVersion  = persistedQueryError(http.StatusBadRequest, "PersistedQueryNotSupported", "PERSISTED_QUERY_NOT_SUPPORTED")
+	errPersistedQueryHash     = persistedQueryError(http.StatusBadRequest, "provided sha does not match query",
+		"PERSISTED_QUERY_HASH_MISMATCH")
+	errPersistedQueryNotInList = persistedQueryError(http.StatusBadRequest,
+		"only registered operations may be run; send the hash of one from the client's manifest", "PERSISTED_QUERY_NOT_IN_LIST")
+)
+
+func persistedQueryError(status int, message, code string) *requestError {
+	return &requestError{status: status, message: message, extensions: map[string]interface{}{"code": code}}
+}
+
+// resolve fills in the query of an operation sent by hash, remembers the query
+// of one sent along with its hash, and in strict mode rejects operations that weren't
+// registered
+func (p PersistedQueries) resolve(data *postData) *requestError {
+	extension, sent := data.Extensions["persistedQuery"].(map[string]interface{})
+	if !sent {
+		if p.Strict && data.Query != "" && !p.registered(persisted.Hash(data.Query)) {
+			return errPersistedQueryNotInList
+		}
+		return nil
+	}
+	if version, _ := extension["version"].(float64); version != 1 {
+		return errPersistedQueryVersion
+	}
+	hash, _ := extension["sha256Hash"].(string)
+	hash = strings.ToLower(hash)
+
+	if data.Query == "" {
+		if query, ok := p.lookup(hash); ok {
+			data.Query = query
+			return nil
+		}
+		return errPersistedQueryNotFound
+	}
+	if persisted.Hash(data.Query) != hash {
+		return errPersistedQueryHash
+	}
+	if p.Strict {
+		if !p.registered(hash) {
+			return errPersistedQueryNotInList
+		}
+	} else if p.Cache != nil {
+		p.Cache.Add(hash, data.Query)
+	}
+	return nil
+}
+
+// lookup returns the query stored under a hash, from the cache or else the registered
+// operations
+func (p PersistedQueries) lookup(hash string) (string, bool) {
+	if p.Cache != nil {
+		if query, ok := p.Cache.Get(hash); ok {
+			return query, true
+		}
+	}
+	registered, err := database.GetPersistedQuery(database.GetDB(), hash)
+	if err != nil {
+		if apperr.CodeOf(err) != apperr.CodeNotFound {
+			log.Printf("persisted query lookup failed: %v", err)
+		}
+		return "", false
+	}
+	if p.Cache != nil {
+		p.Cache.Add(hash, registered.Body)
+	}
+	return registered.Body, true
+}
+
+// registered reports whether an operation was registered from a manifest. In strict mode
+// the cache only ever holds registered operations.
+func (p PersistedQueries) registered(hash string) bool {
+	_, ok := p.lookup(hash)
+	return ok
+}
@@ -0,0 +1,86 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"go-graphql-ecom/auth"
+	"go-graphql-ecom/ratelimit"
+)
+
+// clientKey identifies whose budget a request spends: the user or API key in its context, or
+// else the address it came from
+func clientKey(ctx context.Context, remoteAddr string) string {
+	if user := auth.UserFromContext(ctx); user != nil {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+	if key := auth.APIKeyFromContext(ctx); key != nil {
+		return fmt.Sprintf("apikey:%d", key.ID)
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return "ip:" + host
+}
+
+// takeBudget charges the cost of a request to its client and sets the RateLimit headers.
+// When the budget is exhausted it writes a 429 response and returns false.
+func takeBudget(w http.ResponseWriter, r *http.Request, cost int) bool {
+	limiter := ratelimit.GetLimiter()
+	if limiter == nil {
+		return true
+	}
+
+	result, err := chargeBudget(limiter, clientKey(r.Context(), r.RemoteAddr), cost)
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", result.Limit, int(limiter.Window().Seconds())))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+	if err == nil {
+		return true
+	}
+	if result.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(result.RetryAfter.Seconds())))
+	}
+	err.write(w)
+	return false
+}
+
+// takeOperationBudget charges the cost of an operation sent over a WebSocket connection to
+// the client that opened it, returning the error to answer with when the budget is exhausted
+func takeOperationBudget(ctx context.Context, remoteAddr string, cost int) *requestError {
+	limiter := ratelimit.GetLimiter()
+	if limiter == nil {
+		return nil
+	}
+	_, err := chargeBudget(limiter, clientKey(ctx, remoteAddr), cost)
+	return err
+}
+
+// chargeBudget takes cost points from a client's budget. When the budget can't cover them,
+// it also returns a RATE_LIMITED error.
+func chargeBudget(limiter *ratelimit.Limiter, key string, cost int) (ratelimit.Result, *requestError) {
+	result := limiter.Take(key, cost)
+	if result.Allowed {
+		return result, nil
+	}
+
+	message := fmt.Sprintf("rate limit exceeded: query costs %d and %d of %d remain", cost, result.Remaining, result.Limit)
+	extensions := map[string]interface{}{
+		"code":      "RATE_LIMITED",
+		"cost":      cost,
+		"remaining": result.Remaining,
+		"limit":     result.Limit,
+	}
+	if result.RetryAfter > 0 {
+		extensions["retryAfter"] = int(result.RetryAfter.Seconds())
+	} else {
+		message = fmt.Sprintf("query costs %d, more than the rate limit budget of %d", cost, result.Limit)
+	}
+	return result, &requestError{status: http.StatusTooManyRequests, message: message, extensions: extensions}
+}
@@ -1,10 +1,25 @@
 package graphql
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/auth"
 	"go-graphql-ecom/database"
+	"go-graphql-ecom/events"
+	"go-graphql-ecom/invoice"
+	"go-graphql-ecom/notify"
+	"go-graphql-ecom/orders"
+	"go-graphql-ecom/pricing"
+	"go-graphql-ecom/storage"
 
 	"github.com/graphql-go/graphql"
 )
@@ -13,111 +28,1535 @@ import (
 func getUserResolver(p graphql.ResolveParams) (interface{}, error) {
 	id, ok := p.Args["id"].(int)
 	if !ok {
-		return nil, errors.New("invalid user ID")
+		return nil, apperr.Invalid("id", "invalid user ID")
 	}
-	return database.GetUserByID(database.GetDB(), id)
+	if err := auth.AuthorizeOwner(p.Context, id, auth.PermViewUsers); err != nil {
+		return nil, err
+	}
+	return loadUser(p.Context, id)
+}
+
+func getAllUsersResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermViewUsers); err != nil {
+		return nil, err
+	}
+	return database.GetAllUsers(database.GetDB())
+}
+
+func createUserResolver(p graphql.ResolveParams) (interface{}, error) {
+	name := stringArg(p.Args, "name")
+	email := stringArg(p.Args, "email")
+	password := stringArg(p.Args, "password")
+
+	return auth.Register(database.GetDB(), name, email, password)
+}
+
+func getMeResolver(p graphql.ResolveParams) (interface{}, error) {
+	if user := auth.UserFromContext(p.Context); user != nil {
+		return user, nil
+	}
+	return nil, nil
+}
+
+func loginResolver(p graphql.ResolveParams) (interface{}, error) {
+	db := database.GetDB()
+	otp, _ := p.Args["otp"].(string)
+	user, err := auth.Authenticate(db, stringArg(p.Args, "email"), stringArg(p.Args, "password"), otp)
+	if err != nil {
+		return nil, err
+	}
+	token, expiresAt, err := auth.StartSession(db, user)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"token":     token,
+		"expiresAt": expiresAt.Format(time.RFC3339),
+		"user":      user,
+	}, nil
+}
+
+func logoutResolver(p graphql.ResolveParams) (interface{}, error) {
+	token := auth.TokenFromContext(p.Context)
+	if token == "" {
+		return false, nil
+	}
+	if err := auth.EndSession(database.GetDB(), token); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func enrollTwoFactorResolver(p graphql.ResolveParams) (interface{}, error) {
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	enrollment, err := auth.EnrollTwoFactor(database.GetDB(), user)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"secret":     enrollment.Secret,
+		"otpauthUri": enrollment.URI,
+		"qrCodePng":  "data:image/png;base64," + base64.StdEncoding.EncodeToString(enrollment.QRCode),
+	}, nil
+}
+
+func confirmTwoFactorResolver(p graphql.ResolveParams) (interface{}, error) {
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	return auth.ConfirmTwoFactor(database.GetDB(), user, auth.TokenFromContext(p.Context), stringArg(p.Args, "code"))
+}
+
+func disableTwoFactorResolver(p graphql.ResolveParams) (interface{}, error) {
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	if err := auth.DisableTwoFactor(database.GetDB(), user, stringArg(p.Args, "code")); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func regenerateRecoveryCodesResolver(p graphql.ResolveParams) (interface{}, error) {
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	return auth.RegenerateRecoveryCodes(database.GetDB(), user, stringArg(p.Args, "code"))
+}
+
+func getTwoFactorEnabledFromUserResolver(p graphql.ResolveParams) (interface{}, error) {
+	user, ok := userFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get two-factor status from user")
+	}
+	return user.TOTPEnabled, nil
+}
+
+func requestPasswordResetResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.RequestPasswordReset(database.GetDB(), stringArg(p.Args, "email")); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func resetPasswordResolver(p graphql.ResolveParams) (interface{}, error) {
+	err := auth.ResetPassword(database.GetDB(), stringArg(p.Args, "token"), stringArg(p.Args, "newPassword"))
+	if err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func verifyEmailResolver(p graphql.ResolveParams) (interface{}, error) {
+	return auth.VerifyEmail(database.GetDB(), stringArg(p.Args, "token"))
+}
+
+func resendVerificationEmailResolver(p graphql.ResolveParams) (interface{}, error) {
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	if err := auth.ResendVerification(database.GetDB(), user); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// Product resolvers
+func getProductResolver(p graphql.ResolveParams) (interface{}, error) {
+	id, ok := p.Args["id"].(int)
+	if !ok {
+		return nil, apperr.Invalid("id", "invalid product ID")
+	}
+	return loadProduct(p.Context, id)
+}
+
+func getAllProductsResolver(p graphql.ResolveParams) (interface{}, error) {
+	return database.GetAllProducts(database.GetDB())
+}
+
+func createProductResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageCatalog); err != nil {
+		return nil, err
+	}
+	name := stringArg(p.Args, "name")
+	description, _ := p.Args["description"].(string)
+	category, _ := p.Args["category"].(string)
+	taxClass, _ := p.Args["taxClass"].(string)
+	price := floatArg(p.Args, "price")
+	inventory := intArg(p.Args, "inventory")
+
+	return database.CreateProduct(database.GetDB(), name, description, category, taxClass, price, inventory)
+}
+
+// ProductImage resolvers
+func uploadProductImageResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageCatalog); err != nil {
+		return nil, err
+	}
+	productID := intArg(p.Args, "productId")
+	upload, ok := p.Args["file"].(*Upload)
+	if !ok {
+		return nil, apperr.Invalid("file", "file must be sent as a multipart upload")
+	}
+
+	store := storage.GetStore()
+	if store == nil {
+		return nil, errors.New("file storage is not configured")
+	}
+
+	db := database.GetDB()
+	if _, err := database.GetProductByID(db, productID); err != nil {
+		return nil, err
+	}
+
+	data, err := upload.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	img, info, err := storage.DecodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	thumb, thumbType, err := storage.EncodeThumbnail(storage.Thumbnail(img, storage.ThumbnailSize), info.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("products/%d/%s.%s", productID, name, info.Format)
+	thumbKey := fmt.Sprintf("products/%d/%s_thumb.%s", productID, name, thumbType[len("image/"):])
+
+	if err := store.Put(key, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if err := store.Put(thumbKey, bytes.NewReader(thumb)); err != nil {
+		store.Delete(key)
+		return nil, err
+	}
+
+	image, err := database.CreateProductImage(db, &database.ProductImage{
+		ProductID:    productID,
+		Filename:     upload.Filename,
+		ContentType:  info.ContentType,
+		StorageKey:   key,
+		ThumbnailKey: thumbKey,
+		Width:        info.Width,
+		Height:       info.Height,
+	})
+	if err != nil {
+		store.Delete(key)
+		store.Delete(thumbKey)
+		return nil, err
+	}
+	return image, nil
+}
+
+func getImageURLResolver(p graphql.ResolveParams) (interface{}, error) {
+	image, ok := imageFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get url from product image")
+	}
+	return blobURL(image.StorageKey), nil
+}
+
+func getThumbnailURLResolver(p graphql.ResolveParams) (interface{}, error) {
+	image, ok := imageFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get thumbnail url from product image")
+	}
+	return blobURL(image.ThumbnailKey), nil
+}
+
+// Review resolvers
+func addReviewResolver(p graphql.ResolveParams) (interface{}, error) {
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	productID := intArg(p.Args, "productId")
+	rating := intArg(p.Args, "rating")
+	title, _ := p.Args["title"].(string)
+	body, _ := p.Args["body"].(string)
+
+	return database.CreateReview(database.GetDB(), user.ID, productID, rating, title, body)
+}
+
+// authorizeReview checks that the request may change a review: its author may, and so may
+// staff who manage the catalog, to moderate reviews
+func authorizeReview(ctx context.Context, id int) error {
+	review, err := database.GetReviewByID(database.GetDB(), id)
+	if err != nil {
+		return err
+	}
+	return auth.AuthorizeOwner(ctx, review.UserID, auth.PermManageCatalog)
+}
+
+func updateReviewResolver(p graphql.ResolveParams) (interface{}, error) {
+	id := intArg(p.Args, "id")
+	if err := authorizeReview(p.Context, id); err != nil {
+		return nil, err
+	}
+
+	var rating *int
+	if r, ok := p.Args["rating"].(int); ok {
+		rating = &r
+	}
+	var title, body *string
+	if t, ok := p.Args["title"].(string); ok {
+		title = &t
+	}
+	if b, ok := p.Args["body"].(string); ok {
+		body = &b
+	}
+
+	return database.UpdateReview(database.GetDB(), id, rating, title, body)
+}
+
+func deleteReviewResolver(p graphql.ResolveParams) (interface{}, error) {
+	id := intArg(p.Args, "id")
+	if err := authorizeReview(p.Context, id); err != nil {
+		return nil, err
+	}
+
+	if err := database.DeleteReview(database.GetDB(), id); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// Wishlist resolvers
+
+// ownWishlist returns a wishlist of the request's user. Other people's wishlists can only be
+// read through their share token.
+func ownWishlist(ctx context.Context, id int) (*database.Wishlist, error) {
+	user := auth.UserFromContext(ctx)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	wishlist, err := database.GetWishlistByID(database.GetDB(), id)
+	if err != nil {
+		return nil, err
+	}
+	if wishlist.UserID != user.ID {
+		return nil, auth.ErrForbidden
+	}
+	return wishlist, nil
+}
+
+// ownWishlistItem returns an item on a wishlist of the request's user
+func ownWishlistItem(ctx context.Context, id int) (*database.WishlistItem, error) {
+	item, err := database.GetWishlistItemByID(database.GetDB(), id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ownWishlist(ctx, item.WishlistID); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func getWishlistResolver(p graphql.ResolveParams) (interface{}, error) {
+	return ownWishlist(p.Context, intArg(p.Args, "id"))
+}
+
+func getSharedWishlistResolver(p graphql.ResolveParams) (interface{}, error) {
+	token := stringArg(p.Args, "token")
+	return database.GetWishlistByShareToken(database.GetDB(), token)
+}
+
+func getWishlistPriceDropsResolver(p graphql.ResolveParams) (interface{}, error) {
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	return database.GetWishlistPriceDrops(database.GetDB(), user.ID)
+}
+
+func createWishlistResolver(p graphql.ResolveParams) (interface{}, error) {
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	name := stringArg(p.Args, "name")
+	return database.CreateWishlist(database.GetDB(), user.ID, name)
+}
+
+func addToWishlistResolver(p graphql.ResolveParams) (interface{}, error) {
+	wishlist, err := ownWishlist(p.Context, intArg(p.Args, "wishlistId"))
+	if err != nil {
+		return nil, err
+	}
+	productID := intArg(p.Args, "productId")
+	return database.AddToWishlist(database.GetDB(), wishlist.ID, productID)
+}
+
+func removeFromWishlistResolver(p graphql.ResolveParams) (interface{}, error) {
+	item, err := ownWishlistItem(p.Context, intArg(p.Args, "itemId"))
+	if err != nil {
+		return nil, err
+	}
+	if err := database.RemoveFromWishlist(database.GetDB(), item.ID); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func moveWishlistItemToCartResolver(p graphql.ResolveParams) (interface{}, error) {
+	item, err := ownWishlistItem(p.Context, intArg(p.Args, "itemId"))
+	if err != nil {
+		return nil, err
+	}
+	quantity := intArg(p.Args, "quantity")
+
+	db := database.GetDB()
+	cart, err := database.MoveWishlistItemToCart(db, item.ID, quantity)
+	if err != nil {
+		return nil, err
+	}
+	return pricing.RecalculateOrder(db, cart.ID)
+}
+
+func shareWishlistResolver(p graphql.ResolveParams) (interface{}, error) {
+	wishlist, err := ownWishlist(p.Context, intArg(p.Args, "id"))
+	if err != nil {
+		return nil, err
+	}
+	return database.ShareWishlist(database.GetDB(), wishlist.ID)
+}
+
+func unshareWishlistResolver(p graphql.ResolveParams) (interface{}, error) {
+	wishlist, err := ownWishlist(p.Context, intArg(p.Args, "id"))
+	if err != nil {
+		return nil, err
+	}
+	return database.UnshareWishlist(database.GetDB(), wishlist.ID)
+}
+
+// Coupon resolvers
+func getAllCouponsResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManagePricing); err != nil {
+		return nil, err
+	}
+	return database.GetAllCoupons(database.GetDB())
+}
+
+func getCouponResolver(p graphql.ResolveParams) (interface{}, error) {
+	code := stringArg(p.Args, "code")
+	return database.GetCouponByCode(database.GetDB(), code)
+}
+
+func createCouponResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManagePricing); err != nil {
+		return nil, err
+	}
+	coupon := &database.Coupon{
+		Code:   stringArg(p.Args, "code"),
+		Type:   stringArg(p.Args, "type"),
+		Active: true,
+	}
+	coupon.Description, _ = p.Args["description"].(string)
+	coupon.Value, _ = p.Args["value"].(float64)
+	coupon.MaxUses, _ = p.Args["maxUses"].(int)
+	coupon.MaxUsesPerUser, _ = p.Args["maxUsesPerUser"].(int)
+	coupon.MinOrderValue, _ = p.Args["minOrderValue"].(float64)
+	if startsAt, ok := p.Args["startsAt"].(time.Time); ok {
+		coupon.StartsAt = &startsAt
+	}
+	if endsAt, ok := p.Args["endsAt"].(time.Time); ok {
+		coupon.EndsAt = &endsAt
+	}
+	for _, v := range listArg(p.Args, "productIds") {
+		if id, ok := v.(int); ok {
+			coupon.ProductIDs = append(coupon.ProductIDs, id)
+		}
+	}
+	for _, v := range listArg(p.Args, "categories") {
+		if category, ok := v.(string); ok {
+			coupon.Categories = append(coupon.Categories, category)
+		}
+	}
+
+	return database.CreateCoupon(database.GetDB(), coupon)
+}
+
+func setCouponActiveResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManagePricing); err != nil {
+		return nil, err
+	}
+	id := intArg(p.Args, "id")
+	active := boolArg(p.Args, "active")
+	return database.SetCouponActive(database.GetDB(), id, active)
+}
+
+func applyCouponResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, err := authorizeOrder(p.Context, intArg(p.Args, "orderId"))
+	if err != nil {
+		return nil, err
+	}
+	code := stringArg(p.Args, "code")
+	return pricing.ApplyCoupon(database.GetDB(), order.ID, code)
+}
+
+func removeCouponResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, err := authorizeOrder(p.Context, intArg(p.Args, "orderId"))
+	if err != nil {
+		return nil, err
+	}
+	return pricing.RemoveCoupon(database.GetDB(), order.ID)
+}
+
+// Promotion resolvers
+func getAllPromotionsResolver(p graphql.ResolveParams) (interface{}, error) {
+	return database.GetAllPromotions(database.GetDB())
+}
+
+func createPromotionResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManagePricing); err != nil {
+		return nil, err
+	}
+	promotion := &database.Promotion{
+		Name:   stringArg(p.Args, "name"),
+		Type:   stringArg(p.Args, "type"),
+		Active: true,
+	}
+	promotion.BuyQuantity, _ = p.Args["buyQuantity"].(int)
+	promotion.GetQuantity, _ = p.Args["getQuantity"].(int)
+	promotion.BundlePrice, _ = p.Args["bundlePrice"].(float64)
+	if startsAt, ok := p.Args["startsAt"].(time.Time); ok {
+		promotion.StartsAt = &startsAt
+	}
+	if endsAt, ok := p.Args["endsAt"].(time.Time); ok {
+		promotion.EndsAt = &endsAt
+	}
+	for _, product := range objectsArg(p.Args, "products") {
+		promotion.Products = append(promotion.Products, database.PromotionProduct{
+			ProductID: intArg(product, "productId"),
+			Quantity:  intArg(product, "quantity"),
+		})
+	}
+	for _, tier := range objectsArg(p.Args, "tiers") {
+		promotion.Tiers = append(promotion.Tiers, database.PromotionTier{
+			MinQuantity: intArg(tier, "minQuantity"),
+			UnitPrice:   floatArg(tier, "unitPrice"),
+		})
+	}
+
+	return database.CreatePromotion(database.GetDB(), promotion)
+}
+
+func setPromotionActiveResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManagePricing); err != nil {
+		return nil, err
+	}
+	id := intArg(p.Args, "id")
+	active := boolArg(p.Args, "active")
+	return database.SetPromotionActive(database.GetDB(), id, active)
+}
+
+// TaxRate resolvers
+func getTaxRatesResolver(p graphql.ResolveParams) (interface{}, error) {
+	return database.GetAllTaxRates(database.GetDB())
+}
+
+func setTaxRateResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManagePricing); err != nil {
+		return nil, err
+	}
+	rate := &database.TaxRate{
+		Country: stringArg(p.Args, "country"),
+		Name:    stringArg(p.Args, "name"),
+		Rate:    floatArg(p.Args, "rate"),
+	}
+	rate.Region, _ = p.Args["region"].(string)
+	rate.TaxClass, _ = p.Args["taxClass"].(string)
+
+	db := database.GetDB()
+	saved, err := database.SetTaxRate(db, rate)
+	if err != nil {
+		return nil, err
+	}
+	return saved, pricing.ReloadTaxRates(db)
+}
+
+func deleteTaxRateResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManagePricing); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	if err := database.DeleteTaxRate(db, intArg(p.Args, "id")); err != nil {
+		return false, err
+	}
+	return true, pricing.ReloadTaxRates(db)
+}
+
+// Address resolvers
+
+// ownAddress returns an address from the address book of the request's user
+func ownAddress(ctx context.Context, id int) (*database.Address, error) {
+	user := auth.UserFromContext(ctx)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	address, err := database.GetAddressByID(database.GetDB(), id)
+	if err != nil {
+		return nil, err
+	}
+	if address.UserID != user.ID {
+		return nil, auth.ErrForbidden
+	}
+	return address, nil
+}
+
+func addAddressResolver(p graphql.ResolveParams) (interface{}, error) {
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	address := &database.Address{
+		UserID:  user.ID,
+		Name:    stringArg(p.Args, "name"),
+		Line1:   stringArg(p.Args, "line1"),
+		City:    stringArg(p.Args, "city"),
+		Country: strings.ToUpper(stringArg(p.Args, "country")),
+	}
+	address.Line2, _ = p.Args["line2"].(string)
+	address.Region, _ = p.Args["region"].(string)
+	address.PostalCode, _ = p.Args["postalCode"].(string)
+	address.Phone, _ = p.Args["phone"].(string)
+	address.IsDefaultShipping, _ = p.Args["isDefaultShipping"].(bool)
+	address.IsDefaultBilling, _ = p.Args["isDefaultBilling"].(bool)
+
+	return database.CreateAddress(database.GetDB(), address)
+}
+
+func updateAddressResolver(p graphql.ResolveParams) (interface{}, error) {
+	address, err := ownAddress(p.Context, intArg(p.Args, "id"))
+	if err != nil {
+		return nil, err
+	}
+
+	for arg, field := range map[string]*string{
+		"name":       &address.Name,
+		"line1":      &address.Line1,
+		"line2":      &address.Line2,
+		"city":       &address.City,
+		"region":     &address.Region,
+		"postalCode": &address.PostalCode,
+		"country":    &address.Country,
+		"phone":      &address.Phone,
+	} {
+		if value, ok := p.Args[arg].(string); ok {
+			*field = value
+		}
+	}
+	address.Country = strings.ToUpper(address.Country)
+	if value, ok := p.Args["isDefaultShipping"].(bool); ok {
+		address.IsDefaultShipping = value
+	}
+	if value, ok := p.Args["isDefaultBilling"].(bool); ok {
+		address.IsDefaultBilling = value
+	}
+
+	return database.UpdateAddress(database.GetDB(), address)
+}
+
+func deleteAddressResolver(p graphql.ResolveParams) (interface{}, error) {
+	address, err := ownAddress(p.Context, intArg(p.Args, "id"))
+	if err != nil {
+		return false, err
+	}
+	if err := database.DeleteAddress(database.GetDB(), address.ID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Shipping resolvers
+func getShippingMethodsResolver(p graphql.ResolveParams) (interface{}, error) {
+	return database.GetAllShippingMethods(database.GetDB())
+}
+
+func getShippingOptionsResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, err := authorizeOrder(p.Context, intArg(p.Args, "orderId"))
+	if err != nil {
+		return nil, err
+	}
+	return orders.ShippingOptions(database.GetDB(), order.ID)
+}
+
+func setProductDimensionsResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageCatalog); err != nil {
+		return nil, err
+	}
+	productID := intArg(p.Args, "productId")
+	weight := floatArg(p.Args, "weight")
+	length, _ := p.Args["length"].(float64)
+	width, _ := p.Args["width"].(float64)
+	height, _ := p.Args["height"].(float64)
+	return database.SetProductDimensions(database.GetDB(), productID, weight, length, width, height)
+}
+
+func createShippingMethodResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManagePricing); err != nil {
+		return nil, err
+	}
+	method := &database.ShippingMethod{
+		Name:   stringArg(p.Args, "name"),
+		Type:   stringArg(p.Args, "type"),
+		Active: true,
+	}
+	method.Carrier, _ = p.Args["carrier"].(string)
+	method.BaseRate, _ = p.Args["baseRate"].(float64)
+	method.RatePerKg, _ = p.Args["ratePerKg"].(float64)
+	method.FreeThreshold, _ = p.Args["freeThreshold"].(float64)
+	return database.CreateShippingMethod(database.GetDB(), method)
+}
+
+func setShippingMethodActiveResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManagePricing); err != nil {
+		return nil, err
+	}
+	return database.SetShippingMethodActive(database.GetDB(), intArg(p.Args, "id"), boolArg(p.Args, "active"))
+}
+
+func setShippingMethodResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, err := authorizeOrder(p.Context, intArg(p.Args, "orderId"))
+	if err != nil {
+		return nil, err
+	}
+	return orders.SetShippingMethod(database.GetDB(), order.ID, intArg(p.Args, "methodId"))
+}
+
+func createShipmentResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	orderID := intArg(p.Args, "orderId")
+	carrier, _ := p.Args["carrier"].(string)
+	trackingNumber, _ := p.Args["trackingNumber"].(string)
+
+	var items []database.ShipmentItem
+	for _, item := range objectsArg(p.Args, "items") {
+		items = append(items, database.ShipmentItem{
+			OrderItemID: intArg(item, "orderItemId"),
+			Quantity:    intArg(item, "quantity"),
+		})
+	}
+
+	return orders.CreateShipment(database.GetDB(), orderID, carrier, trackingNumber, items)
+}
+
+func markShipmentDeliveredResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	return orders.MarkShipmentDelivered(database.GetDB(), intArg(p.Args, "id"))
+}
+
+// Payment resolvers
+func payOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, err := authorizeOrder(p.Context, intArg(p.Args, "orderId"))
+	if err != nil {
+		return nil, err
+	}
+	token := stringArg(p.Args, "paymentToken")
+	capture, _ := p.Args["capture"].(bool)
+	return orders.PayOrder(database.GetDB(), order.ID, token, capture)
+}
+
+func capturePaymentResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	amount, _ := p.Args["amount"].(float64)
+	return orders.CapturePayment(database.GetDB(), intArg(p.Args, "paymentId"), amount)
+}
+
+// Return resolvers
+func getReturnsResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	status, _ := p.Args["status"].(string)
+	return database.GetReturns(database.GetDB(), status)
+}
+
+func requestReturnResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, err := authorizeOrder(p.Context, intArg(p.Args, "orderId"))
+	if err != nil {
+		return nil, err
+	}
+	reason := stringArg(p.Args, "reason")
+
+	var items []database.ReturnItem
+	for _, item := range objectsArg(p.Args, "items") {
+		items = append(items, database.ReturnItem{
+			OrderItemID: intArg(item, "orderItemId"),
+			Quantity:    intArg(item, "quantity"),
+		})
+	}
+
+	return orders.RequestReturn(database.GetDB(), order.ID, items, reason)
+}
+
+func approveReturnResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	return orders.ApproveReturn(database.GetDB(), intArg(p.Args, "id"))
+}
+
+func rejectReturnResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	note, _ := p.Args["note"].(string)
+	return orders.RejectReturn(database.GetDB(), intArg(p.Args, "id"), note)
+}
+
+func receiveReturnResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	var refundAmount *float64
+	if amount, ok := p.Args["refundAmount"].(float64); ok {
+		refundAmount = &amount
+	}
+	restock, _ := p.Args["restock"].(bool)
+	return orders.ReceiveReturn(database.GetDB(), intArg(p.Args, "id"), refundAmount, restock)
+}
+
+// Invoice resolvers
+func getInvoiceResolver(p graphql.ResolveParams) (interface{}, error) {
+	id, ok := p.Args["id"].(int)
+	if !ok {
+		return nil, apperr.Invalid("id", "invalid invoice ID")
+	}
+	if auth.UserFromContext(p.Context) == nil && auth.APIKeyFromContext(p.Context) == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	db := database.GetDB()
+	inv, err := database.GetInvoiceByID(db, id)
+	if err != nil {
+		return nil, err
+	}
+	order, err := database.GetOrderByID(db, inv.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOrderAccess(p.Context, order); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func issueInvoiceResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	return invoice.IssueForOrder(database.GetDB(), intArg(p.Args, "orderId"))
+}
+
+func getInvoicePDFURLResolver(p graphql.ResolveParams) (interface{}, error) {
+	if inv, ok := p.Source.(*database.Invoice); ok {
+		return fmt.Sprintf("/invoices/%d.pdf", inv.ID), nil
+	}
+	return nil, errors.New("failed to get invoice URL")
 }
 
-func getAllUsersResolver(p graphql.ResolveParams) (interface{}, error) {
-	return database.GetAllUsers(database.GetDB())
+func getInvoiceHTMLURLResolver(p graphql.ResolveParams) (interface{}, error) {
+	if inv, ok := p.Source.(*database.Invoice); ok {
+		return fmt.Sprintf("/invoices/%d.html", inv.ID), nil
+	}
+	return nil, errors.New("failed to get invoice URL")
 }
 
-func createUserResolver(p graphql.ResolveParams) (interface{}, error) {
-	name := p.Args["name"].(string)
-	email := p.Args["email"].(string)
-	password := p.Args["password"].(string)
+// OutboxEmail resolvers
+func getOutboxEmailsResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageNotifications); err != nil {
+		return nil, err
+	}
+	status, _ := p.Args["status"].(string)
+	first, _ := p.Args["first"].(int)
+	return database.GetOutboxEmails(database.GetDB(), status, first)
+}
 
-	return database.CreateUser(database.GetDB(), name, email, password)
+func retryEmailResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageNotifications); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	id := intArg(p.Args, "id")
+	if err := database.RetryEmail(db, id); err != nil {
+		return nil, err
+	}
+	notify.Wake()
+	return database.GetOutboxEmailByID(db, id)
 }
 
-// Product resolvers
-func getProductResolver(p graphql.ResolveParams) (interface{}, error) {
-	id, ok := p.Args["id"].(int)
-	if !ok {
-		return nil, errors.New("invalid product ID")
+// ApiKey resolvers
+func getAPIKeysResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageAPIKeys); err != nil {
+		return nil, err
 	}
-	return database.GetProductByID(database.GetDB(), id)
+	return database.GetAllAPIKeys(database.GetDB())
 }
 
-func getAllProductsResolver(p graphql.ResolveParams) (interface{}, error) {
-	return database.GetAllProducts(database.GetDB())
+func createAPIKeyResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageAPIKeys); err != nil {
+		return nil, err
+	}
+	var scopes []string
+	for _, v := range listArg(p.Args, "scopes") {
+		if scope, ok := v.(string); ok {
+			scopes = append(scopes, scope)
+		}
+	}
+	var expiresAt *time.Time
+	if t, err := time.Parse(time.RFC3339, stringArg(p.Args, "expiresAt")); err == nil {
+		expiresAt = &t
+	}
+
+	key, apiKey, err := auth.CreateAPIKey(database.GetDB(), auth.UserFromContext(p.Context), stringArg(p.Args, "name"), scopes, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"key":    key,
+		"apiKey": apiKey,
+	}, nil
 }
 
-func createProductResolver(p graphql.ResolveParams) (interface{}, error) {
-	name := p.Args["name"].(string)
-	description, _ := p.Args["description"].(string)
-	price := p.Args["price"].(float64)
-	inventory := p.Args["inventory"].(int)
+func revokeAPIKeyResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageAPIKeys); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	id := intArg(p.Args, "id")
+	if err := database.RevokeAPIKey(db, id); err != nil {
+		return nil, err
+	}
+	return database.GetAPIKeyByID(db, id)
+}
+
+func apiKeyFromSource(source interface{}) (*database.APIKey, bool) {
+	switch k := source.(type) {
+	case *database.APIKey:
+		return k, true
+	case database.APIKey:
+		return &k, true
+	}
+	return nil, false
+}
+
+// apiKeyTime formats an optional API key time like the other timestamps of the API
+func apiKeyTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func getExpiresAtFromAPIKeyResolver(p graphql.ResolveParams) (interface{}, error) {
+	if key, ok := apiKeyFromSource(p.Source); ok {
+		return apiKeyTime(key.ExpiresAt), nil
+	}
+	return nil, errors.New("failed to get expiry from API key")
+}
+
+func getLastUsedAtFromAPIKeyResolver(p graphql.ResolveParams) (interface{}, error) {
+	if key, ok := apiKeyFromSource(p.Source); ok {
+		return apiKeyTime(key.LastUsedAt), nil
+	}
+	return nil, errors.New("failed to get last use from API key")
+}
 
-	return database.CreateProduct(database.GetDB(), name, description, price, inventory)
+func getRevokedAtFromAPIKeyResolver(p graphql.ResolveParams) (interface{}, error) {
+	if key, ok := apiKeyFromSource(p.Source); ok {
+		return apiKeyTime(key.RevokedAt), nil
+	}
+	return nil, errors.New("failed to get revocation from API key")
+}
+
+func getCreatedAtFromAPIKeyResolver(p graphql.ResolveParams) (interface{}, error) {
+	if key, ok := apiKeyFromSource(p.Source); ok {
+		return apiKeyTime(&key.CreatedAt), nil
+	}
+	return nil, errors.New("failed to get creation time from API key")
 }
 
 // Order resolvers
+
+// authorizeOrder returns an order the request's user may act on: their own, or any order for
+// staff who manage orders
+func authorizeOrder(ctx context.Context, id int) (*database.Order, error) {
+	if auth.UserFromContext(ctx) == nil && auth.APIKeyFromContext(ctx) == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	order, err := database.GetOrderByID(database.GetDB(), id)
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.AuthorizeOwner(ctx, order.UserID, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// checkOrderAccess checks that the request's user may see an order, as for invoice downloads:
+// its customer or staff who manage orders. API keys need the orders scope.
+func checkOrderAccess(ctx context.Context, order *database.Order) error {
+	return auth.AuthorizeOwner(ctx, order.UserID, auth.PermManageOrders)
+}
+
 func getOrderResolver(p graphql.ResolveParams) (interface{}, error) {
 	id, ok := p.Args["id"].(int)
 	if !ok {
-		return nil, errors.New("invalid order ID")
+		return nil, apperr.Invalid("id", "invalid order ID")
+	}
+	if auth.UserFromContext(p.Context) == nil && auth.APIKeyFromContext(p.Context) == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	loaded, err := loadOrder(p.Context, id)
+	if err != nil {
+		return nil, err
+	}
+	order, ok := orderFromSource(loaded)
+	if !ok {
+		return nil, errors.New("failed to load order")
+	}
+	if err := checkOrderAccess(p.Context, order); err != nil {
+		return nil, err
 	}
-	return database.GetOrderByID(database.GetDB(), id)
+	return order, nil
 }
 
 func getAllOrdersResolver(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
 	return database.GetAllOrders()
 }
 
+func getCartResolver(p graphql.ResolveParams) (interface{}, error) {
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	return database.GetCartByUserID(database.GetDB(), user.ID)
+}
+
 func createOrderResolver(p graphql.ResolveParams) (interface{}, error) {
-	userID := p.Args["user_id"].(int)
-	status := p.Args["status"].(string)
-	total := p.Args["total"].(float64)
+	user := auth.UserFromContext(p.Context)
+	if user == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	country, _ := p.Args["country"].(string)
+	region, _ := p.Args["region"].(string)
+
+	db := database.GetDB()
+	order, err := database.CreateOrder(db, user.ID)
+	if err != nil || country == "" {
+		return order, err
+	}
+	err = database.SetOrderLocation(db, order.ID, strings.ToUpper(country), strings.ToUpper(region))
+	if err != nil {
+		return nil, err
+	}
+	return database.GetOrderByID(db, order.ID)
+}
 
-	return database.CreateOrder(database.GetDB(), userID, status, total)
+func placeOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, err := authorizeOrder(p.Context, intArg(p.Args, "orderId"))
+	if err != nil {
+		return nil, err
+	}
+	shippingAddressID, _ := p.Args["shippingAddressId"].(int)
+	billingAddressID, _ := p.Args["billingAddressId"].(int)
+	return orders.PlaceOrder(database.GetDB(), order.ID, shippingAddressID, billingAddressID)
 }
 
 func updateOrderStatusResolver(p graphql.ResolveParams) (interface{}, error) {
-	id := p.Args["id"].(int)
-	status := p.Args["status"].(string)
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	// Validation leaves delivered as the only status that is set by hand
+	return orders.MarkOrderDelivered(database.GetDB(), intArg(p.Args, "id"))
+}
 
-	db := database.GetDB()
-	_, err := db.Exec("UPDATE orders SET status = ? WHERE id = ?", status, id)
+func cancelOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, err := authorizeOrder(p.Context, intArg(p.Args, "id"))
 	if err != nil {
 		return nil, err
 	}
-
-	return database.GetOrderByID(db, id)
+	return orders.CancelOrder(database.GetDB(), order.ID, stringArg(p.Args, "reason"))
 }
 
 // OrderItem resolvers
 func addOrderItemResolver(p graphql.ResolveParams) (interface{}, error) {
-	orderID := p.Args["order_id"].(int)
-	productID := p.Args["product_id"].(int)
-	quantity := p.Args["quantity"].(int)
-	price := p.Args["price"].(float64)
+	order, err := authorizeOrder(p.Context, intArg(p.Args, "order_id"))
+	if err != nil {
+		return nil, err
+	}
+	productID := intArg(p.Args, "product_id")
+	quantity := intArg(p.Args, "quantity")
 
-	// Check if product has enough inventory
+	// Items are always sold at the catalog price
 	db := database.GetDB()
 	product, err := database.GetProductByID(db, productID)
 	if err != nil {
 		return nil, err
 	}
 
-	if product.Inventory < quantity {
-		return nil, fmt.Errorf("not enough inventory for product %d", productID)
+	return orders.AddOrderItem(db, order.ID, productID, quantity, product.Price)
+}
+
+// Subscription resolvers
+
+// subscribeOrderStatusChanged streams the status changes of an order to its customer and to
+// staff who manage orders
+func subscribeOrderStatusChanged(p graphql.ResolveParams) (interface{}, error) {
+	order, err := database.GetOrderByID(database.GetDB(), intArg(p.Args, "orderId"))
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		if user := auth.UserFromContext(p.Context); user == nil || user.ID != order.UserID {
+			return nil, err
+		}
+	}
+	return eventStream(p.Context, func(e events.Event) bool {
+		return e.OrderID == order.ID
+	}, events.OrderStatusChanged), nil
+}
+
+func subscribeOrderPlaced(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	return eventStream(p.Context, nil, events.OrderPlaced), nil
+}
+
+// subscribeLowStock streams changes that leave a product with threshold units or fewer
+func subscribeLowStock(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.Authorize(p.Context, auth.PermManageCatalog); err != nil {
+		return nil, err
+	}
+	threshold := intArg(p.Args, "threshold")
+	if threshold < 0 {
+		return nil, apperr.Invalid("threshold", "threshold must not be negative")
+	}
+	return eventStream(p.Context, func(e events.Event) bool {
+		return e.Inventory <= threshold
+	}, events.StockChanged), nil
+}
+
+// eventStream relays the events of the given kinds that accept lets through, or all of them
+// if it is nil, until ctx is done. An SSE request resumes after its Last-Event-ID and is
+// told the ID of each event (see sse.go).
+func eventStream(ctx context.Context, accept func(events.Event) bool, kinds ...string) chan interface{} {
+	stream := make(chan interface{})
+	cursor := eventCursorFromContext(ctx)
+	var subscription <-chan events.Event
+	if cursor != nil && cursor.after > 0 {
+		subscription = events.SubscribeAfter(ctx, cursor.after, kinds...)
+	} else {
+		subscription = events.Subscribe(ctx, kinds...)
+	}
+	go func() {
+		defer close(stream)
+		for e := range subscription {
+			if accept != nil && !accept(e) {
+				continue
+			}
+			if cursor != nil && !cursor.push(ctx, e.ID) {
+				return
+			}
+			select {
+			case stream <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return stream
+}
+
+// eventOrderResolver loads the order of an event. The status is the one the event reports,
+// which a later change or a replayed event could differ from.
+func eventOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	e, ok := p.Source.(events.Event)
+	if !ok {
+		return nil, errors.New("failed to get order from event")
+	}
+	order, err := database.GetOrderByID(database.GetDB(), e.OrderID)
+	if err != nil {
+		return nil, err
 	}
+	order.Status = e.Status
+	return order, nil
+}
 
-	return database.AddOrderItem(db, orderID, productID, quantity, price)
+func eventProductResolver(p graphql.ResolveParams) (interface{}, error) {
+	if e, ok := p.Source.(events.Event); ok {
+		return database.GetProductByID(database.GetDB(), e.ProductID)
+	}
+	return nil, errors.New("failed to get product from event")
 }
 
 // Relationship resolvers
 func getProductFromOrderItemResolver(p graphql.ResolveParams) (interface{}, error) {
-	if orderItem, ok := p.Source.(*database.OrderItem); ok {
+	if orderItem, ok := orderItemFromSource(p.Source); ok {
 		return orderItem.Product, nil
 	}
 	return nil, errors.New("failed to get product from order item")
 }
 
+func getAppliedPromotionsFromOrderItemResolver(p graphql.ResolveParams) (interface{}, error) {
+	orderItem, ok := orderItemFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get applied promotions from order item")
+	}
+	return database.GetAppliedPromotionsByOrderItemID(database.GetDB(), orderItem.ID)
+}
+
+func getImagesFromProductResolver(p graphql.ResolveParams) (interface{}, error) {
+	product, ok := productFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get images from product")
+	}
+	return database.GetProductImagesByProductID(database.GetDB(), product.ID)
+}
+
+func getReviewsFromProductResolver(p graphql.ResolveParams) (interface{}, error) {
+	product, ok := productFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get reviews from product")
+	}
+	first, _ := p.Args["first"].(int)
+	offset, _ := p.Args["offset"].(int)
+	if first < 0 || offset < 0 {
+		return nil, apperr.Invalid("first", "first and offset must not be negative")
+	}
+	return database.GetReviewsByProductID(database.GetDB(), product.ID, first, offset)
+}
+
+func getUserFromReviewResolver(p graphql.ResolveParams) (interface{}, error) {
+	switch review := p.Source.(type) {
+	case *database.Review:
+		return loadUser(p.Context, review.UserID)
+	case database.Review:
+		return loadUser(p.Context, review.UserID)
+	}
+	return nil, errors.New("failed to get user from review")
+}
+
+func getAddressesFromUserResolver(p graphql.ResolveParams) (interface{}, error) {
+	user, ok := userFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get addresses from user")
+	}
+	// Staff who handle orders may look up a customer's address book
+	if err := auth.AuthorizeOwner(p.Context, user.ID, auth.PermManageOrders); err != nil {
+		return nil, err
+	}
+	return database.GetAddressesByUserID(database.GetDB(), user.ID)
+}
+
+func getWishlistsFromUserResolver(p graphql.ResolveParams) (interface{}, error) {
+	user, ok := userFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get wishlists from user")
+	}
+	if err := auth.AuthorizeOwner(p.Context, user.ID, auth.PermViewUsers); err != nil {
+		return nil, err
+	}
+	return database.GetWishlistsByUserID(database.GetDB(), user.ID)
+}
+
+func getShareTokenFromWishlistResolver(p graphql.ResolveParams) (interface{}, error) {
+	wishlist, ok := wishlistFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get share token from wishlist")
+	}
+	// Only the owner hands out the link; anyone else sees the list without it
+	user := auth.UserFromContext(p.Context)
+	if user == nil || user.ID != wishlist.UserID || wishlist.ShareToken == "" {
+		return nil, nil
+	}
+	return wishlist.ShareToken, nil
+}
+
+func getItemsFromWishlistResolver(p graphql.ResolveParams) (interface{}, error) {
+	switch wishlist := p.Source.(type) {
+	case *database.Wishlist:
+		return database.GetWishlistItemsByWishlistID(database.GetDB(), wishlist.ID)
+	case database.Wishlist:
+		return database.GetWishlistItemsByWishlistID(database.GetDB(), wishlist.ID)
+	}
+	return nil, errors.New("failed to get items from wishlist")
+}
+
+func getProductFromWishlistItemResolver(p graphql.ResolveParams) (interface{}, error) {
+	item, ok := wishlistItemFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get product from wishlist item")
+	}
+	return loadProduct(p.Context, item.ProductID)
+}
+
+func getPriceDropFromWishlistItemResolver(p graphql.ResolveParams) (interface{}, error) {
+	item, ok := wishlistItemFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get price drop from wishlist item")
+	}
+	return item.PriceDrop(), nil
+}
+
+func getPriceDroppedFromWishlistItemResolver(p graphql.ResolveParams) (interface{}, error) {
+	item, ok := wishlistItemFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get price drop from wishlist item")
+	}
+	return item.PriceDrop() > 0, nil
+}
+
+func getDiscountsFromOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, ok := orderFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get discounts from order")
+	}
+	return database.GetOrderDiscountsByOrderID(database.GetDB(), order.ID)
+}
+
+func getShippingAddressFromOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, ok := orderFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get shipping address from order")
+	}
+	return database.GetOrderAddress(database.GetDB(), order.ID, database.AddressKindShipping)
+}
+
+func getBillingAddressFromOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, ok := orderFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get billing address from order")
+	}
+	return database.GetOrderAddress(database.GetDB(), order.ID, database.AddressKindBilling)
+}
+
+func getShippingMethodFromOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, ok := orderFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get shipping method from order")
+	}
+	if order.ShippingMethodID == 0 {
+		return nil, nil
+	}
+	return database.GetShippingMethodByID(database.GetDB(), order.ShippingMethodID)
+}
+
+func getShipmentsFromOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, ok := orderFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get shipments from order")
+	}
+	return database.GetShipmentsByOrderID(database.GetDB(), order.ID)
+}
+
+func getOrderItemFromShipmentItemResolver(p graphql.ResolveParams) (interface{}, error) {
+	item, ok := p.Source.(database.ShipmentItem)
+	if !ok {
+		return nil, errors.New("failed to get order item from shipment item")
+	}
+	return database.GetOrderItemByID(database.GetDB(), item.OrderItemID)
+}
+
+func getPaymentsFromOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, ok := orderFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get payments from order")
+	}
+	return database.GetPaymentsByOrderID(database.GetDB(), order.ID)
+}
+
+func getOrderFromPaymentResolver(p graphql.ResolveParams) (interface{}, error) {
+	switch payment := p.Source.(type) {
+	case *database.Payment:
+		return loadOrder(p.Context, payment.OrderID)
+	case database.Payment:
+		return loadOrder(p.Context, payment.OrderID)
+	}
+	return nil, errors.New("failed to get order from payment")
+}
+
+func getReturnsFromOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, ok := orderFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get returns from order")
+	}
+	return database.GetReturnsByOrderID(database.GetDB(), order.ID)
+}
+
+func getOrderFromReturnResolver(p graphql.ResolveParams) (interface{}, error) {
+	switch ret := p.Source.(type) {
+	case *database.Return:
+		return loadOrder(p.Context, ret.OrderID)
+	case database.Return:
+		return loadOrder(p.Context, ret.OrderID)
+	}
+	return nil, errors.New("failed to get order from return")
+}
+
+func getOrderItemFromReturnItemResolver(p graphql.ResolveParams) (interface{}, error) {
+	item, ok := p.Source.(database.ReturnItem)
+	if !ok {
+		return nil, errors.New("failed to get order item from return item")
+	}
+	return database.GetOrderItemByID(database.GetDB(), item.OrderItemID)
+}
+
+func getInventoryMovementsFromProductResolver(p graphql.ResolveParams) (interface{}, error) {
+	product, ok := productFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get inventory movements from product")
+	}
+	first, _ := p.Args["first"].(int)
+	return database.GetInventoryMovementsByProductID(database.GetDB(), product.ID, first)
+}
+
+func getInvoiceFromOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, ok := orderFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get invoice from order")
+	}
+	if err := checkOrderAccess(p.Context, order); err != nil {
+		return nil, err
+	}
+	inv, err := database.GetInvoiceByOrderID(database.GetDB(), order.ID)
+	if err != nil || inv == nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func getTaxBreakdownFromOrderResolver(p graphql.ResolveParams) (interface{}, error) {
+	order, ok := orderFromSource(p.Source)
+	if !ok {
+		return nil, errors.New("failed to get tax breakdown from order")
+	}
+	return database.GetOrderTaxBreakdown(database.GetDB(), order.ID)
+}
+
 func getItemsFromOrderResolver(p graphql.ResolveParams) (interface{}, error) {
 	if order, ok := p.Source.(*database.Order); ok {
 		return order.Items, nil
 	}
 	return nil, errors.New("failed to get items from order")
 }
+
+// orderFromSource returns the order a field is being resolved on
+func orderFromSource(source interface{}) (*database.Order, bool) {
+	switch order := source.(type) {
+	case *database.Order:
+		return order, order != nil
+	case database.Order:
+		return &order, true
+	}
+	return nil, false
+}
+
+// orderItemFromSource returns the order item a field is being resolved on
+func orderItemFromSource(source interface{}) (*database.OrderItem, bool) {
+	switch item := source.(type) {
+	case *database.OrderItem:
+		return item, item != nil
+	case database.OrderItem:
+		return &item, true
+	}
+	return nil, false
+}
+
+// userFromSource returns the user a field is being resolved on
+func userFromSource(source interface{}) (*database.User, bool) {
+	switch user := source.(type) {
+	case *database.User:
+		return user, user != nil
+	case database.User:
+		return &user, true
+	}
+	return nil, false
+}
+
+// wishlistFromSource returns the wishlist a field is being resolved on
+func wishlistFromSource(source interface{}) (*database.Wishlist, bool) {
+	switch wishlist := source.(type) {
+	case *database.Wishlist:
+		return wishlist, wishlist != nil
+	case database.Wishlist:
+		return &wishlist, true
+	}
+	return nil, false
+}
+
+// wishlistItemFromSource returns the wishlist item a field is being resolved on
+func wishlistItemFromSource(source interface{}) (*database.WishlistItem, bool) {
+	switch item := source.(type) {
+	case *database.WishlistItem:
+		return item, item != nil
+	case database.WishlistItem:
+		return &item, true
+	}
+	return nil, false
+}
+
+// productFromSource returns the product a field is being resolved on.
+// Single lookups resolve to *database.Product while lists hold database.Product values.
+func productFromSource(source interface{}) (*database.Product, bool) {
+	switch product := source.(type) {
+	case *database.Product:
+		return product, product != nil
+	case database.Product:
+		return &product, true
+	}
+	return nil, false
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// imageFromSource returns the product image a field is being resolved on
+func imageFromSource(source interface{}) (*database.ProductImage, bool) {
+	switch image := source.(type) {
+	case *database.ProductImage:
+		return image, image != nil
+	case database.ProductImage:
+		return &image, true
+	}
+	return nil, false
+}
+
+// blobURL returns the public URL of a stored object
+func blobURL(key string) interface{} {
+	store := storage.GetStore()
+	if store == nil {
+		return nil
+	}
+	return store.URL(key)
+}
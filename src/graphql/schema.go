@@ -1,6 +1,8 @@
 package graphql
 
 import (
+	"log"
+
 	"github.com/graphql-go/graphql"
 )
 
@@ -18,8 +20,9 @@ var rootQuery = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: getUserResolver,
 		},
 		"users": &graphql.Field{
-			Type:    graphql.NewList(userType),
-			Resolve: getAllUsersResolver,
+			Type:        graphql.NewList(userType),
+			Description: "Every user; admins only",
+			Resolve:     getAllUsersResolver,
 		},
 		"product": &graphql.Field{
 			Type: productType,
@@ -44,8 +47,118 @@ var rootQuery = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: getOrderResolver,
 		},
 		"orders": &graphql.Field{
-			Type:    graphql.NewList(orderType),
-			Resolve: getAllOrdersResolver,
+			Type:        graphql.NewList(orderType),
+			Description: "Every order; requires orders:write",
+			Resolve:     getAllOrdersResolver,
+		},
+		"cart": &graphql.Field{
+			Type:        orderType,
+			Description: "The logged-in user's cart",
+			Resolve:     getCartResolver,
+		},
+		"wishlist": &graphql.Field{
+			Type:        wishlistType,
+			Description: "A wishlist of the logged-in user; others' shared lists are read with sharedWishlist",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: getWishlistResolver,
+		},
+		"sharedWishlist": &graphql.Field{
+			Type: wishlistType,
+			Args: graphql.FieldConfigArgument{
+				"token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: getSharedWishlistResolver,
+		},
+		"coupons": &graphql.Field{
+			Type:        graphql.NewList(couponType),
+			Description: "Every coupon code; requires pricing:write",
+			Resolve:     getAllCouponsResolver,
+		},
+		"coupon": &graphql.Field{
+			Type: couponType,
+			Args: graphql.FieldConfigArgument{
+				"code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: getCouponResolver,
+		},
+		"promotions": &graphql.Field{
+			Type:    graphql.NewList(promotionType),
+			Resolve: getAllPromotionsResolver,
+		},
+		"taxRates": &graphql.Field{
+			Type:    graphql.NewList(taxRateType),
+			Resolve: getTaxRatesResolver,
+		},
+		"shippingMethods": &graphql.Field{
+			Type:    graphql.NewList(shippingMethodType),
+			Resolve: getShippingMethodsResolver,
+		},
+		"shippingOptions": &graphql.Field{
+			Type:        graphql.NewList(shippingOptionType),
+			Description: "Quotes every active shipping method for an order, cheapest first",
+			Args: graphql.FieldConfigArgument{
+				"orderId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: getShippingOptionsResolver,
+		},
+		"returns": &graphql.Field{
+			Type: graphql.NewList(returnType),
+			Args: graphql.FieldConfigArgument{
+				"status": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Only returns with this status, e.g. requested",
+				},
+			},
+			Resolve: getReturnsResolver,
+		},
+		"me": &graphql.Field{
+			Type:        userType,
+			Description: "The user the request is authenticated as, or null",
+			Resolve:     getMeResolver,
+		},
+		"invoice": &graphql.Field{
+			Type: invoiceType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: getInvoiceResolver,
+		},
+		"outboxEmails": &graphql.Field{
+			Type:        graphql.NewList(outboxEmailType),
+			Description: "Queued and sent emails, newest first (staff only)",
+			Args: graphql.FieldConfigArgument{
+				"status": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Only emails with this status: pending, sent or failed",
+				},
+				"first": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: 50,
+				},
+			},
+			Resolve: getOutboxEmailsResolver,
+		},
+		"apiKeys": &graphql.Field{
+			Type:        graphql.NewList(apiKeyType),
+			Description: "All API keys, newest first, including revoked and expired ones (admin only)",
+			Resolve:     getAPIKeysResolver,
+		},
+		"wishlistPriceDrops": &graphql.Field{
+			Type:        graphql.NewList(wishlistItemType),
+			Description: "Items on the logged-in user's wishlists that are cheaper than when they were saved",
+			Resolve:     getWishlistPriceDropsResolver,
 		},
 	},
 })
@@ -69,6 +182,99 @@ var rootMutation = graphql.NewObject(graphql.ObjectConfig{
 			},
 			Resolve: createUserResolver,
 		},
+		"login": &graphql.Field{
+			Type: authPayloadType,
+			Args: graphql.FieldConfigArgument{
+				"email": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"password": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"otp": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Authenticator or recovery code, required when two-factor authentication is enabled",
+				},
+			},
+			Resolve: loginResolver,
+		},
+		"logout": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Ends the session the request is authenticated with",
+			Resolve:     logoutResolver,
+		},
+		"enrollTwoFactor": &graphql.Field{
+			Type:        twoFactorEnrollmentType,
+			Description: "Starts two-factor enrollment for the logged-in user with a new TOTP secret",
+			Resolve:     enrollTwoFactorResolver,
+		},
+		"confirmTwoFactor": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "Enables two-factor authentication with a code from the authenticator app and returns recovery codes",
+			Args: graphql.FieldConfigArgument{
+				"code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: confirmTwoFactorResolver,
+		},
+		"disableTwoFactor": &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: disableTwoFactorResolver,
+		},
+		"regenerateRecoveryCodes": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "Replaces the logged-in user's recovery codes",
+			Args: graphql.FieldConfigArgument{
+				"code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: regenerateRecoveryCodesResolver,
+		},
+		"requestPasswordReset": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Emails a password reset link if an account uses this address; always returns true",
+			Args: graphql.FieldConfigArgument{
+				"email": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: requestPasswordResetResolver,
+		},
+		"resetPassword": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Sets a new password with the token from a reset email and logs out every session",
+			Args: graphql.FieldConfigArgument{
+				"token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"newPassword": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: resetPasswordResolver,
+		},
+		"verifyEmail": &graphql.Field{
+			Type:        userType,
+			Description: "Confirms an email address with the token from a verification email",
+			Args: graphql.FieldConfigArgument{
+				"token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: verifyEmailResolver,
+		},
+		"resendVerificationEmail": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Sends the logged-in user a new verification link",
+			Resolve:     resendVerificationEmailResolver,
+		},
 		"createProduct": &graphql.Field{
 			Type: productType,
 			Args: graphql.FieldConfigArgument{
@@ -78,6 +284,13 @@ var rootMutation = graphql.NewObject(graphql.ObjectConfig{
 				"description": &graphql.ArgumentConfig{
 					Type: graphql.String,
 				},
+				"category": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"taxClass": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Tax class used to look up tax rates; defaults to standard",
+				},
 				"price": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Float),
 				},
@@ -87,17 +300,137 @@ var rootMutation = graphql.NewObject(graphql.ObjectConfig{
 			},
 			Resolve: createProductResolver,
 		},
-		"createOrder": &graphql.Field{
-			Type: orderType,
+		"uploadProductImage": &graphql.Field{
+			Type: productImageType,
 			Args: graphql.FieldConfigArgument{
-				"user_id": &graphql.ArgumentConfig{
+				"productId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Int),
 				},
-				"status": &graphql.ArgumentConfig{
+				"file": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(uploadScalar),
+				},
+			},
+			Resolve: uploadProductImageResolver,
+		},
+		"addReview": &graphql.Field{
+			Type:        reviewType,
+			Description: "Review a product as the logged-in user, who must have had it delivered",
+			Args: graphql.FieldConfigArgument{
+				"productId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"rating": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"title": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"body": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+			},
+			Resolve: addReviewResolver,
+		},
+		"updateReview": &graphql.Field{
+			Type: reviewType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"rating": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"title": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"body": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+			},
+			Resolve: updateReviewResolver,
+		},
+		"deleteReview": &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: deleteReviewResolver,
+		},
+		"createWishlist": &graphql.Field{
+			Type:        wishlistType,
+			Description: "Create a wishlist for the logged-in user",
+			Args: graphql.FieldConfigArgument{
+				"name": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
-				"total": &graphql.ArgumentConfig{
-					Type: graphql.NewNonNull(graphql.Float),
+			},
+			Resolve: createWishlistResolver,
+		},
+		"addToWishlist": &graphql.Field{
+			Type: wishlistItemType,
+			Args: graphql.FieldConfigArgument{
+				"wishlistId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"productId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: addToWishlistResolver,
+		},
+		"removeFromWishlist": &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"itemId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: removeFromWishlistResolver,
+		},
+		"moveWishlistItemToCart": &graphql.Field{
+			Type: orderType,
+			Args: graphql.FieldConfigArgument{
+				"itemId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"quantity": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: 1,
+				},
+			},
+			Resolve: moveWishlistItemToCartResolver,
+		},
+		"shareWishlist": &graphql.Field{
+			Type: wishlistType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: shareWishlistResolver,
+		},
+		"unshareWishlist": &graphql.Field{
+			Type: wishlistType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: unshareWishlistResolver,
+		},
+		"createOrder": &graphql.Field{
+			Type:        orderType,
+			Description: "Create an empty cart for the logged-in user",
+			Args: graphql.FieldConfigArgument{
+				"country": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "ISO country code the order is taxed in",
+				},
+				"region": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "State or province the order is taxed in",
 				},
 			},
 			Resolve: createOrderResolver,
@@ -114,14 +447,462 @@ var rootMutation = graphql.NewObject(graphql.ObjectConfig{
 				"quantity": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Int),
 				},
-				"price": &graphql.ArgumentConfig{
-					Type: graphql.NewNonNull(graphql.Float),
-				},
 			},
 			Resolve: addOrderItemResolver,
 		},
-		"updateOrderStatus": &graphql.Field{
+		"createCoupon": &graphql.Field{
+			Type: couponType,
+			Args: graphql.FieldConfigArgument{
+				"code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"type": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(couponTypeEnum),
+				},
+				"value": &graphql.ArgumentConfig{
+					Type:        graphql.Float,
+					Description: "Percentage (0-100) or fixed amount; ignored for free shipping",
+				},
+				"description": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"startsAt": &graphql.ArgumentConfig{
+					Type: graphql.DateTime,
+				},
+				"endsAt": &graphql.ArgumentConfig{
+					Type: graphql.DateTime,
+				},
+				"maxUses": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Total number of orders the code can be used on; 0 means unlimited",
+				},
+				"maxUsesPerUser": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Number of orders each customer can use the code on; 0 means unlimited",
+				},
+				"minOrderValue": &graphql.ArgumentConfig{
+					Type: graphql.Float,
+				},
+				"productIds": &graphql.ArgumentConfig{
+					Type: graphql.NewList(graphql.NewNonNull(graphql.Int)),
+				},
+				"categories": &graphql.ArgumentConfig{
+					Type: graphql.NewList(graphql.NewNonNull(graphql.String)),
+				},
+			},
+			Resolve: createCouponResolver,
+		},
+		"setCouponActive": &graphql.Field{
+			Type: couponType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"active": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Boolean),
+				},
+			},
+			Resolve: setCouponActiveResolver,
+		},
+		"createPromotion": &graphql.Field{
+			Type: promotionType,
+			Args: graphql.FieldConfigArgument{
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"type": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(promotionTypeEnum),
+				},
+				"products": &graphql.ArgumentConfig{
+					Type:        graphql.NewList(graphql.NewNonNull(promotionProductInput)),
+					Description: "Products the promotion applies to; for bundles, the units of each product in one bundle",
+				},
+				"buyQuantity": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"getQuantity": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"tiers": &graphql.ArgumentConfig{
+					Type: graphql.NewList(graphql.NewNonNull(promotionTierInput)),
+				},
+				"bundlePrice": &graphql.ArgumentConfig{
+					Type: graphql.Float,
+				},
+				"startsAt": &graphql.ArgumentConfig{
+					Type: graphql.DateTime,
+				},
+				"endsAt": &graphql.ArgumentConfig{
+					Type: graphql.DateTime,
+				},
+			},
+			Resolve: createPromotionResolver,
+		},
+		"setPromotionActive": &graphql.Field{
+			Type: promotionType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"active": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Boolean),
+				},
+			},
+			Resolve: setPromotionActiveResolver,
+		},
+		"setTaxRate": &graphql.Field{
+			Type: taxRateType,
+			Args: graphql.FieldConfigArgument{
+				"country": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"region": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Leave empty for a rate that applies to the whole country",
+				},
+				"taxClass": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"rate": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.Float),
+					Description: "Rate as a fraction, e.g. 0.2 for 20%",
+				},
+			},
+			Resolve: setTaxRateResolver,
+		},
+		"deleteTaxRate": &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: deleteTaxRateResolver,
+		},
+		"addAddress": &graphql.Field{
+			Type:        addressType,
+			Description: "Add an address to the logged-in user's address book",
+			Args: graphql.FieldConfigArgument{
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"line1": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"line2": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"city": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"region": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"postalCode": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"country": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"phone": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"isDefaultShipping": &graphql.ArgumentConfig{
+					Type: graphql.Boolean,
+				},
+				"isDefaultBilling": &graphql.ArgumentConfig{
+					Type: graphql.Boolean,
+				},
+			},
+			Resolve: addAddressResolver,
+		},
+		"updateAddress": &graphql.Field{
+			Type: addressType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"line1": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"line2": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"city": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"region": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"postalCode": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"country": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"phone": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"isDefaultShipping": &graphql.ArgumentConfig{
+					Type: graphql.Boolean,
+				},
+				"isDefaultBilling": &graphql.ArgumentConfig{
+					Type: graphql.Boolean,
+				},
+			},
+			Resolve: updateAddressResolver,
+		},
+		"deleteAddress": &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: deleteAddressResolver,
+		},
+		"placeOrder": &graphql.Field{
+			Type:        orderType,
+			Description: "Places a cart as a pending order, copying the shipping and billing addresses onto it",
+			Args: graphql.FieldConfigArgument{
+				"orderId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"shippingAddressId": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Defaults to the customer's default shipping address",
+				},
+				"billingAddressId": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Defaults to the customer's default billing address, then the shipping address",
+				},
+			},
+			Resolve: placeOrderResolver,
+		},
+		"setProductDimensions": &graphql.Field{
+			Type: productType,
+			Args: graphql.FieldConfigArgument{
+				"productId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"weight": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.Float),
+					Description: "Weight in kilograms",
+				},
+				"length": &graphql.ArgumentConfig{
+					Type:        graphql.Float,
+					Description: "Length in centimetres",
+				},
+				"width": &graphql.ArgumentConfig{
+					Type:        graphql.Float,
+					Description: "Width in centimetres",
+				},
+				"height": &graphql.ArgumentConfig{
+					Type:        graphql.Float,
+					Description: "Height in centimetres",
+				},
+			},
+			Resolve: setProductDimensionsResolver,
+		},
+		"createShippingMethod": &graphql.Field{
+			Type: shippingMethodType,
+			Args: graphql.FieldConfigArgument{
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"type": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(shippingMethodTypeEnum),
+				},
+				"carrier": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"baseRate": &graphql.ArgumentConfig{
+					Type:        graphql.Float,
+					Description: "Flat price, or handling fee for weight-based methods",
+				},
+				"ratePerKg": &graphql.ArgumentConfig{
+					Type:        graphql.Float,
+					Description: "Price per kilogram for WEIGHT_BASED methods",
+				},
+				"freeThreshold": &graphql.ArgumentConfig{
+					Type:        graphql.Float,
+					Description: "Order value from which FREE_OVER_THRESHOLD methods are free",
+				},
+			},
+			Resolve: createShippingMethodResolver,
+		},
+		"setShippingMethodActive": &graphql.Field{
+			Type: shippingMethodType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"active": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Boolean),
+				},
+			},
+			Resolve: setShippingMethodActiveResolver,
+		},
+		"setShippingMethod": &graphql.Field{
+			Type:        orderType,
+			Description: "Chooses the shipping method of an order and adds its cost to the total",
+			Args: graphql.FieldConfigArgument{
+				"orderId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"methodId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: setShippingMethodResolver,
+		},
+		"createShipment": &graphql.Field{
+			Type:        shipmentType,
+			Description: "Records a parcel sent for an order; without items, everything not yet shipped is included",
+			Args: graphql.FieldConfigArgument{
+				"orderId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"carrier": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Defaults to the carrier of the order's shipping method",
+				},
+				"trackingNumber": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"items": &graphql.ArgumentConfig{
+					Type: graphql.NewList(graphql.NewNonNull(shipmentItemInput)),
+				},
+			},
+			Resolve: createShipmentResolver,
+		},
+		"markShipmentDelivered": &graphql.Field{
+			Type: shipmentType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: markShipmentDeliveredResolver,
+		},
+		"payOrder": &graphql.Field{
+			Type:        paymentType,
+			Description: "Authorizes the total of a pending order; a declined attempt is returned with status failed",
+			Args: graphql.FieldConfigArgument{
+				"orderId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"paymentToken": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "Payment method token from the payment provider",
+				},
+				"capture": &graphql.ArgumentConfig{
+					Type:         graphql.Boolean,
+					DefaultValue: false,
+					Description:  "Collect the payment immediately instead of only authorizing it",
+				},
+			},
+			Resolve: payOrderResolver,
+		},
+		"capturePayment": &graphql.Field{
+			Type: paymentType,
+			Args: graphql.FieldConfigArgument{
+				"paymentId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"amount": &graphql.ArgumentConfig{
+					Type:        graphql.Float,
+					Description: "Defaults to the full authorized amount",
+				},
+			},
+			Resolve: capturePaymentResolver,
+		},
+		"requestReturn": &graphql.Field{
+			Type: returnType,
+			Args: graphql.FieldConfigArgument{
+				"orderId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"items": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(returnItemInput))),
+				},
+				"reason": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: requestReturnResolver,
+		},
+		"approveReturn": &graphql.Field{
+			Type: returnType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: approveReturnResolver,
+		},
+		"rejectReturn": &graphql.Field{
+			Type: returnType,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"note": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+			},
+			Resolve: rejectReturnResolver,
+		},
+		"receiveReturn": &graphql.Field{
+			Type:        returnType,
+			Description: "Records that the returned items arrived, restocks them and refunds the customer",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"refundAmount": &graphql.ArgumentConfig{
+					Type:        graphql.Float,
+					Description: "Defaults to what was paid for the returned units, or the full refundable amount once the whole order is returned",
+				},
+				"restock": &graphql.ArgumentConfig{
+					Type:         graphql.Boolean,
+					DefaultValue: true,
+					Description:  "Put the returned units back into inventory",
+				},
+			},
+			Resolve: receiveReturnResolver,
+		},
+		"applyCoupon": &graphql.Field{
+			Type:        orderType,
+			Description: "Applies a coupon code to an order or cart (carts are orders in the cart status)",
+			Args: graphql.FieldConfigArgument{
+				"orderId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: applyCouponResolver,
+		},
+		"removeCoupon": &graphql.Field{
 			Type: orderType,
+			Args: graphql.FieldConfigArgument{
+				"orderId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: removeCouponResolver,
+		},
+		"updateOrderStatus": &graphql.Field{
+			Type:        orderType,
+			Description: "Marks a shipped order delivered; every other status is set by its own mutation",
 			Args: graphql.FieldConfigArgument{
 				"id": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Int),
@@ -132,11 +913,118 @@ var rootMutation = graphql.NewObject(graphql.ObjectConfig{
 			},
 			Resolve: updateOrderStatusResolver,
 		},
+		"cancelOrder": &graphql.Field{
+			Type:        orderType,
+			Description: "Cancels an order that hasn't shipped, restocking its items and voiding or refunding its payments",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"reason": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: cancelOrderResolver,
+		},
+		"retryEmail": &graphql.Field{
+			Type:        outboxEmailType,
+			Description: "Queues an email that failed to send for another attempt (staff only)",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: retryEmailResolver,
+		},
+		"issueInvoice": &graphql.Field{
+			Type:        invoiceType,
+			Description: "Issues the invoice of a paid order that doesn't have one yet (staff only)",
+			Args: graphql.FieldConfigArgument{
+				"orderId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: issueInvoiceResolver,
+		},
+		"createApiKey": &graphql.Field{
+			Type:        createdAPIKeyType,
+			Description: "Issues an API key for another system (admin only)",
+			Args: graphql.FieldConfigArgument{
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"scopes": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+					Description: "Permissions of the key: catalog:write, pricing:write, orders:write, notifications:write",
+				},
+				"expiresAt": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "RFC 3339 time after which the key stops working; omit for a key that doesn't expire",
+				},
+			},
+			Resolve: createAPIKeyResolver,
+		},
+		"revokeApiKey": &graphql.Field{
+			Type:        apiKeyType,
+			Description: "Stops an API key from working (admin only)",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: revokeAPIKeyResolver,
+		},
 	},
 })
 
-// Create schema
-var Schema, _ = graphql.NewSchema(graphql.SchemaConfig{
-	Query:    rootQuery,
-	Mutation: rootMutation,
+// Define subscriptions, served over WebSocket (see websocket.go)
+var rootSubscription = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RootSubscription",
+	Fields: graphql.Fields{
+		"orderStatusChanged": &graphql.Field{
+			Type: orderType,
+			Args: graphql.FieldConfigArgument{
+				"orderId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Subscribe: subscribeOrderStatusChanged,
+			Resolve:   eventOrderResolver,
+		},
+		"orderPlaced": &graphql.Field{
+			Type:      orderType,
+			Subscribe: subscribeOrderPlaced,
+			Resolve:   eventOrderResolver,
+		},
+		"lowStock": &graphql.Field{
+			Type: productType,
+			Args: graphql.FieldConfigArgument{
+				"threshold": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: 5,
+				},
+			},
+			Subscribe: subscribeLowStock,
+			Resolve:   eventProductResolver,
+		},
+	},
 })
+
+// Schema is the GraphQL schema
+var Schema graphql.Schema
+
+// Create schema
+func init() {
+	linkTypes()
+	validateMutations(rootMutation)
+
+	var err error
+	Schema, err = graphql.NewSchema(graphql.SchemaConfig{
+		Query:        rootQuery,
+		Mutation:     rootMutation,
+		Subscription: rootSubscription,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create GraphQL schema: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-graphql-ecom/events"
+)
+
+// Requests to /graphql that accept text/event-stream are answered in the "distinct
+// connections" mode of the graphql-sse protocol, one operation per request:
+// https://github.com/enisdenjo/graphql-sse/blob/master/PROTOCOL.md
+
+const (
+	// sseHeartbeatInterval is how often an idle stream sends a comment, so proxies don't
+	// close it
+	sseHeartbeatInterval = 15 * time.Second
+	// eventIDBuffer bounds the event IDs waiting for their results
+	eventIDBuffer = 16
+)
+
+// acceptsEventStream reports whether a request asks for a graphql-sse response
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// eventCursor carries the bus event IDs of an SSE subscription. after is the Last-Event-ID
+// to resume from, and ids holds the ID of each event handed to the subscription, in order,
+// so every result can be sent with the ID of the event it was produced for.
+type eventCursor struct {
+	after uint64
+	ids   chan uint64
+}
+
+type eventCursorKey struct{}
+
+func withEventCursor(ctx context.Context, cursor *eventCursor) context.Context {
+	return context.WithValue(ctx, eventCursorKey{}, cursor)
+}
+
+func eventCursorFromContext(ctx context.Context) *eventCursor {
+	cursor, _ := ctx.Value(eventCursorKey{}).(*eventCursor)
+	return cursor
+}
+
+// push records the ID of an event before it is handed to the subscription
+func (c *eventCursor) push(ctx context.Context, id uint64) bool {
+	select {
+	case c.ids <- id:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// next returns the ID of the event the latest result was produced for. Results that don't
+// come from an event, such as errors starting the subscription, have none.
+func (c *eventCursor) next() (uint64, bool) {
+	select {
+	case id := <-c.ids:
+		return id, true
+	default:
+		return 0, false
+	}
+}
+
+// serveEventStream runs an operation and streams its results as "next" events followed by
+// "complete". Subscription events carry their bus event ID, and a client reconnecting with a
+// Last-Event-ID header is first sent the events it missed, as far as the bus still holds them.
+func serveEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	var data postData
+	switch r.Method {
+	case http.MethodGet:
+		var err error
+		if data, err = postDataFromQuery(r.URL.Query()); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The operation is limited and charged like any other; a subscription pays once, when it
+	// starts
+	analysis, err := prepare(&data, r.Method == http.MethodGet)
+	if err != nil {
+		err.write(w)
+		return
+	}
+	if !takeBudget(w, r, analysis.Cost) {
+		return
+	}
+
+	cursor := &eventCursor{ids: make(chan uint64, eventIDBuffer)}
+	// A Last-Event-ID from before the server restarted doesn't say what was missed, so the
+	// stream starts afresh
+	cursor.after, _ = events.ParseCursor(r.Header.Get("Last-Event-ID"))
+	results, errs := operationStream(withEventCursor(r.Context(), cursor), data)
+	if errs != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": errs})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Ask nginx not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				fmt.Fprint(w, "event: complete\ndata:\n\n")
+				flusher.Flush()
+				return
+			}
+			payload, _ := json.Marshal(result)
+			if id, ok := cursor.next(); ok {
+				fmt.Fprintf(w, "id: %s\n", events.Cursor(id))
+			}
+			fmt.Fprintf(w, "event: next\ndata: %s\n\n", payload)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ":\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
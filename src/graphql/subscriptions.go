@@ -0,0 +1,69 @@
+package graphql
+
+import (
+	"context"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// operationStream runs an operation for a streaming transport once prepare has accepted it.
+// A subscription produces a result for every event until ctx is done; a query or mutation
+// produces one result. An operation that doesn't parse or validate runs nothing and its errors
+// are returned instead.
+func operationStream(ctx context.Context, data postData) (<-chan *graphql.Result, []gqlerrors.FormattedError) {
+	doc, err := parser.Parse(parser.ParseParams{Source: data.Query})
+	if err != nil {
+		return nil, gqlerrors.FormatErrors(err)
+	}
+	if validation := graphql.ValidateDocument(&Schema, doc, nil); !validation.IsValid {
+		return nil, validation.Errors
+	}
+
+	params := graphql.Params{
+		Schema:         Schema,
+		RequestString:  data.Query,
+		VariableValues: data.Variables,
+		OperationName:  data.OperationName,
+		Context:        ctx,
+	}
+	results := make(chan *graphql.Result)
+	go func() {
+		defer close(results)
+		var source chan *graphql.Result
+		if operationType(doc, data.OperationName) == ast.OperationTypeSubscription {
+			source = graphql.Subscribe(params)
+		} else {
+			source = make(chan *graphql.Result, 1)
+			source <- graphql.Do(params)
+			close(source)
+		}
+		for result := range source {
+			formatErrors(result.Errors)
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				// The subscription stops once it sees ctx is done; let it finish sending
+				for range source {
+				}
+				return
+			}
+		}
+	}()
+	return results, nil
+}
+
+// operationType returns whether the named operation of a document, or its only one, is a
+// query, mutation or subscription
+func operationType(doc *ast.Document, operationName string) string {
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+				return op.Operation
+			}
+		}
+	}
+	return ""
+}
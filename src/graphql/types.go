@@ -1,12 +1,86 @@
 package graphql
 
 import (
+	"go-graphql-ecom/database"
 
 	"github.com/graphql-go/graphql"
 )
 
 
 // Define GraphQL types
+var addressType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Address",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"line1": &graphql.Field{
+			Type: graphql.String,
+		},
+		"line2": &graphql.Field{
+			Type: graphql.String,
+		},
+		"city": &graphql.Field{
+			Type: graphql.String,
+		},
+		"region": &graphql.Field{
+			Type: graphql.String,
+		},
+		"postalCode": &graphql.Field{
+			Type: graphql.String,
+		},
+		"country": &graphql.Field{
+			Type: graphql.String,
+		},
+		"phone": &graphql.Field{
+			Type: graphql.String,
+		},
+		"isDefaultShipping": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"isDefaultBilling": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+	},
+})
+
+var orderAddressType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "OrderAddress",
+	Description: "Address copied onto an order when it was placed",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"line1": &graphql.Field{
+			Type: graphql.String,
+		},
+		"line2": &graphql.Field{
+			Type: graphql.String,
+		},
+		"city": &graphql.Field{
+			Type: graphql.String,
+		},
+		"region": &graphql.Field{
+			Type: graphql.String,
+		},
+		"postalCode": &graphql.Field{
+			Type: graphql.String,
+		},
+		"country": &graphql.Field{
+			Type: graphql.String,
+		},
+		"phone": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
 var userType = graphql.NewObject(graphql.ObjectConfig{
 	Name: "User",
 	Fields: graphql.Fields{
@@ -19,9 +93,102 @@ var userType = graphql.NewObject(graphql.ObjectConfig{
 		"email": &graphql.Field{
 			Type: graphql.String,
 		},
+		"role": &graphql.Field{
+			Type: graphql.String,
+		},
+		"emailVerified": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"twoFactorEnabled": &graphql.Field{
+			Type:    graphql.Boolean,
+			Resolve: getTwoFactorEnabledFromUserResolver,
+		},
 		"created_at": &graphql.Field{
 			Type: graphql.String,
 		},
+		"addresses": &graphql.Field{
+			Type:    graphql.NewList(addressType),
+			Resolve: getAddressesFromUserResolver,
+		},
+	},
+})
+
+var productImageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ProductImage",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"filename": &graphql.Field{
+			Type: graphql.String,
+		},
+		"contentType": &graphql.Field{
+			Type: graphql.String,
+		},
+		"width": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"height": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"url": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: getImageURLResolver,
+		},
+		"thumbnailUrl": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: getThumbnailURLResolver,
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+// reviewerType is the public view of a review's author
+var reviewerType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Reviewer",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var reviewType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Review",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"productId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"userId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"rating": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"title": &graphql.Field{
+			Type: graphql.String,
+		},
+		"body": &graphql.Field{
+			Type: graphql.String,
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"updatedAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"user": &graphql.Field{
+			Type:    reviewerType,
+			Resolve: getUserFromReviewResolver,
+		},
 	},
 })
 
@@ -43,9 +210,70 @@ var productType = graphql.NewObject(graphql.ObjectConfig{
 		"inventory": &graphql.Field{
 			Type: graphql.Int,
 		},
+		"category": &graphql.Field{
+			Type: graphql.String,
+		},
+		"taxClass": &graphql.Field{
+			Type: graphql.String,
+		},
+		"weight": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Weight in kilograms",
+		},
+		"length": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Length in centimetres",
+		},
+		"width": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Width in centimetres",
+		},
+		"height": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Height in centimetres",
+		},
 		"created_at": &graphql.Field{
 			Type: graphql.String,
 		},
+		"images": &graphql.Field{
+			Type:    graphql.NewList(productImageType),
+			Resolve: getImagesFromProductResolver,
+		},
+		"averageRating": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"reviewCount": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"reviews": &graphql.Field{
+			Type: graphql.NewList(reviewType),
+			Args: graphql.FieldConfigArgument{
+				"first": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: 10,
+				},
+				"offset": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: 0,
+				},
+			},
+			Resolve: getReviewsFromProductResolver,
+		},
+	},
+})
+
+var appliedPromotionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "AppliedPromotion",
+	Fields: graphql.Fields{
+		"promotionId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"description": &graphql.Field{
+			Type: graphql.String,
+		},
+		"discount": &graphql.Field{
+			Type: graphql.Float,
+		},
 	},
 })
 
@@ -71,30 +299,901 @@ var orderItemType = graphql.NewObject(graphql.ObjectConfig{
 			Type: productType,
 			Resolve: getProductFromOrderItemResolver,
 		},
+		"taxName": &graphql.Field{
+			Type: graphql.String,
+		},
+		"taxRate": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"taxAmount": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"appliedPromotions": &graphql.Field{
+			Type:    graphql.NewList(appliedPromotionType),
+			Resolve: getAppliedPromotionsFromOrderItemResolver,
+		},
 	},
 })
 
-var orderType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "Order",
+var orderDiscountType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "OrderDiscount",
 	Fields: graphql.Fields{
 		"id": &graphql.Field{
 			Type: graphql.Int,
 		},
-		"user_id": &graphql.Field{
+		"source": &graphql.Field{
+			Type: graphql.String,
+		},
+		"code": &graphql.Field{
+			Type: graphql.String,
+		},
+		"description": &graphql.Field{
+			Type: graphql.String,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Float,
+		},
+	},
+})
+
+var taxRateType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "TaxRate",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
 			Type: graphql.Int,
 		},
-		"status": &graphql.Field{
+		"country": &graphql.Field{
+			Type: graphql.String,
+		},
+		"region": &graphql.Field{
+			Type: graphql.String,
+		},
+		"taxClass": &graphql.Field{
+			Type: graphql.String,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"rate": &graphql.Field{
+			Type: graphql.Float,
+		},
+	},
+})
+
+var taxBreakdownType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "TaxBreakdown",
+	Fields: graphql.Fields{
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"rate": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"taxableAmount": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Float,
+		},
+	},
+})
+
+var authPayloadType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "AuthPayload",
+	Fields: graphql.Fields{
+		"token": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Session token to send as \"Authorization: Bearer <token>\"",
+		},
+		"expiresAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"user": &graphql.Field{
+			Type: userType,
+		},
+	},
+})
+
+var twoFactorEnrollmentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "TwoFactorEnrollment",
+	Fields: graphql.Fields{
+		"secret": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Base32 secret for entering into an authenticator app by hand",
+		},
+		"otpauthUri": &graphql.Field{
+			Type: graphql.String,
+		},
+		"qrCodePng": &graphql.Field{
+			Type:        graphql.String,
+			Description: "QR code of otpauthUri as a PNG data URL",
+		},
+	},
+})
+
+var invoiceLineType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "InvoiceLine",
+	Fields: graphql.Fields{
+		"productId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"description": &graphql.Field{
+			Type: graphql.String,
+		},
+		"quantity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"unitPrice": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"taxName": &graphql.Field{
+			Type: graphql.String,
+		},
+		"taxRate": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"taxAmount": &graphql.Field{
+			Type: graphql.Float,
+		},
+	},
+})
+
+var invoiceType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Invoice",
+	Description: "Invoice of a paid order, copied from the order when it was issued",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"orderId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"number": &graphql.Field{
+			Type: graphql.String,
+		},
+		"customerName": &graphql.Field{
+			Type: graphql.String,
+		},
+		"customerEmail": &graphql.Field{
 			Type: graphql.String,
 		},
+		"lines": &graphql.Field{
+			Type: graphql.NewList(invoiceLineType),
+		},
+		"taxes": &graphql.Field{
+			Type: graphql.NewList(taxBreakdownType),
+		},
+		"billingAddress": &graphql.Field{
+			Type: orderAddressType,
+		},
+		"shippingAddress": &graphql.Field{
+			Type: orderAddressType,
+		},
+		"subtotal": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"discountTotal": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"shippingTotal": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"taxTotal": &graphql.Field{
+			Type: graphql.Float,
+		},
 		"total": &graphql.Field{
 			Type: graphql.Float,
 		},
-		"created_at": &graphql.Field{
+		"pricesIncludeTax": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"issuedAt": &graphql.Field{
 			Type: graphql.String,
 		},
-		"items": &graphql.Field{
-			Type: graphql.NewList(orderItemType),
-			Resolve: getItemsFromOrderResolver,
+		"pdfUrl": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Download link; requires the customer's or a staff member's session",
+			Resolve:     getInvoicePDFURLResolver,
+		},
+		"htmlUrl": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: getInvoiceHTMLURLResolver,
 		},
 	},
 })
+
+var orderType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Order",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"user_id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"status": &graphql.Field{
+			Type: graphql.String,
+		},
+		"country": &graphql.Field{
+			Type: graphql.String,
+		},
+		"region": &graphql.Field{
+			Type: graphql.String,
+		},
+		"subtotal": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"discountTotal": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"freeShipping": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"taxTotal": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"shippingTotal": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"shippingMethod": &graphql.Field{
+			Type:    shippingMethodType,
+			Resolve: getShippingMethodFromOrderResolver,
+		},
+		"shipments": &graphql.Field{
+			Type:    graphql.NewList(shipmentType),
+			Resolve: getShipmentsFromOrderResolver,
+		},
+		"invoice": &graphql.Field{
+			Type:    invoiceType,
+			Resolve: getInvoiceFromOrderResolver,
+		},
+		"cancellationReason": &graphql.Field{
+			Type: graphql.String,
+		},
+		"cancelledAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"pricesIncludeTax": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Whether the tax is already contained in the item prices rather than added to the total",
+		},
+		"total": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.String,
+		},
+		"items": &graphql.Field{
+			Type: graphql.NewList(orderItemType),
+			Resolve: getItemsFromOrderResolver,
+		},
+		"discounts": &graphql.Field{
+			Type:    graphql.NewList(orderDiscountType),
+			Resolve: getDiscountsFromOrderResolver,
+		},
+		"taxBreakdown": &graphql.Field{
+			Type:    graphql.NewList(taxBreakdownType),
+			Resolve: getTaxBreakdownFromOrderResolver,
+		},
+		"shippingAddress": &graphql.Field{
+			Type:    orderAddressType,
+			Resolve: getShippingAddressFromOrderResolver,
+		},
+		"billingAddress": &graphql.Field{
+			Type:    orderAddressType,
+			Resolve: getBillingAddressFromOrderResolver,
+		},
+	},
+})
+
+var couponTypeEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "CouponType",
+	Values: graphql.EnumValueConfigMap{
+		"PERCENTAGE": &graphql.EnumValueConfig{
+			Value:       database.CouponTypePercentage,
+			Description: "Takes a percentage off the eligible items",
+		},
+		"FIXED_AMOUNT": &graphql.EnumValueConfig{
+			Value:       database.CouponTypeFixedAmount,
+			Description: "Takes a fixed amount off the eligible items",
+		},
+		"FREE_SHIPPING": &graphql.EnumValueConfig{
+			Value:       database.CouponTypeFreeShipping,
+			Description: "Waives the shipping cost",
+		},
+	},
+})
+
+var couponType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Coupon",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"code": &graphql.Field{
+			Type: graphql.String,
+		},
+		"description": &graphql.Field{
+			Type: graphql.String,
+		},
+		"type": &graphql.Field{
+			Type: couponTypeEnum,
+		},
+		"value": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"startsAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"endsAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"maxUses": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"maxUsesPerUser": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"minOrderValue": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"productIds": &graphql.Field{
+			Type: graphql.NewList(graphql.Int),
+		},
+		"categories": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+		"active": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var promotionTypeEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "PromotionType",
+	Values: graphql.EnumValueConfigMap{
+		"BUY_X_GET_Y": &graphql.EnumValueConfig{
+			Value:       database.PromotionTypeBuyXGetY,
+			Description: "Every buyQuantity units of a product earn getQuantity more for free",
+		},
+		"TIERED_PRICE": &graphql.EnumValueConfig{
+			Value:       database.PromotionTypeTieredPrice,
+			Description: "Lower unit prices once a quantity tier is reached",
+		},
+		"BUNDLE": &graphql.EnumValueConfig{
+			Value:       database.PromotionTypeBundle,
+			Description: "A fixed price for a set of products bought together",
+		},
+	},
+})
+
+var promotionProductType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PromotionProduct",
+	Fields: graphql.Fields{
+		"productId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"quantity": &graphql.Field{
+			Type: graphql.Int,
+		},
+	},
+})
+
+var promotionTierType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PromotionTier",
+	Fields: graphql.Fields{
+		"minQuantity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"unitPrice": &graphql.Field{
+			Type: graphql.Float,
+		},
+	},
+})
+
+var promotionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Promotion",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"type": &graphql.Field{
+			Type: promotionTypeEnum,
+		},
+		"active": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"startsAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"endsAt": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"buyQuantity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"getQuantity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"bundlePrice": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"products": &graphql.Field{
+			Type: graphql.NewList(promotionProductType),
+		},
+		"tiers": &graphql.Field{
+			Type: graphql.NewList(promotionTierType),
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var promotionProductInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "PromotionProductInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"productId": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+		"quantity": &graphql.InputObjectFieldConfig{
+			Type:         graphql.Int,
+			DefaultValue: 1,
+		},
+	},
+})
+
+var promotionTierInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "PromotionTierInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"minQuantity": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+		"unitPrice": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+	},
+})
+
+var wishlistItemType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "WishlistItem",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"wishlistId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"productId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"savedPrice": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"currentPrice": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"priceDrop": &graphql.Field{
+			Type:    graphql.Float,
+			Resolve: getPriceDropFromWishlistItemResolver,
+		},
+		"priceDropped": &graphql.Field{
+			Type:    graphql.Boolean,
+			Resolve: getPriceDroppedFromWishlistItemResolver,
+		},
+		"addedAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"product": &graphql.Field{
+			Type:    productType,
+			Resolve: getProductFromWishlistItemResolver,
+		},
+	},
+})
+
+var wishlistType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Wishlist",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"userId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"shareToken": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Token for the shared link, shown only to the owner",
+			Resolve:     getShareTokenFromWishlistResolver,
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"items": &graphql.Field{
+			Type:    graphql.NewList(wishlistItemType),
+			Resolve: getItemsFromWishlistResolver,
+		},
+	},
+})
+
+var shippingMethodTypeEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ShippingMethodType",
+	Values: graphql.EnumValueConfigMap{
+		"FLAT_RATE": &graphql.EnumValueConfig{
+			Value:       database.ShippingMethodFlatRate,
+			Description: "The same price for every order",
+		},
+		"WEIGHT_BASED": &graphql.EnumValueConfig{
+			Value:       database.ShippingMethodWeightBased,
+			Description: "A base rate plus a price per kilogram of chargeable weight",
+		},
+		"FREE_OVER_THRESHOLD": &graphql.EnumValueConfig{
+			Value:       database.ShippingMethodFreeOverThreshold,
+			Description: "A flat price that is waived once the order reaches freeThreshold",
+		},
+	},
+})
+
+var shippingMethodType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ShippingMethod",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"type": &graphql.Field{
+			Type: shippingMethodTypeEnum,
+		},
+		"carrier": &graphql.Field{
+			Type: graphql.String,
+		},
+		"baseRate": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"ratePerKg": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"freeThreshold": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"active": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+	},
+})
+
+var shippingOptionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ShippingOption",
+	Fields: graphql.Fields{
+		"method": &graphql.Field{
+			Type: shippingMethodType,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Float,
+		},
+	},
+})
+
+var shipmentItemType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ShipmentItem",
+	Fields: graphql.Fields{
+		"orderItemId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"quantity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"orderItem": &graphql.Field{
+			Type:    orderItemType,
+			Resolve: getOrderItemFromShipmentItemResolver,
+		},
+	},
+})
+
+var shipmentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Shipment",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"orderId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"carrier": &graphql.Field{
+			Type: graphql.String,
+		},
+		"trackingNumber": &graphql.Field{
+			Type: graphql.String,
+		},
+		"status": &graphql.Field{
+			Type: graphql.String,
+		},
+		"shippedAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"deliveredAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"items": &graphql.Field{
+			Type: graphql.NewList(shipmentItemType),
+		},
+	},
+})
+
+var shipmentItemInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ShipmentItemInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"orderItemId": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+		"quantity": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+	},
+})
+
+var paymentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Payment",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"orderId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"provider": &graphql.Field{
+			Type: graphql.String,
+		},
+		"reference": &graphql.Field{
+			Type: graphql.String,
+		},
+		"amount": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"capturedAmount": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"refundedAmount": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"status": &graphql.Field{
+			Type: graphql.String,
+		},
+		"failureReason": &graphql.Field{
+			Type: graphql.String,
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"updatedAt": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var returnItemType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ReturnItem",
+	Fields: graphql.Fields{
+		"orderItemId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"quantity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"orderItem": &graphql.Field{
+			Type:    orderItemType,
+			Resolve: getOrderItemFromReturnItemResolver,
+		},
+	},
+})
+
+var returnType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Return",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"orderId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"status": &graphql.Field{
+			Type: graphql.String,
+		},
+		"reason": &graphql.Field{
+			Type: graphql.String,
+		},
+		"note": &graphql.Field{
+			Type: graphql.String,
+		},
+		"refundAmount": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"updatedAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"items": &graphql.Field{
+			Type: graphql.NewList(returnItemType),
+		},
+	},
+})
+
+var returnItemInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ReturnItemInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"orderItemId": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+		"quantity": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+	},
+})
+
+var inventoryMovementType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "InventoryMovement",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"quantity": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "Change in stock; negative when units leave the warehouse",
+		},
+		"reason": &graphql.Field{
+			Type: graphql.String,
+		},
+		"orderId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"returnId": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var outboxEmailType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "OutboxEmail",
+	Description: "Email queued for sending, or the record of one that was sent",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"kind": &graphql.Field{
+			Type: graphql.String,
+		},
+		"recipient": &graphql.Field{
+			Type: graphql.String,
+		},
+		"subject": &graphql.Field{
+			Type: graphql.String,
+		},
+		"textBody": &graphql.Field{
+			Type: graphql.String,
+		},
+		"status": &graphql.Field{
+			Type: graphql.String,
+		},
+		"attempts": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"lastError": &graphql.Field{
+			Type: graphql.String,
+		},
+		"nextAttemptAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"sentAt": &graphql.Field{
+			Type: graphql.String,
+		},
+		"createdAt": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var apiKeyType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "ApiKey",
+	Description: "Key another system uses to call the API with the permissions in its scopes",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"prefix": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Start of the key, for telling keys apart",
+		},
+		"scopes": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+		"createdBy": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"expiresAt": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: getExpiresAtFromAPIKeyResolver,
+		},
+		"lastUsedAt": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: getLastUsedAtFromAPIKeyResolver,
+		},
+		"revokedAt": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: getRevokedAtFromAPIKeyResolver,
+		},
+		"createdAt": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: getCreatedAtFromAPIKeyResolver,
+		},
+	},
+})
+
+var createdAPIKeyType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CreatedApiKey",
+	Fields: graphql.Fields{
+		"key": &graphql.Field{
+			Type:        graphql.String,
+			Description: "The key to send as \"X-API-Key: <key>\"; it cannot be retrieved again",
+		},
+		"apiKey": &graphql.Field{
+			Type: apiKeyType,
+		},
+	},
+})
+
+// linkTypes adds fields that refer back to types defined above them. Declaring these
+// inline would create package initialization cycles, so they are attached before the
+// schema is built.
+func linkTypes() {
+	orderType.AddFieldConfig("returns", &graphql.Field{
+		Type:    graphql.NewList(returnType),
+		Resolve: getReturnsFromOrderResolver,
+	})
+	returnType.AddFieldConfig("order", &graphql.Field{
+		Type:    orderType,
+		Resolve: getOrderFromReturnResolver,
+	})
+	productType.AddFieldConfig("inventoryMovements", &graphql.Field{
+		Type: graphql.NewList(inventoryMovementType),
+		Args: graphql.FieldConfigArgument{
+			"first": &graphql.ArgumentConfig{
+				Type:         graphql.Int,
+				DefaultValue: 20,
+			},
+		},
+		Resolve: getInventoryMovementsFromProductResolver,
+	})
+	orderType.AddFieldConfig("payments", &graphql.Field{
+		Type:    graphql.NewList(paymentType),
+		Resolve: getPaymentsFromOrderResolver,
+	})
+	paymentType.AddFieldConfig("order", &graphql.Field{
+		Type:    orderType,
+		Resolve: getOrderFromPaymentResolver,
+	})
+	userType.AddFieldConfig("wishlists", &graphql.Field{
+		Type:    graphql.NewList(wishlistType),
+		Resolve: getWishlistsFromUserResolver,
+	})
+}
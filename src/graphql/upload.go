@@ -0,0 +1,138 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// maxUploadSize is the maximum size of a multipart request body
+const maxUploadSize = 32 << 20
+
+// Upload is a file sent with a GraphQL multipart request
+type Upload struct {
+	Filename    string
+	ContentType string
+	Size        int64
+	header      *multipart.FileHeader
+}
+
+// Open opens the uploaded file for reading
+func (u *Upload) Open() (multipart.File, error) {
+	return u.header.Open()
+}
+
+// ReadAll reads the whole uploaded file into memory
+func (u *Upload) ReadAll() ([]byte, error) {
+	f, err := u.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// uploadScalar is the Upload scalar from the GraphQL multipart request spec.
+// Values can only be supplied through variables mapped to multipart file fields.
+var uploadScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Upload",
+	Description: "A file uploaded with a GraphQL multipart request",
+	Serialize: func(value interface{}) interface{} {
+		if u, ok := value.(*Upload); ok {
+			return u.Filename
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		if u, ok := value.(*Upload); ok {
+			return u
+		}
+		return nil
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		return nil
+	},
+})
+
+// parseMultipartRequest decodes a request following the GraphQL multipart request spec
+// (https://github.com/jaydenseric/graphql-multipart-request-spec). The files are
+// placed into the operations at the paths listed in the "map" field.
+func parseMultipartRequest(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		return nil, fmt.Errorf("invalid multipart request: %v", err)
+	}
+
+	var operations interface{}
+	if err := json.Unmarshal([]byte(r.FormValue("operations")), &operations); err != nil {
+		return nil, errors.New("invalid multipart request: missing or malformed operations field")
+	}
+
+	var fileMap map[string][]string
+	if err := json.Unmarshal([]byte(r.FormValue("map")), &fileMap); err != nil {
+		return nil, errors.New("invalid multipart request: missing or malformed map field")
+	}
+
+	for field, paths := range fileMap {
+		headers := r.MultipartForm.File[field]
+		if len(headers) == 0 {
+			return nil, fmt.Errorf("invalid multipart request: file field %q is missing", field)
+		}
+		header := headers[0]
+		upload := &Upload{
+			Filename:    header.Filename,
+			ContentType: header.Header.Get("Content-Type"),
+			Size:        header.Size,
+			header:      header,
+		}
+		for _, path := range paths {
+			if err := setPath(operations, strings.Split(path, "."), upload); err != nil {
+				return nil, fmt.Errorf("invalid multipart request: %v", err)
+			}
+		}
+	}
+
+	return operations, nil
+}
+
+// setPath replaces the value found at path inside a decoded JSON document
+func setPath(doc interface{}, path []string, value interface{}) error {
+	if len(path) == 0 {
+		return errors.New("empty path")
+	}
+	key := path[0]
+	last := len(path) == 1
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[key]
+		if !ok {
+			return fmt.Errorf("path segment %q not found", key)
+		}
+		if last {
+			node[key] = value
+			return nil
+		}
+		return setPath(child, path[1:], value)
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(node) {
+			return fmt.Errorf("invalid index %q", key)
+		}
+		if last {
+			node[i] = value
+			return nil
+		}
+		return setPath(node[i], path[1:], value)
+	default:
+		return fmt.Errorf("path segment %q not found", key)
+	}
+}
@@ -0,0 +1,624 @@
+package graphql
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/graphql-go/graphql"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/auth"
+	"go-graphql-ecom/database"
+)
+
+// Mutation arguments are checked against the rules in mutationRules before the resolver
+// runs. Every problem with the input is reported in one VALIDATION error, with the
+// individual violations listed in its extensions.
+
+// rule checks the value of an argument. field is the path of the value, such as
+// items[0].quantity.
+type rule func(field string, value interface{}) []apperr.Violation
+
+// check looks at several arguments together, such as a start and end date
+type check func(args map[string]interface{}) []apperr.Violation
+
+// argRules are the rules for one argument, or for one field of an input object
+type argRules struct {
+	name  string
+	rules []rule
+}
+
+func arg(name string, rules ...rule) argRules {
+	return argRules{name: name, rules: rules}
+}
+
+// validate applies the rules to the argument if it was given. Only the first violation of
+// each argument is reported.
+func (a argRules) validate(prefix string, args map[string]interface{}) []apperr.Violation {
+	value, ok := args[a.name]
+	if !ok || value == nil {
+		return nil
+	}
+	return firstViolations(prefix+a.name, value, a.rules)
+}
+
+// firstViolations applies rules in order and returns the violations of the first that fails
+func firstViolations(field string, value interface{}, rules []rule) []apperr.Violation {
+	for _, r := range rules {
+		if violations := r(field, value); len(violations) > 0 {
+			return violations
+		}
+	}
+	return nil
+}
+
+// inputRules are the rules for the arguments of a mutation
+type inputRules struct {
+	args   []argRules
+	checks []check
+}
+
+func args(a ...argRules) inputRules {
+	return inputRules{args: a}
+}
+
+// also adds checks that look at several arguments
+func (r inputRules) also(checks ...check) inputRules {
+	r.checks = append(r.checks, checks...)
+	return r
+}
+
+func (r inputRules) validate(args map[string]interface{}) []apperr.Violation {
+	var violations []apperr.Violation
+	for _, a := range r.args {
+		violations = append(violations, a.validate("", args)...)
+	}
+	for _, c := range r.checks {
+		violations = append(violations, c(args)...)
+	}
+	return violations
+}
+
+// test makes a rule from a function that describes what is wrong with a value, or returns
+// an empty string
+func test(problem func(value interface{}) string) rule {
+	return func(field string, value interface{}) []apperr.Violation {
+		if p := problem(value); p != "" {
+			return []apperr.Violation{violation(field, p)}
+		}
+		return nil
+	}
+}
+
+func violation(field, problem string) apperr.Violation {
+	return apperr.Violation{Field: field, Message: field + " " + problem}
+}
+
+// number reads an Int or Float value
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// notBlank requires a string with more than whitespace, or a list with at least one element
+var notBlank = test(func(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return "must not be blank"
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return "must not be empty"
+		}
+	}
+	return ""
+})
+
+func minLength(n int) rule {
+	return test(func(value interface{}) string {
+		if s, ok := value.(string); ok && utf8.RuneCountInString(s) < n {
+			return fmt.Sprintf("must be at least %d characters", n)
+		}
+		return ""
+	})
+}
+
+func maxLength(n int) rule {
+	return test(func(value interface{}) string {
+		if s, ok := value.(string); ok && utf8.RuneCountInString(s) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+		return ""
+	})
+}
+
+// maxBytes limits the UTF-8 encoded length of a string, for values stored or hashed as bytes
+func maxBytes(n int) rule {
+	return test(func(value interface{}) string {
+		if s, ok := value.(string); ok && len(s) > n {
+			return fmt.Sprintf("must be at most %d bytes", n)
+		}
+		return ""
+	})
+}
+
+// email requires a bare address such as jane@example.com, without a display name
+var email = test(func(value interface{}) string {
+	s, _ := value.(string)
+	s = strings.TrimSpace(s)
+	address, err := mail.ParseAddress(s)
+	if err != nil || address.Address != s || !strings.Contains(s[strings.LastIndex(s, "@"):], ".") {
+		return "must be a valid email address"
+	}
+	return ""
+})
+
+// positiveID requires an ID of at least 1
+var positiveID = test(func(value interface{}) string {
+	if n, ok := value.(int); ok && n < 1 {
+		return "must be a positive ID"
+	}
+	return ""
+})
+
+var notNegative = test(func(value interface{}) string {
+	if n, ok := number(value); ok && n < 0 {
+		return "must not be negative"
+	}
+	return ""
+})
+
+var positive = test(func(value interface{}) string {
+	if n, ok := number(value); ok && n <= 0 {
+		return "must be positive"
+	}
+	return ""
+})
+
+func atLeast(min float64) rule {
+	return test(func(value interface{}) string {
+		if n, ok := number(value); ok && n < min {
+			return fmt.Sprintf("must be at least %g", min)
+		}
+		return ""
+	})
+}
+
+func between(min, max float64) rule {
+	return test(func(value interface{}) string {
+		if n, ok := number(value); ok && (n < min || n > max) {
+			return fmt.Sprintf("must be between %g and %g", min, max)
+		}
+		return ""
+	})
+}
+
+func oneOf(values ...string) rule {
+	return test(func(value interface{}) string {
+		s, _ := value.(string)
+		for _, v := range values {
+			if s == v {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(values, ", ")
+	})
+}
+
+// countryCode requires a two-letter ISO 3166 country code, in either case
+var countryCode = test(func(value interface{}) string {
+	s, _ := value.(string)
+	if len(s) != 2 || !isLetter(s[0]) || !isLetter(s[1]) {
+		return "must be a two-letter country code"
+	}
+	return ""
+})
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+var rfc3339 = test(func(value interface{}) string {
+	s, _ := value.(string)
+	if _, err := time.Parse(time.RFC3339, s); err != nil {
+		return "must be an RFC 3339 time"
+	}
+	return ""
+})
+
+// each applies rules to the fields of every input object in a list
+func each(fields ...argRules) rule {
+	return func(field string, value interface{}) []apperr.Violation {
+		list, _ := value.([]interface{})
+		var violations []apperr.Violation
+		for i, v := range list {
+			object, _ := v.(map[string]interface{})
+			for _, f := range fields {
+				violations = append(violations, f.validate(fmt.Sprintf("%s[%d].", field, i), object)...)
+			}
+		}
+		return violations
+	}
+}
+
+// eachValue applies rules to every value in a list of scalars
+func eachValue(rules ...rule) rule {
+	return func(field string, value interface{}) []apperr.Violation {
+		list, _ := value.([]interface{})
+		var violations []apperr.Violation
+		for i, v := range list {
+			violations = append(violations, firstViolations(fmt.Sprintf("%s[%d]", field, i), v, rules)...)
+		}
+		return violations
+	}
+}
+
+// endsAfterStarts requires endsAt to be after startsAt when both are given
+func endsAfterStarts(args map[string]interface{}) []apperr.Violation {
+	startsAt, ok := args["startsAt"].(time.Time)
+	if !ok {
+		return nil
+	}
+	if endsAt, ok := args["endsAt"].(time.Time); ok && !endsAt.After(startsAt) {
+		return []apperr.Violation{violation("endsAt", "must be after startsAt")}
+	}
+	return nil
+}
+
+// couponValue checks the value of a coupon against its type
+func couponValue(args map[string]interface{}) []apperr.Violation {
+	value, _ := args["value"].(float64)
+	switch args["type"] {
+	case database.CouponTypePercentage:
+		if value <= 0 || value > 100 {
+			return []apperr.Violation{violation("value", "must be between 0 and 100 for percentage coupons")}
+		}
+	case database.CouponTypeFixedAmount:
+		if value <= 0 {
+			return []apperr.Violation{violation("value", "must be positive for fixed amount coupons")}
+		}
+	}
+	return nil
+}
+
+// promotionShape requires the arguments each type of promotion needs
+func promotionShape(args map[string]interface{}) []apperr.Violation {
+	var violations []apperr.Violation
+	switch args["type"] {
+	case database.PromotionTypeBuyXGetY:
+		for _, name := range []string{"buyQuantity", "getQuantity"} {
+			if _, ok := args[name].(int); !ok {
+				violations = append(violations, violation(name, "is required for buy X get Y promotions"))
+			}
+		}
+	case database.PromotionTypeTieredPrice:
+		if tiers, _ := args["tiers"].([]interface{}); len(tiers) == 0 {
+			violations = append(violations, violation("tiers", "are required for tiered price promotions"))
+		}
+	case database.PromotionTypeBundle:
+		if _, ok := args["bundlePrice"].(float64); !ok {
+			violations = append(violations, violation("bundlePrice", "is required for bundle promotions"))
+		}
+	}
+	return violations
+}
+
+var orderStatuses = []string{
+	database.OrderStatusCart,
+	database.OrderStatusPending,
+	database.OrderStatusAuthorized,
+	database.OrderStatusPaid,
+	database.OrderStatusPartiallyShipped,
+	database.OrderStatusShipped,
+	database.OrderStatusDelivered,
+	database.OrderStatusCancelled,
+	database.OrderStatusPartiallyRefunded,
+	database.OrderStatusRefunded,
+}
+
+// statusFlows says how an order reaches each status updateOrderStatus can't set, since setting
+// it directly would skip the stock, payment, shipment or refund work of that flow
+var statusFlows = map[string]string{
+	database.OrderStatusCart:              "cannot be set to cart, a placed order stays placed",
+	database.OrderStatusPending:           "cannot be set to pending, use placeOrder to place an order",
+	database.OrderStatusAuthorized:        "cannot be set to authorized, use payOrder to take a payment",
+	database.OrderStatusPaid:              "cannot be set to paid, use payOrder or capturePayment",
+	database.OrderStatusPartiallyShipped:  "cannot be set to partially_shipped, use createShipment",
+	database.OrderStatusShipped:           "cannot be set to shipped, use createShipment",
+	database.OrderStatusCancelled:         "cannot be set to cancelled, use cancelOrder to cancel an order",
+	database.OrderStatusPartiallyRefunded: "cannot be set to partially_refunded, use receiveReturn to refund",
+	database.OrderStatusRefunded:          "cannot be set to refunded, use receiveReturn to refund",
+}
+
+// manualStatus keeps updateOrderStatus to the statuses no other flow sets
+var manualStatus = test(func(value interface{}) string {
+	status, _ := value.(string)
+	return statusFlows[status]
+})
+
+// Lengths of text arguments
+const (
+	maxNameLength    = 100
+	maxTitleLength   = 200
+	maxTextLength    = 5000
+	maxEmailLength   = 254
+	maxCodeLength    = 50
+	maxTokenLength   = 255
+	maxPasswordBytes = 72 // bcrypt ignores anything longer
+)
+
+var (
+	passwordRules = []rule{minLength(auth.MinPasswordLength), maxBytes(maxPasswordBytes)}
+	emailRules    = []rule{notBlank, maxLength(maxEmailLength), email}
+	addressRules  = []argRules{
+		arg("name", notBlank, maxLength(maxNameLength)),
+		arg("line1", notBlank, maxLength(maxTitleLength)),
+		arg("line2", maxLength(maxTitleLength)),
+		arg("city", notBlank, maxLength(maxNameLength)),
+		arg("region", maxLength(maxNameLength)),
+		arg("postalCode", maxLength(20)),
+		arg("country", countryCode),
+		arg("phone", maxLength(30)),
+	}
+	quantityRules = []argRules{
+		arg("orderItemId", positiveID),
+		arg("quantity", atLeast(1)),
+	}
+)
+
+// mutationRules holds the rules for the arguments of every mutation that takes any
+var mutationRules = map[string]inputRules{
+	"createUser": args(
+		arg("name", notBlank, maxLength(maxNameLength)),
+		arg("email", emailRules...),
+		arg("password", passwordRules...),
+	),
+	"login": args(
+		arg("email", notBlank, maxLength(maxEmailLength)),
+		arg("password", notBlank, maxBytes(maxPasswordBytes)),
+		arg("otp", maxLength(maxCodeLength)),
+	),
+	"confirmTwoFactor":        args(arg("code", notBlank, maxLength(maxCodeLength))),
+	"disableTwoFactor":        args(arg("code", notBlank, maxLength(maxCodeLength))),
+	"regenerateRecoveryCodes": args(arg("code", notBlank, maxLength(maxCodeLength))),
+	"requestPasswordReset":    args(arg("email", emailRules...)),
+	"resetPassword": args(
+		arg("token", notBlank, maxLength(maxTokenLength)),
+		arg("newPassword", passwordRules...),
+	),
+	"verifyEmail": args(arg("token", notBlank, maxLength(maxTokenLength))),
+
+	"createProduct": args(
+		arg("name", notBlank, maxLength(maxTitleLength)),
+		arg("description", maxLength(maxTextLength)),
+		arg("category", maxLength(maxNameLength)),
+		arg("taxClass", maxLength(maxCodeLength)),
+		arg("price", notNegative),
+		arg("inventory", notNegative),
+	),
+	"uploadProductImage": args(arg("productId", positiveID)),
+	"setProductDimensions": args(
+		arg("productId", positiveID),
+		arg("weight", notNegative),
+		arg("length", notNegative),
+		arg("width", notNegative),
+		arg("height", notNegative),
+	),
+
+	"addReview": args(
+		arg("productId", positiveID),
+		arg("rating", between(1, 5)),
+		arg("title", maxLength(maxTitleLength)),
+		arg("body", maxLength(maxTextLength)),
+	),
+	"updateReview": args(
+		arg("id", positiveID),
+		arg("rating", between(1, 5)),
+		arg("title", maxLength(maxTitleLength)),
+		arg("body", maxLength(maxTextLength)),
+	),
+	"deleteReview": args(arg("id", positiveID)),
+
+	"createWishlist":     args(arg("name", notBlank, maxLength(maxNameLength))),
+	"addToWishlist":      args(arg("wishlistId", positiveID), arg("productId", positiveID)),
+	"removeFromWishlist": args(arg("itemId", positiveID)),
+	"moveWishlistItemToCart": args(
+		arg("itemId", positiveID),
+		arg("quantity", atLeast(1)),
+	),
+	"shareWishlist":   args(arg("id", positiveID)),
+	"unshareWishlist": args(arg("id", positiveID)),
+
+	"createCoupon": args(
+		arg("code", notBlank, maxLength(maxCodeLength)),
+		arg("description", maxLength(maxTextLength)),
+		arg("maxUses", notNegative),
+		arg("maxUsesPerUser", notNegative),
+		arg("minOrderValue", notNegative),
+		arg("productIds", eachValue(positiveID)),
+		arg("categories", eachValue(notBlank, maxLength(maxNameLength))),
+	).also(couponValue, endsAfterStarts),
+	"setCouponActive": args(arg("id", positiveID)),
+	"applyCoupon": args(
+		arg("orderId", positiveID),
+		arg("code", notBlank, maxLength(maxCodeLength)),
+	),
+	"removeCoupon": args(arg("orderId", positiveID)),
+
+	"createPromotion": args(
+		arg("name", notBlank, maxLength(maxNameLength)),
+		arg("products", notBlank, each(arg("productId", positiveID), arg("quantity", atLeast(1)))),
+		arg("buyQuantity", atLeast(1)),
+		arg("getQuantity", atLeast(1)),
+		arg("tiers", each(arg("minQuantity", atLeast(1)), arg("unitPrice", notNegative))),
+		arg("bundlePrice", positive),
+	).also(promotionShape, endsAfterStarts),
+	"setPromotionActive": args(arg("id", positiveID)),
+
+	"setTaxRate": args(
+		arg("country", countryCode),
+		arg("region", maxLength(maxNameLength)),
+		arg("taxClass", maxLength(maxCodeLength)),
+		arg("name", notBlank, maxLength(maxNameLength)),
+		arg("rate", between(0, 1)),
+	),
+	"deleteTaxRate": args(arg("id", positiveID)),
+
+	"addAddress":    args(addressRules...),
+	"updateAddress": args(append([]argRules{arg("id", positiveID)}, addressRules...)...),
+	"deleteAddress": args(arg("id", positiveID)),
+
+	"createShippingMethod": args(
+		arg("name", notBlank, maxLength(maxNameLength)),
+		arg("carrier", maxLength(maxNameLength)),
+		arg("baseRate", notNegative),
+		arg("ratePerKg", notNegative),
+		arg("freeThreshold", notNegative),
+	),
+	"setShippingMethodActive": args(arg("id", positiveID)),
+	"setShippingMethod":       args(arg("orderId", positiveID), arg("methodId", positiveID)),
+	"createShipment": args(
+		arg("orderId", positiveID),
+		arg("carrier", maxLength(maxNameLength)),
+		arg("trackingNumber", maxLength(maxNameLength)),
+		arg("items", each(quantityRules...)),
+	),
+	"markShipmentDelivered": args(arg("id", positiveID)),
+
+	"payOrder": args(
+		arg("orderId", positiveID),
+		arg("paymentToken", notBlank, maxLength(maxTokenLength)),
+	),
+	"capturePayment": args(arg("paymentId", positiveID), arg("amount", positive)),
+
+	"requestReturn": args(
+		arg("orderId", positiveID),
+		arg("items", notBlank, each(quantityRules...)),
+		arg("reason", notBlank, maxLength(maxTextLength)),
+	),
+	"approveReturn": args(arg("id", positiveID)),
+	"rejectReturn":  args(arg("id", positiveID), arg("note", maxLength(maxTextLength))),
+	"receiveReturn": args(arg("id", positiveID), arg("refundAmount", notNegative)),
+
+	"issueInvoice": args(arg("orderId", positiveID)),
+	"retryEmail":   args(arg("id", positiveID)),
+
+	"createApiKey": args(
+		arg("name", notBlank, maxLength(maxNameLength)),
+		arg("scopes", notBlank, eachValue(notBlank)),
+		arg("expiresAt", rfc3339),
+	),
+	"revokeApiKey": args(arg("id", positiveID)),
+
+	"createOrder": args(
+		arg("country", countryCode),
+		arg("region", maxLength(maxNameLength)),
+	),
+	"placeOrder": args(
+		arg("orderId", positiveID),
+		arg("shippingAddressId", positiveID),
+		arg("billingAddressId", positiveID),
+	),
+	"updateOrderStatus": args(
+		arg("id", positiveID),
+		arg("status", oneOf(orderStatuses...), manualStatus),
+	),
+	"cancelOrder": args(
+		arg("id", positiveID),
+		arg("reason", notBlank, maxLength(maxTextLength)),
+	),
+	"addOrderItem": args(
+		arg("order_id", positiveID),
+		arg("product_id", positiveID),
+		arg("quantity", atLeast(1)),
+	),
+}
+
+// validated runs a resolver only when its arguments pass the rules
+func validated(rules inputRules, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if violations := rules.validate(p.Args); len(violations) > 0 {
+			return nil, apperr.Violations(violations)
+		}
+		return resolve(p)
+	}
+}
+
+// validateMutations wraps the resolver of every mutation with the rules for its arguments.
+// A mutation that takes arguments must have rules, and the rules must name real arguments.
+func validateMutations(mutation *graphql.Object) {
+	for name, field := range mutation.Fields() {
+		rules, ok := mutationRules[name]
+		if !ok {
+			if len(field.Args) > 0 {
+				log.Fatalf("Mutation %s has no validation rules", name)
+			}
+			continue
+		}
+		for _, a := range rules.args {
+			if !hasArg(field, a.name) {
+				log.Fatalf("Validation rules for mutation %s name unknown argument %s", name, a.name)
+			}
+		}
+		field.Resolve = validated(rules, field.Resolve)
+	}
+}
+
+func hasArg(field *graphql.FieldDefinition, name string) bool {
+	for _, a := range field.Args {
+		if a.PrivateName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Argument readers for resolvers. They return the zero value for a missing argument
+// rather than panicking, and take the arguments of a field or the fields of an input object.
+
+func intArg(args map[string]interface{}, name string) int {
+	v, _ := args[name].(int)
+	return v
+}
+
+func floatArg(args map[string]interface{}, name string) float64 {
+	v, _ := args[name].(float64)
+	return v
+}
+
+func stringArg(args map[string]interface{}, name string) string {
+	v, _ := args[name].(string)
+	return v
+}
+
+func boolArg(args map[string]interface{}, name string) bool {
+	v, _ := args[name].(bool)
+	return v
+}
+
+// listArg returns a list argument, or nil
+func listArg(args map[string]interface{}, name string) []interface{} {
+	v, _ := args[name].([]interface{})
+	return v
+}
+
+// objectsArg returns a list of input objects, skipping anything that isn't one
+func objectsArg(args map[string]interface{}, name string) []map[string]interface{} {
+	var objects []map[string]interface{}
+	for _, v := range listArg(args, name) {
+		if object, ok := v.(map[string]interface{}); ok {
+			objects = append(objects, object)
+		}
+	}
+	return objects
+}
@@ -0,0 +1,335 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+
+	"go-graphql-ecom/auth"
+	"go-graphql-ecom/database"
+)
+
+// WebSocket connections to /graphql speak the graphql-transport-ws protocol:
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+
+const webSocketProtocol = "graphql-transport-ws"
+
+// Message types
+const (
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+)
+
+// Close codes
+const (
+	closeBadRequest         = 4400
+	closeUnauthorized       = 4401
+	closeForbidden          = 4403
+	closeSubprotocol        = 4406
+	closeInitTimeout        = 4408
+	closeSubscriberExists   = 4409
+	closeTooManyInitRequest = 4429
+)
+
+const (
+	// connectionInitTimeout is how long a client has to send connection_init
+	connectionInitTimeout = 10 * time.Second
+	// keepAliveInterval is how often the server pings; a client that doesn't answer within
+	// twice the interval is disconnected
+	keepAliveInterval = 30 * time.Second
+	writeTimeout      = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{webSocketProtocol},
+	// Browsers authenticate in connection_init rather than with cookies, so a page on
+	// another site can't act for a user by opening a socket
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConn is a client connection. Messages are read on the connection's goroutine and each
+// operation runs on its own.
+type wsConn struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	// ctx carries the user or API key the connection authenticated as
+	ctx          context.Context
+	remoteAddr   string
+	initReceived bool
+	acknowledged chan struct{}
+
+	mu         sync.Mutex
+	operations map[string]context.CancelFunc
+}
+
+// serveWebSocket upgrades a request to a graphql-transport-ws connection and serves it until
+// either side closes it
+func serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	c := &wsConn{
+		conn:         conn,
+		ctx:          ctx,
+		remoteAddr:   r.RemoteAddr,
+		acknowledged: make(chan struct{}),
+		operations:   make(map[string]context.CancelFunc),
+	}
+	if conn.Subprotocol() != webSocketProtocol {
+		c.close(closeSubprotocol, "Subprotocol not acceptable")
+		return
+	}
+
+	go c.keepAlive(ctx)
+	c.readLoop()
+}
+
+// keepAlive closes the connection if connection_init doesn't arrive in time, then pings the
+// client until ctx is done
+func (c *wsConn) keepAlive(ctx context.Context) {
+	select {
+	case <-c.acknowledged:
+	case <-ctx.Done():
+		return
+	case <-time.After(connectionInitTimeout):
+		c.close(closeInitTimeout, "Connection initialisation timeout")
+		return
+	}
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.writeMu.Lock()
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+			c.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *wsConn) readLoop() {
+	defer c.stopAll()
+	c.conn.SetReadDeadline(time.Now().Add(2 * keepAliveInterval))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(2 * keepAliveInterval))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(2 * keepAliveInterval))
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.close(closeBadRequest, "Invalid message received")
+			return
+		}
+
+		switch msg.Type {
+		case msgConnectionInit:
+			if c.initReceived {
+				c.close(closeTooManyInitRequest, "Too many initialisation requests")
+				return
+			}
+			c.initReceived = true
+			ctx, err := authenticateConnection(c.ctx, msg.Payload)
+			if err != nil {
+				c.close(closeForbidden, "Forbidden")
+				return
+			}
+			c.ctx = ctx
+			close(c.acknowledged)
+			c.send(wsMessage{Type: msgConnectionAck})
+
+		case msgPing:
+			c.send(wsMessage{Type: msgPong, Payload: msg.Payload})
+
+		case msgPong:
+
+		case msgSubscribe:
+			if !c.isAcknowledged() {
+				c.close(closeUnauthorized, "Unauthorized")
+				return
+			}
+			var data postData
+			if msg.ID == "" || json.Unmarshal(msg.Payload, &data) != nil {
+				c.close(closeBadRequest, "Invalid message received")
+				return
+			}
+			if !c.start(msg.ID, data) {
+				c.close(closeSubscriberExists, "Subscriber for "+msg.ID+" already exists")
+				return
+			}
+
+		case msgComplete:
+			c.finish(msg.ID)
+
+		default:
+			c.close(closeBadRequest, "Invalid message received")
+			return
+		}
+	}
+}
+
+func (c *wsConn) isAcknowledged() bool {
+	select {
+	case <-c.acknowledged:
+		return true
+	default:
+		return false
+	}
+}
+
+// start runs an operation under an ID, unless one is already running under it
+func (c *wsConn) start(id string, data postData) bool {
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.mu.Lock()
+	if _, exists := c.operations[id]; exists {
+		c.mu.Unlock()
+		cancel()
+		return false
+	}
+	c.operations[id] = cancel
+	c.mu.Unlock()
+
+	go func() {
+		// Each operation is limited and charged like a request of its own; a subscription
+		// pays once, when it starts
+		var results <-chan *graphql.Result
+		var errs []gqlerrors.FormattedError
+		analysis, err := prepare(&data, false)
+		if err == nil {
+			err = takeOperationBudget(ctx, c.remoteAddr, analysis.Cost)
+		}
+		if err != nil {
+			errs = err.formatted()
+		} else {
+			results, errs = operationStream(ctx, data)
+		}
+		if errs != nil {
+			payload, _ := json.Marshal(errs)
+			if c.finish(id) {
+				c.send(wsMessage{ID: id, Type: msgError, Payload: payload})
+			}
+			return
+		}
+		for result := range results {
+			if ctx.Err() != nil {
+				continue
+			}
+			payload, _ := json.Marshal(result)
+			c.send(wsMessage{ID: id, Type: msgNext, Payload: payload})
+		}
+		// The client already knows an operation it completed itself has ended
+		if c.finish(id) {
+			c.send(wsMessage{ID: id, Type: msgComplete})
+		}
+	}()
+	return true
+}
+
+// finish stops an operation and reports whether it was still running, that is, whether the
+// client hadn't completed it
+func (c *wsConn) finish(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cancel, ok := c.operations[id]
+	if ok {
+		cancel()
+		delete(c.operations, id)
+	}
+	return ok
+}
+
+// stopAll ends every operation once the connection has gone
+func (c *wsConn) stopAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, cancel := range c.operations {
+		cancel()
+		delete(c.operations, id)
+	}
+	c.conn.Close()
+}
+
+func (c *wsConn) send(msg wsMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	c.conn.WriteJSON(msg)
+}
+
+// close closes the connection with a graphql-transport-ws close code
+func (c *wsConn) close(code int, reason string) {
+	c.writeMu.Lock()
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeTimeout))
+	c.writeMu.Unlock()
+	c.conn.Close()
+}
+
+// authenticateConnection authenticates a connection as the user of an "Authorization:
+// Bearer <token>" entry in the connection_init payload, or as the API key of an "X-API-Key"
+// entry. Without either the connection keeps the credentials of the upgrade request.
+func authenticateConnection(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+	var params map[string]interface{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &params); err != nil {
+			return ctx, err
+		}
+	}
+
+	db := database.GetDB()
+	for name, value := range params {
+		credential, _ := value.(string)
+		switch strings.ToLower(name) {
+		case "authorization":
+			if len(credential) > 7 && strings.EqualFold(credential[:7], "Bearer ") {
+				credential = credential[7:]
+			}
+			sessionCtx, err := auth.WithSession(ctx, db, strings.TrimSpace(credential))
+			if err != nil {
+				return ctx, err
+			}
+			ctx = sessionCtx
+		case "x-api-key":
+			key, err := auth.AuthenticateAPIKey(db, strings.TrimSpace(credential))
+			if err != nil {
+				return ctx, err
+			}
+			ctx = auth.WithAPIKey(ctx, key)
+		}
+	}
+	return ctx, nil
+}
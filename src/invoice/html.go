@@ -0,0 +1,65 @@
+package invoice
+
+import (
+	"html/template"
+	"io"
+
+	"go-graphql-ecom/database"
+)
+
+var htmlTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money":   money,
+	"percent": percent,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 14px; margin: 40px; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-top: 24px; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.num { text-align: right; }
+.addresses { display: flex; gap: 80px; margin-top: 24px; }
+.totals td { border: none; }
+.total td { font-weight: bold; border-top: 2px solid #222; }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Number}}</h1>
+<p>Issued {{.IssuedAt}} &middot; Order #{{.OrderID}}</p>
+<div class="addresses">
+<div>
+<h3>Bill to</h3>
+{{with .BillingAddress}}{{template "address" .}}{{else}}<p>{{$.CustomerName}}</p>{{end}}
+<p>{{.CustomerEmail}}</p>
+</div>
+{{with .ShippingAddress}}<div>
+<h3>Ship to</h3>
+{{template "address" .}}
+</div>{{end}}
+</div>
+<table>
+<thead>
+<tr><th>Description</th><th class="num">Qty</th><th class="num">Unit price</th><th class="num">Amount</th><th>Tax</th></tr>
+</thead>
+<tbody>
+{{range .Lines}}<tr><td>{{.Description}}</td><td class="num">{{.Quantity}}</td><td class="num">{{money .UnitPrice}}</td><td class="num">{{money .Amount}}</td><td>{{if .TaxName}}{{.TaxName}} {{percent .TaxRate}}{{end}}</td></tr>
+{{end}}</tbody>
+</table>
+<table class="totals">
+<tr><td class="num">Subtotal</td><td class="num">{{money .Subtotal}}</td></tr>
+{{if .DiscountTotal}}<tr><td class="num">Discount</td><td class="num">-{{money .DiscountTotal}}</td></tr>
+{{end}}{{if .ShippingTotal}}<tr><td class="num">Shipping</td><td class="num">{{money .ShippingTotal}}</td></tr>
+{{end}}{{range .Taxes}}<tr><td class="num">{{.Name}} {{percent .Rate}}{{if $.PricesIncludeTax}} (included){{end}}</td><td class="num">{{money .Amount}}</td></tr>
+{{end}}<tr class="total"><td class="num">Total</td><td class="num">{{money .Total}}</td></tr>
+</table>
+</body>
+</html>
+{{define "address"}}<p>{{.Name}}<br>{{.Line1}}<br>{{if .Line2}}{{.Line2}}<br>{{end}}{{.City}}{{if .Region}}, {{.Region}}{{end}} {{.PostalCode}}<br>{{.Country}}</p>{{end}}
+`))
+
+// RenderHTML writes an invoice as an HTML page
+func RenderHTML(w io.Writer, inv *database.Invoice) error {
+	return htmlTemplate.Execute(w, inv)
+}
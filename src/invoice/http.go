@@ -0,0 +1,70 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"go-graphql-ecom/auth"
+	"go-graphql-ecom/database"
+)
+
+// Handler serves invoices as /invoices/{id}.pdf or /invoices/{id}.html to the customer
+// who placed the order and to staff who manage orders. It expects auth.Middleware to have run.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Base(r.URL.Path)
+	ext := path.Ext(name)
+	id, err := strconv.Atoi(strings.TrimSuffix(name, ext))
+	if err != nil || (ext != ".pdf" && ext != ".html") {
+		http.NotFound(w, r)
+		return
+	}
+
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	db := database.GetDB()
+	inv, err := database.GetInvoiceByID(db, id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	order, err := database.GetOrderByID(db, inv.OrderID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := auth.AuthorizeOwner(r.Context(), order.UserID, auth.PermManageOrders); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var buf bytes.Buffer
+	if ext == ".pdf" {
+		err = RenderPDF(&buf, inv)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", inv.Number+".pdf"))
+	} else {
+		err = RenderHTML(&buf, inv)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(buf.Bytes())
+}
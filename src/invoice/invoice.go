@@ -0,0 +1,113 @@
+// Package invoice issues invoices for paid orders and renders them as HTML and PDF.
+package invoice
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+)
+
+var ErrOrderNotPaid = apperr.New(apperr.CodeConflict, "order has no captured payment to invoice")
+
+// Number formats an invoice sequence number
+func Number(n int) string {
+	return fmt.Sprintf("INV-%06d", n)
+}
+
+// Issue creates the invoice of an order that has a captured payment, copying its lines,
+// taxes and addresses. An order is invoiced once; issuing again returns the existing
+// invoice. Numbers come from a counter updated in the same transaction, so they stay
+// sequential without gaps.
+func Issue(tx *sql.Tx, orderID int) (*database.Invoice, error) {
+	existing, err := database.GetInvoiceByOrderID(tx, orderID)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	order, err := database.GetOrderByID(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := database.GetPaymentsByOrderID(tx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	captured := 0.0
+	for _, p := range payments {
+		captured += p.CapturedAmount
+	}
+	if captured <= 0 {
+		return nil, ErrOrderNotPaid
+	}
+
+	inv := &database.Invoice{
+		OrderID:          order.ID,
+		Subtotal:         order.Subtotal,
+		DiscountTotal:    order.DiscountTotal,
+		ShippingTotal:    order.ShippingTotal,
+		TaxTotal:         order.TaxTotal,
+		Total:            order.Total,
+		PricesIncludeTax: order.PricesIncludeTax,
+	}
+	if user, err := database.GetUserByID(tx, order.UserID); err == nil {
+		inv.CustomerName = user.Name
+		inv.CustomerEmail = user.Email
+	}
+	for _, item := range order.Items {
+		line := database.InvoiceLine{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.Price,
+			Amount:    item.Price * float64(item.Quantity),
+			TaxName:   item.TaxName,
+			TaxRate:   item.TaxRate,
+			TaxAmount: item.TaxAmount,
+		}
+		if item.Product != nil {
+			line.Description = item.Product.Name
+		}
+		inv.Lines = append(inv.Lines, line)
+	}
+	if inv.Taxes, err = database.GetOrderTaxBreakdown(tx, order.ID); err != nil {
+		return nil, err
+	}
+	if inv.BillingAddress, err = database.GetOrderAddress(tx, order.ID, database.AddressKindBilling); err != nil {
+		return nil, err
+	}
+	if inv.ShippingAddress, err = database.GetOrderAddress(tx, order.ID, database.AddressKindShipping); err != nil {
+		return nil, err
+	}
+
+	n, err := database.NextInvoiceNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+	inv.Number = Number(n)
+	if err := database.CreateInvoice(tx, inv); err != nil {
+		return nil, err
+	}
+	return database.GetInvoiceByID(tx, inv.ID)
+}
+
+// IssueForOrder issues the invoice of an order in its own transaction
+func IssueForOrder(db *sql.DB, orderID int) (*database.Invoice, error) {
+	var inv *database.Invoice
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		var err error
+		inv, err = Issue(tx, orderID)
+		return err
+	})
+	return inv, err
+}
+
+func money(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+func percent(rate float64) string {
+	return strconv.FormatFloat(math.Round(rate*10000)/100, 'f', -1, 64) + "%"
+}
@@ -0,0 +1,259 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"go-graphql-ecom/database"
+)
+
+// Page geometry in points (A4)
+const (
+	pageWidth   = 595
+	pageHeight  = 842
+	pageMargin  = 50
+	lineHeight  = 16
+	fontSize    = 10
+	titleSize   = 18
+	maxDescChar = 48
+)
+
+// Column positions of the line table
+const (
+	colDescription = pageMargin
+	colQuantity    = 345
+	colUnitPrice   = 420
+	colAmount      = pageWidth - pageMargin
+)
+
+// pdfWriter lays out text on pages using the standard Helvetica fonts, which every PDF
+// reader provides, so no fonts need to be embedded
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func newPDFWriter() *pdfWriter {
+	w := &pdfWriter{}
+	w.newPage()
+	return w
+}
+
+func (w *pdfWriter) newPage() {
+	w.page = &bytes.Buffer{}
+	w.pages = append(w.pages, w.page)
+	w.y = pageHeight - pageMargin
+}
+
+// line moves down by n lines, starting a new page when the bottom margin is reached
+func (w *pdfWriter) line(n float64) {
+	w.y -= n * lineHeight
+	if w.y < pageMargin {
+		w.newPage()
+	}
+}
+
+func (w *pdfWriter) text(x float64, s string, bold bool, size float64) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(w.page, "BT /%s %g Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, w.y, pdfString(s))
+}
+
+// rightText draws text ending at x
+func (w *pdfWriter) rightText(x float64, s string, bold bool) {
+	w.text(x-textWidth(s, fontSize), s, bold, fontSize)
+}
+
+func (w *pdfWriter) rule() {
+	fmt.Fprintf(w.page, "0.5 w %d %.2f m %d %.2f l S\n", pageMargin, w.y-4, pageWidth-pageMargin, w.y-4)
+}
+
+// bytes assembles the document: catalog, page tree, the two fonts, then a page and a
+// content stream per page, followed by the cross-reference table
+func (w *pdfWriter) bytes() []byte {
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(w.pages))
+	for i := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range w.pages {
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 6+2*i))
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pdfString escapes text for a PDF string literal. Characters outside Latin-1 have no
+// WinAnsi code and are replaced.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteByte(' ')
+		case r < 0x20 || (r >= 0x7f && r < 0xa0) || r > 0xff:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+// textWidth estimates the width of text in Helvetica, exact for the digits and
+// punctuation used in amounts
+func textWidth(s string, size float64) float64 {
+	units := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			units += 556
+		case r == '.' || r == ',' || r == ' ':
+			units += 278
+		case r == '-':
+			units += 333
+		case r == '%':
+			units += 889
+		default:
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// addressLines formats an order address as separate lines
+func addressLines(a *database.OrderAddress) []string {
+	lines := []string{a.Name, a.Line1}
+	if a.Line2 != "" {
+		lines = append(lines, a.Line2)
+	}
+	city := a.City
+	if a.Region != "" {
+		city += ", " + a.Region
+	}
+	return append(lines, strings.TrimSpace(city+" "+a.PostalCode), a.Country)
+}
+
+// RenderPDF writes an invoice as a PDF document
+func RenderPDF(out io.Writer, inv *database.Invoice) error {
+	w := newPDFWriter()
+
+	w.text(pageMargin, "Invoice "+inv.Number, true, titleSize)
+	w.line(1.5)
+	w.text(pageMargin, fmt.Sprintf("Issued %s    Order #%d", inv.IssuedAt, inv.OrderID), false, fontSize)
+	w.line(2)
+
+	var billTo []string
+	if inv.BillingAddress != nil {
+		billTo = addressLines(inv.BillingAddress)
+	} else if inv.CustomerName != "" {
+		billTo = []string{inv.CustomerName}
+	}
+	if inv.CustomerEmail != "" {
+		billTo = append(billTo, inv.CustomerEmail)
+	}
+	var shipTo []string
+	if inv.ShippingAddress != nil {
+		shipTo = addressLines(inv.ShippingAddress)
+	}
+	w.text(pageMargin, "Bill to", true, fontSize)
+	if shipTo != nil {
+		w.text(pageWidth/2, "Ship to", true, fontSize)
+	}
+	for i := 0; i < len(billTo) || i < len(shipTo); i++ {
+		w.line(1)
+		if i < len(billTo) {
+			w.text(pageMargin, billTo[i], false, fontSize)
+		}
+		if i < len(shipTo) {
+			w.text(pageWidth/2, shipTo[i], false, fontSize)
+		}
+	}
+	w.line(2)
+
+	header := func() {
+		w.text(colDescription, "Description", true, fontSize)
+		w.rightText(colQuantity, "Qty", true)
+		w.rightText(colUnitPrice+40, "Unit price", true)
+		w.rightText(colAmount, "Amount", true)
+		w.rule()
+		w.line(1.2)
+	}
+	header()
+	for _, line := range inv.Lines {
+		desc := truncate(line.Description, maxDescChar)
+		if line.TaxName != "" {
+			desc = truncate(line.Description, maxDescChar-12) + " (" + percent(line.TaxRate) + ")"
+		}
+		w.text(colDescription, desc, false, fontSize)
+		w.rightText(colQuantity, fmt.Sprint(line.Quantity), false)
+		w.rightText(colUnitPrice+40, money(line.UnitPrice), false)
+		w.rightText(colAmount, money(line.Amount), false)
+		before := len(w.pages)
+		w.line(1)
+		if len(w.pages) > before {
+			header()
+		}
+	}
+	w.rule()
+	w.line(1.5)
+
+	total := func(label, amount string, bold bool) {
+		w.rightText(colUnitPrice+40, label, bold)
+		w.rightText(colAmount, amount, bold)
+		w.line(1)
+	}
+	total("Subtotal", money(inv.Subtotal), false)
+	if inv.DiscountTotal != 0 {
+		total("Discount", "-"+money(inv.DiscountTotal), false)
+	}
+	if inv.ShippingTotal != 0 {
+		total("Shipping", money(inv.ShippingTotal), false)
+	}
+	for _, tax := range inv.Taxes {
+		label := tax.Name + " " + percent(tax.Rate)
+		if inv.PricesIncludeTax {
+			label += " (included)"
+		}
+		total(label, money(tax.Amount), false)
+	}
+	total("Total", money(inv.Total), true)
+
+	_, err := out.Write(w.bytes())
+	return err
+}
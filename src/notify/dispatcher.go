@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"go-graphql-ecom/database"
+)
+
+// Dispatcher sends the emails queued in the outbox, retrying failed deliveries with
+// exponential backoff: BaseDelay after the first failure, doubling up to MaxDelay, until
+// MaxAttempts have been made and the email is marked failed.
+type Dispatcher struct {
+	DB          *sql.DB
+	Transport   Transport // GetTransport() when nil
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// wake is signalled when emails have been committed to the outbox
+var wake = make(chan struct{}, 1)
+
+// Wake makes a running dispatcher check the outbox now instead of at its next tick. Call
+// it after committing a transaction that queued emails.
+func Wake() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// NewDispatcher returns a dispatcher with the default schedule
+func NewDispatcher(db *sql.DB) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Interval:    5 * time.Second,
+		BatchSize:   20,
+		MaxAttempts: 6,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    time.Hour,
+	}
+}
+
+// Run sends due emails every Interval until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.SendDue(); err != nil {
+			log.Printf("notify: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// SendDue delivers the emails whose next attempt is due and returns how many were sent
+func (d *Dispatcher) SendDue() (int, error) {
+	t := d.Transport
+	if t == nil {
+		t = GetTransport()
+	}
+	if t == nil {
+		return 0, errors.New("no email transport configured")
+	}
+
+	emails, err := database.GetDueOutboxEmails(d.DB, d.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	from := GetConfig().From
+	sent := 0
+	for _, email := range emails {
+		err := t.Send(Message{From: from, To: email.Recipient, Subject: email.Subject, Text: email.TextBody, HTML: email.HTMLBody})
+		if err == nil {
+			if err := database.MarkEmailSent(d.DB, email.ID); err != nil {
+				return sent, err
+			}
+			sent++
+			continue
+		}
+
+		giveUp := email.Attempts+1 >= d.MaxAttempts
+		if giveUp {
+			log.Printf("notify: giving up on email %d to %s after %d attempts: %v", email.ID, email.Recipient, email.Attempts+1, err)
+		}
+		delay := d.backoff(email.Attempts)
+		if err := database.MarkEmailAttemptFailed(d.DB, email.ID, err.Error(), int(delay/time.Second), giveUp); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// backoff returns the wait after the attempt following the given number of earlier failures
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 0; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,199 @@
+// Package notify sends transactional emails. Workflows queue a rendered email in the
+// email_outbox table inside their own transaction, so nothing is sent for changes that roll
+// back, and a Dispatcher delivers the queue through a pluggable Transport after commit.
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"go-graphql-ecom/database"
+)
+
+// Email kinds
+const (
+	KindOrderPlaced       = "order_placed"
+	KindOrderShipped      = "order_shipped"
+	KindOrderCancelled    = "order_cancelled"
+	KindPasswordReset     = "password_reset"
+	KindEmailVerification = "email_verification"
+)
+
+// Config holds the settings shared by all emails
+type Config struct {
+	From     string
+	ShopName string
+	BaseURL  string // storefront address used in links
+}
+
+var (
+	configMu sync.RWMutex
+	config   = Config{From: "shop@example.com", ShopName: "Go Shop", BaseURL: "http://localhost:8081"}
+)
+
+// SetConfig replaces the email settings
+func SetConfig(c Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config = c
+}
+
+// GetConfig returns the email settings
+func GetConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config
+}
+
+//go:embed templates
+var templateFiles embed.FS
+
+var funcs = map[string]interface{}{
+	"money": func(amount float64) string {
+		return fmt.Sprintf("%.2f", amount)
+	},
+	"lineTotal": func(item database.OrderItem) float64 {
+		return item.Price * float64(item.Quantity)
+	},
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// templates holds the text and HTML templates of every kind. The text template also
+// defines the subject.
+var templates = func() map[string]emailTemplate {
+	set := make(map[string]emailTemplate)
+	for _, kind := range []string{KindOrderPlaced, KindOrderShipped, KindOrderCancelled, KindPasswordReset, KindEmailVerification} {
+		set[kind] = emailTemplate{
+			text: texttemplate.Must(texttemplate.New(kind).Funcs(funcs).ParseFS(templateFiles, "templates/"+kind+".txt")),
+			html: htmltemplate.Must(htmltemplate.New(kind).Funcs(funcs).ParseFS(templateFiles, "templates/"+kind+".html")),
+		}
+	}
+	return set
+}()
+
+// emailData is what the templates are rendered with
+type emailData struct {
+	ShopName  string
+	User      *database.User
+	Order     *database.Order
+	Address   *database.OrderAddress
+	Shipment  *database.Shipment
+	Link      string
+	ExpiresIn string
+}
+
+// render produces the subject, text and HTML body of an email
+func render(kind string, data *emailData) (subject, text, html string, err error) {
+	t, ok := templates[kind]
+	if !ok {
+		return "", "", "", fmt.Errorf("unknown email kind %q", kind)
+	}
+	var buf bytes.Buffer
+	if err := t.text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", "", err
+	}
+	subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+	if err := t.text.ExecuteTemplate(&buf, kind+".txt", data); err != nil {
+		return "", "", "", err
+	}
+	text = buf.String()
+	buf.Reset()
+	if err := t.html.ExecuteTemplate(&buf, kind+".html", data); err != nil {
+		return "", "", "", err
+	}
+	return subject, text, buf.String(), nil
+}
+
+// enqueue renders an email for a user and adds it to the outbox
+func enqueue(db database.Querier, kind string, data *emailData) error {
+	if data.User == nil || data.User.Email == "" {
+		return nil
+	}
+	data.ShopName = GetConfig().ShopName
+	subject, text, html, err := render(kind, data)
+	if err != nil {
+		return err
+	}
+	return database.EnqueueEmail(db, &database.OutboxEmail{
+		Kind:      kind,
+		Recipient: data.User.Email,
+		Subject:   subject,
+		TextBody:  text,
+		HTMLBody:  html,
+	})
+}
+
+// orderData loads an order with its customer and shipping address
+func orderData(db database.Querier, orderID int) (*emailData, error) {
+	order, err := database.GetOrderByID(db, orderID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := database.GetUserByID(db, order.UserID)
+	if err != nil {
+		return nil, err
+	}
+	address, err := database.GetOrderAddress(db, order.ID, database.AddressKindShipping)
+	if err != nil {
+		return nil, err
+	}
+	return &emailData{User: user, Order: order, Address: address}, nil
+}
+
+// OrderPlaced queues the order confirmation
+func OrderPlaced(db database.Querier, orderID int) error {
+	data, err := orderData(db, orderID)
+	if err != nil {
+		return err
+	}
+	return enqueue(db, KindOrderPlaced, data)
+}
+
+// OrderShipped queues the notice for a shipment
+func OrderShipped(db database.Querier, shipmentID int) error {
+	shipment, err := database.GetShipmentByID(db, shipmentID)
+	if err != nil {
+		return err
+	}
+	data, err := orderData(db, shipment.OrderID)
+	if err != nil {
+		return err
+	}
+	data.Shipment = shipment
+	return enqueue(db, KindOrderShipped, data)
+}
+
+// OrderCancelled queues the cancellation notice
+func OrderCancelled(db database.Querier, orderID int) error {
+	data, err := orderData(db, orderID)
+	if err != nil {
+		return err
+	}
+	return enqueue(db, KindOrderCancelled, data)
+}
+
+// PasswordReset queues a password reset link carrying token
+func PasswordReset(db database.Querier, user *database.User, token, expiresIn string) error {
+	return enqueue(db, KindPasswordReset, &emailData{User: user, Link: link("/reset-password", token), ExpiresIn: expiresIn})
+}
+
+// EmailVerification queues a link confirming the user's email address
+func EmailVerification(db database.Querier, user *database.User, token, expiresIn string) error {
+	return enqueue(db, KindEmailVerification, &emailData{User: user, Link: link("/verify-email", token), ExpiresIn: expiresIn})
+}
+
+// link builds a storefront URL carrying a token
+func link(path, token string) string {
+	return strings.TrimRight(GetConfig().BaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
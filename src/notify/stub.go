@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// StubMessage is an email received by a StubServer
+type StubMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// StubServer is a minimal in-process SMTP server for development and tests. It accepts
+// every message without authentication and keeps it in memory. Setting FailNext makes
+// that many deliveries fail with a temporary error, to exercise retries.
+type StubServer struct {
+	OnMessage func(StubMessage)
+
+	mu       sync.Mutex
+	messages []StubMessage
+	failNext int
+	listener net.Listener
+}
+
+// ListenStub starts a stub server on addr, e.g. "127.0.0.1:2525" or "127.0.0.1:0"
+func ListenStub(addr string) (*StubServer, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &StubServer{listener: l}
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on
+func (s *StubServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server
+func (s *StubServer) Close() error {
+	return s.listener.Close()
+}
+
+// Messages returns the messages received so far
+func (s *StubServer) Messages() []StubMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]StubMessage(nil), s.messages...)
+}
+
+// FailNext makes the next n deliveries fail
+func (s *StubServer) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext = n
+}
+
+func (s *StubServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *StubServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	reply("220 localhost ESMTP stub")
+	var msg StubMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(verb, "EHLO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(verb, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(verb, "MAIL FROM:"):
+			msg = StubMessage{From: trimAddress(line[len("MAIL FROM:"):])}
+			reply("250 OK")
+		case strings.HasPrefix(verb, "RCPT TO:"):
+			msg.To = append(msg.To, trimAddress(line[len("RCPT TO:"):]))
+			reply("250 OK")
+		case verb == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" || l == ".\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.Data = data.String()
+			if s.accept(msg) {
+				reply("250 OK")
+			} else {
+				reply("451 Temporary failure, try again later")
+			}
+		case verb == "RSET":
+			msg = StubMessage{}
+			reply("250 OK")
+		case verb == "NOOP":
+			reply("250 OK")
+		case verb == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// accept stores a message unless a failure was requested
+func (s *StubServer) accept(msg StubMessage) bool {
+	s.mu.Lock()
+	if s.failNext > 0 {
+		s.failNext--
+		s.mu.Unlock()
+		return false
+	}
+	s.messages = append(s.messages, msg)
+	onMessage := s.OnMessage
+	s.mu.Unlock()
+
+	if onMessage != nil {
+		onMessage(msg)
+	}
+	return true
+}
+
+func trimAddress(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Trim(s, "<>")
+}
@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is an email ready to be handed to a transport
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Transport delivers emails
+type Transport interface {
+	Send(msg Message) error
+}
+
+var (
+	transportMu sync.RWMutex
+	transport   Transport
+)
+
+// SetTransport sets the transport emails are delivered through
+func SetTransport(t Transport) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	transport = t
+}
+
+// GetTransport returns the configured transport, or nil if emails are not delivered
+func GetTransport() Transport {
+	transportMu.RLock()
+	defer transportMu.RUnlock()
+	return transport
+}
+
+// SMTPTransport delivers emails to an SMTP server. Credentials are only sent when a
+// username is set.
+type SMTPTransport struct {
+	Addr     string
+	Username string
+	Password string
+}
+
+// Send implements Transport
+func (t *SMTPTransport) Send(msg Message) error {
+	var auth smtp.Auth
+	if t.Username != "" {
+		host, _, err := net.SplitHostPort(t.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", t.Username, t.Password, host)
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(t.Addr, auth, msg.From, []string{msg.To}, data)
+}
+
+// FileTransport writes every email as an .eml file into a directory, for development
+type FileTransport struct {
+	Dir string
+}
+
+// NewFileTransport creates the directory if needed
+func NewFileTransport(dir string) (*FileTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileTransport{Dir: dir}, nil
+}
+
+// Send implements Transport
+func (t *FileTransport) Send(msg Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	suffix, err := randomHex(4)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000"), suffix)
+	return os.WriteFile(filepath.Join(t.Dir, name), data, 0644)
+}
+
+// Bytes encodes the message as MIME with a plain text part and, if present, an HTML alternative
+func (msg Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	id, err := randomHex(12)
+	if err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(msg.From, "@"); at >= 0 {
+		domain = strings.Trim(msg.From[at+1:], "> ")
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", id, domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		writePart(&buf, "text/plain", msg.Text)
+		return buf.Bytes(), nil
+	}
+
+	boundary := "alt-" + id
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	writePart(&buf, "text/plain", msg.Text)
+	fmt.Fprintf(&buf, "\r\n--%s\r\n", boundary)
+	writePart(&buf, "text/html", msg.HTML)
+	fmt.Fprintf(&buf, "\r\n--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+// writePart writes the headers and quoted-printable body of a text part
+func writePart(buf *bytes.Buffer, contentType, body string) {
+	fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(buf)
+	w.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	w.Close()
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
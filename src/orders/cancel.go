@@ -0,0 +1,105 @@
+package orders
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/notify"
+	"go-graphql-ecom/payment"
+)
+
+var (
+	ErrOrderNotCancellable = apperr.New(apperr.CodeConflict, "order cannot be cancelled in its current status")
+	ErrCancelReasonMissing = apperr.Invalid("reason", "a reason is required to cancel an order")
+)
+
+// Cancellable reports whether an order can still be cancelled: it has been placed but
+// nothing has shipped yet
+func Cancellable(order *database.Order) bool {
+	switch order.Status {
+	case database.OrderStatusPending, database.OrderStatusAuthorized, database.OrderStatusPaid:
+		return true
+	}
+	return false
+}
+
+// CancelOrder cancels an order that hasn't shipped. In one transaction every item goes back
+// into stock, the reason is recorded on the order and the customer is told about the
+// cancellation. Once that has committed, authorized payments are voided and captured payments
+// are refunded, so a rollback can't leave money returned on an order that is still open.
+func CancelOrder(db *sql.DB, orderID int, reason string) (*database.Order, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrCancelReasonMissing
+	}
+
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		order, err := database.GetOrderByID(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if !Cancellable(order) {
+			return ErrOrderNotCancellable
+		}
+
+		for _, item := range order.Items {
+			err := database.RecordInventoryMovement(tx, &database.InventoryMovement{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+				Reason:    database.InventoryReasonCancellation,
+				OrderID:   order.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := database.ReleaseOrderCoupon(tx, order.ID); err != nil {
+			return err
+		}
+		if err := database.CancelOrder(tx, order.ID, reason); err != nil {
+			return err
+		}
+		return notify.OrderCancelled(tx, order.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	notify.Wake()
+	if err := settlePayments(db, orderID); err != nil {
+		return nil, err
+	}
+	return database.GetOrderByID(db, orderID)
+}
+
+// settlePayments voids or refunds the payments of a cancelled order. A payment the provider
+// fails to settle keeps its status and records the failure, so staff can settle it by hand;
+// the other payments are still settled.
+func settlePayments(db *sql.DB, orderID int) error {
+	payments, err := database.GetPaymentsByOrderID(db, orderID)
+	if err != nil {
+		return err
+	}
+	for i := range payments {
+		p := &payments[i]
+		switch p.Status {
+		case database.PaymentStatusAuthorized:
+			err = payment.Void(db, p)
+		case database.PaymentStatusCaptured, database.PaymentStatusPartiallyRefunded:
+			err = payment.Refund(db, p, 0)
+		default:
+			continue
+		}
+		if err != nil {
+			log.Printf("settling payment %d of cancelled order %d: %v", p.ID, orderID, err)
+			p.FailureReason = err.Error()
+			if err := database.UpdatePayment(db, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
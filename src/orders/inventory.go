@@ -0,0 +1,73 @@
+package orders
+
+import (
+	"database/sql"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/pricing"
+)
+
+// AddOrderItem adds a product to an order and recalculates the totals. Only carts and pending
+// orders take new items. Carts don't hold stock; items added to a pending order take it straight away.
+func AddOrderItem(db *sql.DB, orderID, productID, quantity int, price float64) (*database.OrderItem, error) {
+	var itemID int
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		order, err := database.GetOrderByID(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != database.OrderStatusCart && order.Status != database.OrderStatusPending {
+			return pricing.ErrOrderNotModifiable
+		}
+		product, err := database.GetProductByID(tx, productID)
+		if err != nil {
+			return err
+		}
+		if product.Inventory < quantity {
+			return apperr.InsufficientStock(product.ID, quantity, product.Inventory)
+		}
+
+		item, err := database.AddOrderItem(tx, order.ID, product.ID, quantity, price)
+		if err != nil {
+			return err
+		}
+		itemID = item.ID
+
+		if order.Status == database.OrderStatusPending {
+			err := database.RecordInventoryMovement(tx, &database.InventoryMovement{
+				ProductID: product.ID,
+				Quantity:  -quantity,
+				Reason:    database.InventoryReasonSale,
+				OrderID:   order.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// Keep the order totals in line with its items
+		_, err = pricing.Recalculate(tx, order.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetOrderItemByID(db, itemID)
+}
+
+// takeStock removes the items of an order from inventory when a cart is placed
+func takeStock(tx *sql.Tx, order *database.Order) error {
+	for _, item := range order.Items {
+		err := database.RecordInventoryMovement(tx, &database.InventoryMovement{
+			ProductID: item.ProductID,
+			Quantity:  -item.Quantity,
+			Reason:    database.InventoryReasonSale,
+			OrderID:   order.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
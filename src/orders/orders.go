@@ -0,0 +1,131 @@
+// Package orders implements the order lifecycle on top of the database and pricing packages.
+package orders
+
+import (
+	"database/sql"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/events"
+	"go-graphql-ecom/notify"
+	"go-graphql-ecom/pricing"
+)
+
+var (
+	ErrOrderAlreadyPlaced      = apperr.New(apperr.CodeConflict, "order has already been placed")
+	ErrOrderEmpty              = apperr.New(apperr.CodeConflict, "order has no items")
+	ErrShippingAddressRequired = apperr.Invalid("shippingAddressId", "a shipping address is required to place an order")
+	ErrAddressNotOwned         = apperr.New(apperr.CodeForbidden, "address does not belong to the order's customer")
+	ErrEmailNotVerified        = apperr.New(apperr.CodeForbidden, "verify your email address before placing an order")
+)
+
+var requireVerifiedEmail atomic.Bool
+
+// SetRequireVerifiedEmail sets whether customers must verify their email address before
+// they can place orders
+func SetRequireVerifiedEmail(required bool) {
+	requireVerifiedEmail.Store(required)
+}
+
+// PlaceOrder turns a cart into a pending order, taking its items out of stock. The shipping and billing addresses are copied
+// onto the order so later address book edits don't change it, and the totals are recalculated
+// for the shipping destination. The customer is sent an order confirmation, and may need a
+// verified email address (see SetRequireVerifiedEmail). Subscribers are sent an events.OrderPlaced
+// event. A zero address ID selects the customer's default address; the
+// billing address falls back to the shipping address.
+func PlaceOrder(db *sql.DB, orderID, shippingAddressID, billingAddressID int) (*database.Order, error) {
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		order, err := database.GetOrderByID(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != database.OrderStatusCart && order.Status != database.OrderStatusPending {
+			return ErrOrderAlreadyPlaced
+		}
+		existing, err := database.GetOrderAddress(tx, order.ID, database.AddressKindShipping)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrOrderAlreadyPlaced
+		}
+		if len(order.Items) == 0 {
+			return ErrOrderEmpty
+		}
+		if requireVerifiedEmail.Load() {
+			user, err := database.GetUserByID(tx, order.UserID)
+			if err != nil {
+				return err
+			}
+			if !user.EmailVerified {
+				return ErrEmailNotVerified
+			}
+		}
+
+		shipping, err := orderAddress(tx, order, shippingAddressID, database.AddressKindShipping)
+		if err != nil {
+			return err
+		}
+		if shipping == nil {
+			return ErrShippingAddressRequired
+		}
+		billing, err := orderAddress(tx, order, billingAddressID, database.AddressKindBilling)
+		if err != nil {
+			return err
+		}
+		if billing == nil {
+			billing = shipping
+		}
+
+		if err := database.SnapshotOrderAddress(tx, order.ID, database.AddressKindShipping, shipping); err != nil {
+			return err
+		}
+		if err := database.SnapshotOrderAddress(tx, order.ID, database.AddressKindBilling, billing); err != nil {
+			return err
+		}
+		err = database.SetOrderLocation(tx, order.ID, strings.ToUpper(shipping.Country), strings.ToUpper(shipping.Region))
+		if err != nil {
+			return err
+		}
+		if order.Status == database.OrderStatusCart {
+			if err := takeStock(tx, order); err != nil {
+				return err
+			}
+		}
+		if err := pricing.RedeemCoupon(tx, order, time.Now()); err != nil {
+			return err
+		}
+		if err := database.UpdateOrderStatus(tx, order.ID, database.OrderStatusPending); err != nil {
+			return err
+		}
+
+		if _, err := pricing.Recalculate(tx, order.ID); err != nil {
+			return err
+		}
+		return notify.OrderPlaced(tx, order.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	notify.Wake()
+	events.Publish(events.Event{Kind: events.OrderPlaced, OrderID: orderID, Status: database.OrderStatusPending})
+	return database.GetOrderByID(db, orderID)
+}
+
+// orderAddress looks up the address selected for an order, or the customer's default
+func orderAddress(tx *sql.Tx, order *database.Order, addressID int, kind string) (*database.Address, error) {
+	if addressID == 0 {
+		return database.GetDefaultAddress(tx, order.UserID, kind)
+	}
+	address, err := database.GetAddressByID(tx, addressID)
+	if err != nil {
+		return nil, err
+	}
+	if address.UserID != order.UserID {
+		return nil, ErrAddressNotOwned
+	}
+	return address, nil
+}
@@ -0,0 +1,98 @@
+package orders
+
+import (
+	"database/sql"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/invoice"
+	"go-graphql-ecom/payment"
+)
+
+var (
+	ErrOrderNotPayable  = apperr.New(apperr.CodeConflict, "order cannot be paid in its current status")
+	ErrOrderAlreadyPaid = apperr.New(apperr.CodeConflict, "order already has an active payment")
+)
+
+// PayOrder authorizes the total of a pending order and, when capture is set, collects it
+// straight away and issues the invoice. The order becomes authorized or paid; a declined
+// attempt is recorded and leaves the order pending so the customer can try again.
+func PayOrder(db *sql.DB, orderID int, token string, capture bool) (*database.Payment, error) {
+	var paymentID int
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		order, err := database.GetOrderByID(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != database.OrderStatusPending {
+			return ErrOrderNotPayable
+		}
+		payments, err := database.GetPaymentsByOrderID(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		for _, p := range payments {
+			if p.Status == database.PaymentStatusAuthorized || p.Status == database.PaymentStatusCaptured {
+				return ErrOrderAlreadyPaid
+			}
+		}
+
+		p, err := payment.Authorize(tx, order, token)
+		if err != nil {
+			return err
+		}
+		paymentID = p.ID
+		if p.Status == database.PaymentStatusFailed {
+			return nil
+		}
+
+		status := database.OrderStatusAuthorized
+		if capture {
+			if err := payment.Capture(tx, p, 0); err != nil {
+				return err
+			}
+			status = database.OrderStatusPaid
+		}
+		if err := database.UpdateOrderStatus(tx, order.ID, status); err != nil {
+			return err
+		}
+		if capture {
+			_, err = invoice.Issue(tx, order.ID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetPaymentByID(db, paymentID)
+}
+
+// CapturePayment collects an authorized payment, fully or for a smaller amount, marks an
+// authorized order as paid and issues its invoice
+func CapturePayment(db *sql.DB, paymentID int, amount float64) (*database.Payment, error) {
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		p, err := database.GetPaymentByID(tx, paymentID)
+		if err != nil {
+			return err
+		}
+		if err := payment.Capture(tx, p, amount); err != nil {
+			return err
+		}
+
+		order, err := database.GetOrderByID(tx, p.OrderID)
+		if err != nil {
+			return err
+		}
+		if order.Status == database.OrderStatusAuthorized {
+			if err := database.UpdateOrderStatus(tx, order.ID, database.OrderStatusPaid); err != nil {
+				return err
+			}
+		}
+		_, err = invoice.Issue(tx, order.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetPaymentByID(db, paymentID)
+}
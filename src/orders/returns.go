@@ -0,0 +1,241 @@
+package orders
+
+import (
+	"database/sql"
+	"math"
+	"strings"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/payment"
+)
+
+var (
+	ErrOrderNotReturnable  = apperr.New(apperr.CodeConflict, "order has no shipped items that can be returned")
+	ErrReturnReasonMissing = apperr.Invalid("reason", "a reason is required to return items")
+	ErrReturnNotPending    = apperr.New(apperr.CodeConflict, "return has already been processed")
+	ErrReturnNotApproved   = apperr.New(apperr.CodeConflict, "return must be approved before it is received")
+	ErrRefundTooLarge      = apperr.Invalid("refundAmount", "refund exceeds the amount that can be refunded")
+)
+
+// RequestReturn opens a return for shipped units of an order. Units already in another
+// return that was not rejected can't be returned again.
+func RequestReturn(db *sql.DB, orderID int, items []database.ReturnItem, reason string) (*database.Return, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReturnReasonMissing
+	}
+	if len(items) == 0 {
+		return nil, apperr.Invalid("items", "select at least one item to return")
+	}
+
+	var returnID int
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		order, err := database.GetOrderByID(tx, orderID)
+		if err != nil {
+			return err
+		}
+		switch order.Status {
+		case database.OrderStatusPartiallyShipped, database.OrderStatusShipped, database.OrderStatusDelivered,
+			database.OrderStatusPartiallyRefunded:
+		default:
+			return ErrOrderNotReturnable
+		}
+
+		shipped, err := database.GetShippedQuantities(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		returned, err := database.GetReturnedQuantities(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			left := shipped[item.OrderItemID] - returned[item.OrderItemID]
+			if item.Quantity <= 0 || item.Quantity > left {
+				return apperr.Invalidf("items", "cannot return %d units of order item %d, %d can be returned", item.Quantity, item.OrderItemID, left)
+			}
+			returned[item.OrderItemID] += item.Quantity
+		}
+
+		returnID, err = database.CreateReturn(tx, &database.Return{OrderID: order.ID, Reason: reason, Items: items})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetReturnByID(db, returnID)
+}
+
+// ApproveReturn accepts a return request so the customer can send the items back
+func ApproveReturn(db *sql.DB, returnID int) (*database.Return, error) {
+	ret, err := database.GetReturnByID(db, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Status != database.ReturnStatusRequested {
+		return nil, ErrReturnNotPending
+	}
+	ret.Status = database.ReturnStatusApproved
+	if err := database.UpdateReturn(db, ret); err != nil {
+		return nil, err
+	}
+	return database.GetReturnByID(db, returnID)
+}
+
+// RejectReturn declines a return that has not been received, recording why
+func RejectReturn(db *sql.DB, returnID int, note string) (*database.Return, error) {
+	ret, err := database.GetReturnByID(db, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Status != database.ReturnStatusRequested && ret.Status != database.ReturnStatusApproved {
+		return nil, ErrReturnNotPending
+	}
+	ret.Status = database.ReturnStatusRejected
+	ret.Note = note
+	if err := database.UpdateReturn(db, ret); err != nil {
+		return nil, err
+	}
+	return database.GetReturnByID(db, returnID)
+}
+
+// ReceiveReturn books the returned items back into stock when restock is set and refunds the
+// customer. Without a refund amount the customer gets back what they paid for the returned
+// units, or everything still refundable once every unit of the order has been returned.
+// The order becomes refunded or partially refunded accordingly.
+func ReceiveReturn(db *sql.DB, returnID int, refundAmount *float64, restock bool) (*database.Return, error) {
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		ret, err := database.GetReturnByID(tx, returnID)
+		if err != nil {
+			return err
+		}
+		if ret.Status != database.ReturnStatusApproved {
+			return ErrReturnNotApproved
+		}
+		order, err := database.GetOrderByID(tx, ret.OrderID)
+		if err != nil {
+			return err
+		}
+
+		items := make(map[int]database.OrderItem, len(order.Items))
+		for _, item := range order.Items {
+			items[item.ID] = item
+		}
+
+		value := 0.0
+		for _, r := range ret.Items {
+			item := items[r.OrderItemID]
+			if restock {
+				err := database.RecordInventoryMovement(tx, &database.InventoryMovement{
+					ProductID: item.ProductID,
+					Quantity:  r.Quantity,
+					Reason:    database.InventoryReasonReturn,
+					OrderID:   order.ID,
+					ReturnID:  ret.ID,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			value += paidForItem(item) * float64(r.Quantity) / float64(item.Quantity)
+		}
+
+		payments, err := database.GetPaymentsByOrderID(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		refundable := 0.0
+		for i := range payments {
+			refundable += payment.Refundable(&payments[i])
+		}
+
+		amount := math.Min(math.Round(value*100)/100, refundable)
+		if refundAmount != nil {
+			amount = *refundAmount
+		} else if fullyReturned, err := allUnitsReturned(tx, order); err != nil {
+			return err
+		} else if fullyReturned {
+			amount = refundable
+		}
+		if amount < 0 || amount > refundable+0.005 {
+			return ErrRefundTooLarge
+		}
+		if err := refund(tx, payments, amount); err != nil {
+			return err
+		}
+
+		ret.Status = database.ReturnStatusReceived
+		ret.RefundAmount = amount
+		if err := database.UpdateReturn(tx, ret); err != nil {
+			return err
+		}
+		return updateRefundStatus(tx, order.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetReturnByID(db, returnID)
+}
+
+// refund returns an amount to the customer across the captured payments of an order, newest first
+func refund(tx *sql.Tx, payments []database.Payment, amount float64) error {
+	for i := len(payments) - 1; i >= 0 && amount > 0.005; i-- {
+		p := &payments[i]
+		part := math.Min(amount, payment.Refundable(p))
+		if part <= 0 {
+			continue
+		}
+		if err := payment.Refund(tx, p, part); err != nil {
+			return err
+		}
+		amount -= part
+	}
+	return nil
+}
+
+// updateRefundStatus marks an order refunded once everything captured has been refunded,
+// or partially refunded after any refund
+func updateRefundStatus(tx *sql.Tx, orderID int) error {
+	payments, err := database.GetPaymentsByOrderID(tx, orderID)
+	if err != nil {
+		return err
+	}
+	captured, refunded := 0.0, 0.0
+	for _, p := range payments {
+		captured += p.CapturedAmount
+		refunded += p.RefundedAmount
+	}
+	if refunded <= 0 {
+		return nil
+	}
+
+	status := database.OrderStatusPartiallyRefunded
+	if refunded >= captured-0.005 {
+		status = database.OrderStatusRefunded
+	}
+	return database.UpdateOrderStatus(tx, orderID, status)
+}
+
+// allUnitsReturned reports whether every unit of an order is part of a return that was not rejected
+func allUnitsReturned(tx *sql.Tx, order *database.Order) (bool, error) {
+	returned, err := database.GetReturnedQuantities(tx, order.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range order.Items {
+		if returned[item.ID] < item.Quantity {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// paidForItem returns what the customer paid for an order line after discounts, including tax
+func paidForItem(item database.OrderItem) float64 {
+	if item.TaxBase == 0 && item.TaxAmount == 0 {
+		// Lines priced before tax was recorded
+		return float64(item.Quantity) * item.Price
+	}
+	return item.TaxBase + item.TaxAmount
+}
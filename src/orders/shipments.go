@@ -0,0 +1,219 @@
+package orders
+
+import (
+	"database/sql"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/notify"
+	"go-graphql-ecom/pricing"
+	"go-graphql-ecom/shipping"
+)
+
+var (
+	ErrShippingMethodInactive = apperr.Invalid("methodId", "shipping method is not available")
+	ErrOrderNotShippable      = apperr.New(apperr.CodeConflict, "order cannot be shipped in its current status")
+	ErrNothingToShip          = apperr.Invalid("items", "shipment contains no items")
+	ErrOrderNotDeliverable    = apperr.New(apperr.CodeConflict, "only a shipped order can be marked delivered")
+)
+
+// ShippingOptions quotes every active shipping method for an order
+func ShippingOptions(db *sql.DB, orderID int) ([]shipping.Option, error) {
+	order, err := database.GetOrderByID(db, orderID)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := database.GetActiveShippingMethods(db)
+	if err != nil {
+		return nil, err
+	}
+	return shipping.Options(methods, order), nil
+}
+
+// SetShippingMethod chooses how an unshipped order is sent and adds the shipping cost to its total
+func SetShippingMethod(db *sql.DB, orderID, methodID int) (*database.Order, error) {
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		order, err := database.GetOrderByID(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != database.OrderStatusCart && order.Status != database.OrderStatusPending {
+			return pricing.ErrOrderNotModifiable
+		}
+		method, err := database.GetShippingMethodByID(tx, methodID)
+		if err != nil {
+			return err
+		}
+		if !method.Active {
+			return ErrShippingMethodInactive
+		}
+		if _, err := shipping.Quote(method, order); err != nil {
+			return err
+		}
+
+		if err := database.SetOrderShippingMethod(tx, order.ID, method.ID); err != nil {
+			return err
+		}
+		_, err = pricing.Recalculate(tx, order.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetOrderByID(db, orderID)
+}
+
+// CreateShipment records a parcel sent for a placed order. Without items, everything that has
+// not shipped yet is included. The order becomes partially shipped, or shipped once every unit
+// of every item has been sent. The customer is notified of the shipment.
+func CreateShipment(db *sql.DB, orderID int, carrier, trackingNumber string, items []database.ShipmentItem) (*database.Shipment, error) {
+	var shipmentID int
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		order, err := database.GetOrderByID(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if !shippable(order) {
+			return ErrOrderNotShippable
+		}
+		shipped, err := database.GetShippedQuantities(tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		remaining := make(map[int]int, len(order.Items))
+		for _, item := range order.Items {
+			remaining[item.ID] = item.Quantity - shipped[item.ID]
+		}
+
+		if len(items) == 0 {
+			for _, item := range order.Items {
+				if remaining[item.ID] > 0 {
+					items = append(items, database.ShipmentItem{OrderItemID: item.ID, Quantity: remaining[item.ID]})
+				}
+			}
+		}
+		if len(items) == 0 {
+			return ErrNothingToShip
+		}
+		for _, item := range items {
+			left, ok := remaining[item.OrderItemID]
+			if !ok {
+				return apperr.Invalidf("items", "order item %d does not belong to order %d", item.OrderItemID, order.ID)
+			}
+			if item.Quantity <= 0 || item.Quantity > left {
+				return apperr.Invalidf("items", "cannot ship %d units of order item %d, %d left to ship", item.Quantity, item.OrderItemID, left)
+			}
+			remaining[item.OrderItemID] = left - item.Quantity
+		}
+
+		if carrier == "" && order.ShippingMethodID != 0 {
+			if method, err := database.GetShippingMethodByID(tx, order.ShippingMethodID); err == nil {
+				carrier = method.Carrier
+			}
+		}
+
+		shipmentID, err = database.CreateShipment(tx, &database.Shipment{
+			OrderID:        order.ID,
+			Carrier:        carrier,
+			TrackingNumber: trackingNumber,
+			Items:          items,
+		})
+		if err != nil {
+			return err
+		}
+
+		status := database.OrderStatusShipped
+		for _, left := range remaining {
+			if left > 0 {
+				status = database.OrderStatusPartiallyShipped
+				break
+			}
+		}
+		if err := database.UpdateOrderStatus(tx, order.ID, status); err != nil {
+			return err
+		}
+		return notify.OrderShipped(tx, shipmentID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	notify.Wake()
+	return database.GetShipmentByID(db, shipmentID)
+}
+
+// MarkShipmentDelivered records that a parcel arrived. Once the order has fully shipped and
+// every parcel has arrived, the order is delivered.
+func MarkShipmentDelivered(db *sql.DB, shipmentID int) (*database.Shipment, error) {
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		shipment, err := database.GetShipmentByID(tx, shipmentID)
+		if err != nil {
+			return err
+		}
+		if err := database.MarkShipmentDelivered(tx, shipment.ID); err != nil {
+			return err
+		}
+
+		order, err := database.GetOrderByID(tx, shipment.OrderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != database.OrderStatusShipped {
+			return nil
+		}
+		shipments, err := database.GetShipmentsByOrderID(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		for _, s := range shipments {
+			if s.Status != database.ShipmentStatusDelivered {
+				return nil
+			}
+		}
+		return database.UpdateOrderStatus(tx, order.ID, database.OrderStatusDelivered)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetShipmentByID(db, shipmentID)
+}
+
+// MarkOrderDelivered records that a fully shipped order arrived, for carriers that don't report
+// deliveries. Its parcels still in transit are marked delivered along with it.
+func MarkOrderDelivered(db *sql.DB, orderID int) (*database.Order, error) {
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		order, err := database.GetOrderByID(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != database.OrderStatusShipped {
+			return ErrOrderNotDeliverable
+		}
+		shipments, err := database.GetShipmentsByOrderID(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		for _, s := range shipments {
+			if s.Status == database.ShipmentStatusDelivered {
+				continue
+			}
+			if err := database.MarkShipmentDelivered(tx, s.ID); err != nil {
+				return err
+			}
+		}
+		return database.UpdateOrderStatus(tx, order.ID, database.OrderStatusDelivered)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetOrderByID(db, orderID)
+}
+
+// shippable reports whether a placed order still has items to send
+func shippable(order *database.Order) bool {
+	switch order.Status {
+	case database.OrderStatusPending, database.OrderStatusAuthorized, database.OrderStatusPaid, database.OrderStatusPartiallyShipped:
+		return true
+	}
+	return false
+}
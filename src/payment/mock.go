@@ -0,0 +1,71 @@
+package payment
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Payment method tokens the mock provider declines. Every other token is approved.
+const (
+	MockTokenDeclined          = "tok_declined"
+	MockTokenInsufficientFunds = "tok_insufficient_funds"
+)
+
+// MockProvider is a deterministic in-process provider for development and tests. It keeps
+// no state: references are derived from the order and attempt, and the outcome depends only
+// on the token.
+type MockProvider struct{}
+
+// NewMockProvider creates a mock provider
+func NewMockProvider() *MockProvider {
+	return &MockProvider{}
+}
+
+// Name implements PaymentProvider
+func (m *MockProvider) Name() string {
+	return "mock"
+}
+
+// Authorize implements PaymentProvider
+func (m *MockProvider) Authorize(req AuthorizeRequest) (string, error) {
+	if req.Amount <= 0 {
+		return "", ErrInvalidAmount
+	}
+	switch strings.TrimSpace(req.Token) {
+	case "":
+		return "", &DeclineError{Reason: "missing payment method"}
+	case MockTokenDeclined:
+		return "", &DeclineError{Reason: "card declined"}
+	case MockTokenInsufficientFunds:
+		return "", &DeclineError{Reason: "insufficient funds"}
+	}
+	return fmt.Sprintf("mock_%d_%d", req.OrderID, req.Attempt), nil
+}
+
+// Capture implements PaymentProvider
+func (m *MockProvider) Capture(reference string, amount float64) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	return m.check(reference)
+}
+
+// Void implements PaymentProvider
+func (m *MockProvider) Void(reference string) error {
+	return m.check(reference)
+}
+
+// Refund implements PaymentProvider
+func (m *MockProvider) Refund(reference string, amount float64) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	return m.check(reference)
+}
+
+func (m *MockProvider) check(reference string) error {
+	if !strings.HasPrefix(reference, "mock_") {
+		return fmt.Errorf("unknown payment reference %q", reference)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Package payment talks to payment providers and records every payment attempt.
+package payment
+
+import (
+	"sync"
+
+	"go-graphql-ecom/apperr"
+)
+
+// AuthorizeRequest asks a provider to reserve an amount on a customer's payment method
+type AuthorizeRequest struct {
+	OrderID int
+	// Attempt numbers the authorizations of an order, starting at 1
+	Attempt int
+	Amount  float64
+	// Token identifies the payment method collected by the provider's client-side SDK
+	Token string
+}
+
+// DeclineError is returned when a provider refuses a payment
+type DeclineError struct {
+	Reason string
+}
+
+func (e *DeclineError) Error() string {
+	return "payment declined: " + e.Reason
+}
+
+// PaymentProvider is a payment gateway. References returned by Authorize identify the
+// payment in the other calls.
+type PaymentProvider interface {
+	Name() string
+	Authorize(req AuthorizeRequest) (reference string, err error)
+	Capture(reference string, amount float64) error
+	Void(reference string) error
+	Refund(reference string, amount float64) error
+}
+
+var ErrInvalidAmount = apperr.Invalid("amount", "amount must be positive")
+
+var (
+	mu       sync.RWMutex
+	provider PaymentProvider = NewMockProvider()
+)
+
+// SetProvider sets the payment provider used for new and existing payments
+func SetProvider(p PaymentProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	provider = p
+}
+
+// GetProvider returns the payment provider
+func GetProvider() PaymentProvider {
+	mu.RLock()
+	defer mu.RUnlock()
+	return provider
+}
@@ -0,0 +1,111 @@
+package payment
+
+import (
+	"math"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+)
+
+var (
+	ErrNotAuthorized = apperr.New(apperr.CodeConflict, "payment is not authorized")
+	ErrNotCaptured   = apperr.New(apperr.CodeConflict, "payment has not been captured")
+)
+
+// Authorize reserves an order's total with the provider and records the attempt. A declined
+// or failed attempt is recorded with status failed and returned without an error, so the
+// customer can retry with another payment method.
+func Authorize(db database.Querier, order *database.Order, token string) (*database.Payment, error) {
+	previous, err := database.GetPaymentsByOrderID(db, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := GetProvider()
+	payment := &database.Payment{
+		OrderID:  order.ID,
+		Provider: p.Name(),
+		Amount:   order.Total,
+		Status:   database.PaymentStatusAuthorized,
+	}
+	payment.Reference, err = p.Authorize(AuthorizeRequest{
+		OrderID: order.ID,
+		Attempt: len(previous) + 1,
+		Amount:  order.Total,
+		Token:   token,
+	})
+	if err != nil {
+		payment.Status = database.PaymentStatusFailed
+		payment.FailureReason = err.Error()
+	}
+
+	return database.CreatePayment(db, payment)
+}
+
+// Capture collects an authorized payment. A zero amount captures the full authorization.
+func Capture(db database.Querier, payment *database.Payment, amount float64) error {
+	if payment.Status != database.PaymentStatusAuthorized {
+		return ErrNotAuthorized
+	}
+	if amount == 0 {
+		amount = payment.Amount
+	}
+	if amount < 0 || amount > payment.Amount {
+		return apperr.Invalidf("amount", "capture amount must be between 0 and the authorized %.2f", payment.Amount)
+	}
+
+	if err := GetProvider().Capture(payment.Reference, amount); err != nil {
+		return err
+	}
+	payment.CapturedAmount = amount
+	payment.Status = database.PaymentStatusCaptured
+	return database.UpdatePayment(db, payment)
+}
+
+// Void releases an authorization that has not been captured
+func Void(db database.Querier, payment *database.Payment) error {
+	if payment.Status != database.PaymentStatusAuthorized {
+		return ErrNotAuthorized
+	}
+
+	if err := GetProvider().Void(payment.Reference); err != nil {
+		return err
+	}
+	payment.Status = database.PaymentStatusVoided
+	return database.UpdatePayment(db, payment)
+}
+
+// Refund returns part or all of a captured payment. A zero amount refunds whatever has not
+// been refunded yet.
+func Refund(db database.Querier, payment *database.Payment, amount float64) error {
+	if payment.Status != database.PaymentStatusCaptured && payment.Status != database.PaymentStatusPartiallyRefunded {
+		return ErrNotCaptured
+	}
+	refundable := Refundable(payment)
+	if amount == 0 {
+		amount = refundable
+	}
+	amount = round(amount)
+	if amount <= 0 || amount > refundable {
+		return apperr.Invalidf("amount", "refund amount must be between 0 and the refundable %.2f", refundable)
+	}
+
+	if err := GetProvider().Refund(payment.Reference, amount); err != nil {
+		return err
+	}
+	payment.RefundedAmount = round(payment.RefundedAmount + amount)
+	payment.Status = database.PaymentStatusPartiallyRefunded
+	if payment.RefundedAmount >= payment.CapturedAmount {
+		payment.Status = database.PaymentStatusRefunded
+	}
+	return database.UpdatePayment(db, payment)
+}
+
+// Refundable returns how much of a payment can still be refunded
+func Refundable(payment *database.Payment) float64 {
+	return round(payment.CapturedAmount - payment.RefundedAmount)
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,46 @@
+package persisted
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ManifestFormat identifies a manifest generated by @apollo/generate-persisted-query-manifest
+const ManifestFormat = "apollo-persisted-query-manifest"
+
+// Manifest lists the operations a client build may send
+type Manifest struct {
+	Format     string      `json:"format"`
+	Version    int         `json:"version"`
+	Operations []Operation `json:"operations"`
+}
+
+// Operation is an operation in a manifest. ID is the SHA-256 hash of Body.
+type Operation struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Body string `json:"body"`
+}
+
+// ReadManifest decodes a manifest and checks that every operation's ID is the hash of its
+// body, so a hash sent by a client always runs the operation it was computed from
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Format != ManifestFormat || m.Version != 1 {
+		return nil, fmt.Errorf("unsupported manifest format %q version %d", m.Format, m.Version)
+	}
+	for i, op := range m.Operations {
+		if op.Body == "" {
+			return nil, fmt.Errorf("operation %d (%s) has no body", i, op.Name)
+		}
+		if hash := Hash(op.Body); op.ID != hash {
+			return nil, fmt.Errorf("operation %d (%s) has id %q but its body hashes to %q", i, op.Name, op.ID, hash)
+		}
+	}
+	return &m, nil
+}
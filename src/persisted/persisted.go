@@ -0,0 +1,78 @@
+// Package persisted supports persisted queries: clients send the SHA-256 hash of an operation
+// instead of its text. Operations come from a bounded in-memory cache filled by clients
+// (automatic persisted queries) or from manifests registered ahead of time.
+package persisted
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// Hash returns the hex-encoded SHA-256 hash identifying an operation's text
+func Hash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+type entry struct {
+	hash  string
+	query string
+}
+
+// Cache holds the text of recently used operations by hash, evicting the least recently used
+// once it is full. It is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// NewCache returns an empty cache holding up to size operations
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the operation stored under a hash
+func (c *Cache) Get(hash string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[hash]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*entry).query, true
+}
+
+// Add stores an operation under its hash
+func (c *Cache) Add(hash, query string) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[hash]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[hash] = c.order.PushFront(&entry{hash: hash, query: query})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).hash)
+	}
+}
+
+// Len returns the number of operations in the cache
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
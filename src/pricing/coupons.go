@@ -0,0 +1,239 @@
+package pricing
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+)
+
+// Coupon validation errors
+var (
+	ErrCouponInactive     = apperr.Invalid("code", "coupon is not active")
+	ErrCouponNotStarted   = apperr.Invalid("code", "coupon is not valid yet")
+	ErrCouponExpired      = apperr.Invalid("code", "coupon has expired")
+	ErrCouponUsedUp       = apperr.Invalid("code", "coupon has reached its usage limit")
+	ErrCouponUserUsedUp   = apperr.Invalid("code", "coupon has already been used the maximum number of times by this customer")
+	ErrCouponNotEligible  = apperr.Invalid("code", "coupon does not apply to any item in this order")
+	ErrOrderNotModifiable = apperr.New(apperr.CodeConflict, "order can no longer be modified")
+)
+
+// ApplyCoupon validates a coupon code against an order or cart and applies it,
+// replacing any coupon that was applied before
+func ApplyCoupon(db *sql.DB, orderID int, code string) (*database.Order, error) {
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		order, err := database.GetOrderByID(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if !isOpen(order) {
+			return ErrOrderNotModifiable
+		}
+
+		coupon, err := database.GetCouponByCode(tx, code)
+		if err != nil {
+			return err
+		}
+		if err := ValidateCoupon(tx, coupon, order, time.Now()); err != nil {
+			return err
+		}
+
+		if err := database.SetOrderCoupon(tx, order.ID, order.UserID, coupon.ID); err != nil {
+			return err
+		}
+		// A cart uses the coupon once it is placed; an order that was placed already uses it now
+		if order.Status != database.OrderStatusCart {
+			if err := database.RedeemOrderCoupon(tx, order.ID); err != nil {
+				return err
+			}
+		}
+		_, err = Recalculate(tx, order.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetOrderByID(db, orderID)
+}
+
+// RedeemCoupon counts the coupon applied to an order as used when the order is placed. The
+// usage limits are checked again, since other orders may have used the coupon up after it was
+// applied. A coupon the order no longer qualifies for gives no discount and isn't counted.
+func RedeemCoupon(tx database.Querier, order *database.Order, now time.Time) error {
+	redemption, err := database.GetCouponRedemptionByOrderID(tx, order.ID)
+	if err != nil || redemption == nil {
+		return err
+	}
+	coupon, err := database.GetCouponByID(tx, redemption.CouponID)
+	if err != nil {
+		return err
+	}
+	if checkCouponConditions(coupon, order, now) != nil {
+		return nil
+	}
+	if err := ValidateCoupon(tx, coupon, order, now); err != nil {
+		return err
+	}
+	return database.RedeemOrderCoupon(tx, order.ID)
+}
+
+// RemoveCoupon detaches the coupon from an order and recalculates it
+func RemoveCoupon(db *sql.DB, orderID int) (*database.Order, error) {
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		order, err := database.GetOrderByID(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if !isOpen(order) {
+			return ErrOrderNotModifiable
+		}
+		if err := database.RemoveOrderCoupon(tx, order.ID); err != nil {
+			return err
+		}
+		_, err = Recalculate(tx, order.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetOrderByID(db, orderID)
+}
+
+// ValidateCoupon checks whether a coupon may be used on an order at the given time
+func ValidateCoupon(db database.Querier, coupon *database.Coupon, order *database.Order, now time.Time) error {
+	if err := checkCouponConditions(coupon, order, now); err != nil {
+		return err
+	}
+
+	if coupon.MaxUses > 0 {
+		used, err := database.CountCouponRedemptions(db, coupon.ID, order.ID)
+		if err != nil {
+			return err
+		}
+		if used >= coupon.MaxUses {
+			return ErrCouponUsedUp
+		}
+	}
+
+	if coupon.MaxUsesPerUser > 0 {
+		used, err := database.CountUserCouponRedemptions(db, coupon.ID, order.UserID, order.ID)
+		if err != nil {
+			return err
+		}
+		if used >= coupon.MaxUsesPerUser {
+			return ErrCouponUserUsedUp
+		}
+	}
+
+	return nil
+}
+
+// checkCouponConditions checks the conditions of a coupon that depend on the order contents.
+// Usage limits are only enforced when the coupon is applied and when the order is placed.
+func checkCouponConditions(coupon *database.Coupon, order *database.Order, now time.Time) error {
+	if !coupon.Active {
+		return ErrCouponInactive
+	}
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return ErrCouponNotStarted
+	}
+	if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+		return ErrCouponExpired
+	}
+
+	subtotal := 0.0
+	for _, item := range order.Items {
+		subtotal += float64(item.Quantity) * item.Price
+	}
+	if round(subtotal) < coupon.MinOrderValue {
+		return apperr.Invalidf("code", "coupon requires a minimum order value of %.2f", coupon.MinOrderValue)
+	}
+
+	if eligibleSubtotal(coupon, order) <= 0 {
+		return ErrCouponNotEligible
+	}
+	return nil
+}
+
+// applicableCouponDiscounts returns the discount lines of the coupon applied to an order.
+// A coupon whose conditions are no longer met contributes nothing but stays attached,
+// so it applies again once the order qualifies.
+func applicableCouponDiscounts(db database.Querier, order *database.Order, now time.Time) ([]database.OrderDiscount, bool, error) {
+	redemption, err := database.GetCouponRedemptionByOrderID(db, order.ID)
+	if err != nil || redemption == nil {
+		return nil, false, err
+	}
+	coupon, err := database.GetCouponByID(db, redemption.CouponID)
+	if err != nil {
+		return nil, false, err
+	}
+	if checkCouponConditions(coupon, order, now) != nil {
+		return nil, false, nil
+	}
+
+	discount := database.OrderDiscount{
+		OrderID:     order.ID,
+		Source:      database.DiscountSourceCoupon,
+		SourceID:    coupon.ID,
+		Code:        coupon.Code,
+		Description: coupon.Description,
+	}
+
+	eligible := eligibleSubtotal(coupon, order)
+	switch coupon.Type {
+	case database.CouponTypePercentage:
+		discount.Amount = round(eligible * coupon.Value / 100)
+		if discount.Description == "" {
+			discount.Description = fmt.Sprintf("%g%% off", coupon.Value)
+		}
+	case database.CouponTypeFixedAmount:
+		discount.Amount = round(min(coupon.Value, eligible))
+		if discount.Description == "" {
+			discount.Description = fmt.Sprintf("%.2f off", coupon.Value)
+		}
+	case database.CouponTypeFreeShipping:
+		if discount.Description == "" {
+			discount.Description = "Free shipping"
+		}
+		return []database.OrderDiscount{discount}, true, nil
+	default:
+		return nil, false, fmt.Errorf("unknown coupon type %q", coupon.Type)
+	}
+
+	return []database.OrderDiscount{discount}, false, nil
+}
+
+// eligibleSubtotal sums the order lines a coupon applies to. Coupons without a product or
+// category scope apply to every line.
+func eligibleSubtotal(coupon *database.Coupon, order *database.Order) float64 {
+	total := 0.0
+	for _, item := range order.Items {
+		if couponAppliesTo(coupon, item) {
+			total += float64(item.Quantity) * item.Price
+		}
+	}
+	return round(total)
+}
+
+// couponAppliesTo reports whether an order line falls inside the coupon's scope
+func couponAppliesTo(coupon *database.Coupon, item database.OrderItem) bool {
+	if len(coupon.ProductIDs) == 0 && len(coupon.Categories) == 0 {
+		return true
+	}
+	for _, id := range coupon.ProductIDs {
+		if id == item.ProductID {
+			return true
+		}
+	}
+	if item.Product != nil {
+		for _, category := range coupon.Categories {
+			if strings.EqualFold(category, item.Product.Category) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package pricing
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"go-graphql-ecom/database"
+	"go-graphql-ecom/shipping"
+)
+
+// Recalculate recomputes the subtotal, discount lines, tax, shipping and total of an order from its items.
+// It must be called whenever an order's items or applied coupon change.
+func Recalculate(tx *sql.Tx, orderID int) (*database.Order, error) {
+	order, err := database.GetOrderByID(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	order.Subtotal = 0
+	for _, item := range order.Items {
+		order.Subtotal += float64(item.Quantity) * item.Price
+	}
+	order.Subtotal = round(order.Subtotal)
+
+	var discounts []database.OrderDiscount
+	order.FreeShipping = false
+	now := time.Now()
+
+	// Automatic promotions are evaluated on every change of the order items
+	promotions, err := database.GetActivePromotions(tx)
+	if err != nil {
+		return nil, err
+	}
+	applied := EvaluatePromotions(promotions, order.Items, now)
+	if err := database.ReplaceAppliedPromotions(tx, order.ID, applied); err != nil {
+		return nil, err
+	}
+	promotionLines := promotionDiscounts(promotions, applied, order.ID)
+	discounts = append(discounts, promotionLines...)
+	if err := database.ReplaceOrderDiscounts(tx, order.ID, database.DiscountSourcePromotion, promotionLines); err != nil {
+		return nil, err
+	}
+
+	couponDiscounts, freeShipping, err := applicableCouponDiscounts(tx, order, now)
+	if err != nil {
+		return nil, err
+	}
+	discounts = append(discounts, couponDiscounts...)
+	order.FreeShipping = order.FreeShipping || freeShipping
+	if err := database.ReplaceOrderDiscounts(tx, order.ID, database.DiscountSourceCoupon, couponDiscounts); err != nil {
+		return nil, err
+	}
+
+	order.DiscountTotal = 0
+	for _, d := range discounts {
+		order.DiscountTotal += d.Amount
+	}
+	order.DiscountTotal = math.Min(round(order.DiscountTotal), order.Subtotal)
+
+	// Tax is charged on each line after its share of the discounts
+	lineDiscounts := make(map[int]float64, len(order.Items))
+	for _, a := range applied {
+		lineDiscounts[a.OrderItemID] += a.Discount
+	}
+	for _, d := range couponDiscounts {
+		if err := couponLineDiscounts(tx, order, d, lineDiscounts); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyTax(tx, order, lineDiscounts); err != nil {
+		return nil, err
+	}
+
+	if err := applyShipping(tx, order); err != nil {
+		return nil, err
+	}
+
+	order.Total = round(order.Subtotal - order.DiscountTotal + order.ShippingTotal)
+	if !order.PricesIncludeTax {
+		order.Total = round(order.Total + order.TaxTotal)
+	}
+
+	if err := database.UpdateOrderTotals(tx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// applyShipping prices the shipping method chosen for an order. A method that can no longer
+// ship the order, e.g. because it was disabled, is dropped so the customer picks another one.
+func applyShipping(tx *sql.Tx, order *database.Order) error {
+	order.ShippingTotal = 0
+	if order.ShippingMethodID == 0 {
+		return nil
+	}
+
+	method, err := database.GetShippingMethodByID(tx, order.ShippingMethodID)
+	if err == nil && method.Active {
+		amount, quoteErr := shipping.Quote(method, order)
+		if quoteErr == nil {
+			order.ShippingTotal = amount
+			return nil
+		}
+	}
+
+	order.ShippingMethodID = 0
+	return database.SetOrderShippingMethod(tx, order.ID, 0)
+}
+
+// RecalculateOrder runs Recalculate in its own transaction
+func RecalculateOrder(db *sql.DB, orderID int) (*database.Order, error) {
+	err := database.WithTx(db, func(tx *sql.Tx) error {
+		_, err := Recalculate(tx, orderID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database.GetOrderByID(db, orderID)
+}
+
+// isOpen reports whether an order can still be changed by the customer
+func isOpen(order *database.Order) bool {
+	return order.Status == database.OrderStatusCart || order.Status == database.OrderStatusPending
+}
+
+// round rounds an amount to cents
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
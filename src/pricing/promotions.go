@@ -0,0 +1,195 @@
+package pricing
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go-graphql-ecom/database"
+)
+
+// promotionOrder is the order in which promotion types are evaluated. Volume pricing changes
+// the unit price first, free units come next and bundles use whatever value is left.
+var promotionOrder = map[string]int{
+	database.PromotionTypeTieredPrice: 0,
+	database.PromotionTypeBuyXGetY:    1,
+	database.PromotionTypeBundle:      2,
+}
+
+// EvaluatePromotions works out which promotions apply to the given order items and how much
+// each one takes off every line. A line is never discounted below zero.
+func EvaluatePromotions(promotions []database.Promotion, items []database.OrderItem, now time.Time) []database.AppliedPromotion {
+	active := make([]database.Promotion, 0, len(promotions))
+	for _, p := range promotions {
+		if p.ActiveAt(now) {
+			active = append(active, p)
+		}
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		return promotionOrder[active[i].Type] < promotionOrder[active[j].Type]
+	})
+
+	// remaining tracks the undiscounted value of every line
+	remaining := make(map[int]float64, len(items))
+	for _, item := range items {
+		remaining[item.ID] = float64(item.Quantity) * item.Price
+	}
+
+	var applied []database.AppliedPromotion
+	add := func(promotion database.Promotion, item database.OrderItem, discount float64, description string) {
+		discount = round(min(discount, remaining[item.ID]))
+		if discount <= 0 {
+			return
+		}
+		remaining[item.ID] -= discount
+		applied = append(applied, database.AppliedPromotion{
+			OrderID:     item.OrderID,
+			OrderItemID: item.ID,
+			PromotionID: promotion.ID,
+			Description: description,
+			Discount:    discount,
+		})
+	}
+
+	for _, promotion := range active {
+		switch promotion.Type {
+		case database.PromotionTypeTieredPrice:
+			for _, item := range items {
+				if !promotionIncludes(promotion, item.ProductID) {
+					continue
+				}
+				tier, ok := bestTier(promotion.Tiers, item.Quantity)
+				if !ok || tier.UnitPrice >= item.Price {
+					continue
+				}
+				add(promotion, item, float64(item.Quantity)*(item.Price-tier.UnitPrice),
+					fmt.Sprintf("%s: %.2f each for %d or more", promotion.Name, tier.UnitPrice, tier.MinQuantity))
+			}
+
+		case database.PromotionTypeBuyXGetY:
+			group := promotion.BuyQuantity + promotion.GetQuantity
+			if promotion.BuyQuantity <= 0 || promotion.GetQuantity <= 0 {
+				continue
+			}
+			for _, item := range items {
+				if !promotionIncludes(promotion, item.ProductID) {
+					continue
+				}
+				free := item.Quantity / group * promotion.GetQuantity
+				if free == 0 {
+					continue
+				}
+				add(promotion, item, float64(free)*item.Price,
+					fmt.Sprintf("%s: %d free", promotion.Name, free))
+			}
+
+		case database.PromotionTypeBundle:
+			applyBundle(promotion, items, remaining, add)
+		}
+	}
+
+	return applied
+}
+
+// applyBundle prices complete bundles at the bundle price, spreading the saving over the
+// bundle's lines in proportion to their regular value
+func applyBundle(promotion database.Promotion, items []database.OrderItem, remaining map[int]float64,
+	add func(database.Promotion, database.OrderItem, float64, string)) {
+	if len(promotion.Products) == 0 {
+		return
+	}
+
+	// Find the line for every bundle component and how many complete bundles the order holds
+	lines := make([]database.OrderItem, len(promotion.Products))
+	bundles := -1
+	for i, component := range promotion.Products {
+		found := false
+		for _, item := range items {
+			if item.ProductID == component.ProductID {
+				lines[i] = item
+				found = true
+				break
+			}
+		}
+		if !found || component.Quantity <= 0 {
+			return
+		}
+		n := lines[i].Quantity / component.Quantity
+		if bundles < 0 || n < bundles {
+			bundles = n
+		}
+	}
+	if bundles <= 0 {
+		return
+	}
+
+	regular := 0.0
+	for i, component := range promotion.Products {
+		regular += float64(component.Quantity) * lines[i].Price
+	}
+	saving := (regular - promotion.BundlePrice) * float64(bundles)
+	if saving <= 0 {
+		return
+	}
+
+	description := fmt.Sprintf("%s: %d for %.2f", promotion.Name, bundles, promotion.BundlePrice)
+	distributed := 0.0
+	for i, component := range promotion.Products {
+		share := round(saving * float64(component.Quantity) * lines[i].Price / regular)
+		if i == len(promotion.Products)-1 {
+			// The last line absorbs rounding differences
+			share = round(saving - distributed)
+		}
+		distributed += share
+		add(promotion, lines[i], share, description)
+	}
+}
+
+// bestTier returns the tier with the highest minimum quantity reached by quantity
+func bestTier(tiers []database.PromotionTier, quantity int) (database.PromotionTier, bool) {
+	var best database.PromotionTier
+	found := false
+	for _, tier := range tiers {
+		if quantity >= tier.MinQuantity && (!found || tier.MinQuantity > best.MinQuantity) {
+			best = tier
+			found = true
+		}
+	}
+	return best, found
+}
+
+// promotionIncludes reports whether a product is covered by a promotion
+func promotionIncludes(promotion database.Promotion, productID int) bool {
+	for _, product := range promotion.Products {
+		if product.ProductID == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// promotionDiscounts sums the applied promotions into one order discount line per promotion
+func promotionDiscounts(promotions []database.Promotion, applied []database.AppliedPromotion, orderID int) []database.OrderDiscount {
+	names := make(map[int]string, len(promotions))
+	for _, p := range promotions {
+		names[p.ID] = p.Name
+	}
+
+	var discounts []database.OrderDiscount
+	index := make(map[int]int)
+	for _, a := range applied {
+		i, ok := index[a.PromotionID]
+		if !ok {
+			i = len(discounts)
+			index[a.PromotionID] = i
+			discounts = append(discounts, database.OrderDiscount{
+				OrderID:     orderID,
+				Source:      database.DiscountSourcePromotion,
+				SourceID:    a.PromotionID,
+				Description: names[a.PromotionID],
+			})
+		}
+		discounts[i].Amount = round(discounts[i].Amount + a.Discount)
+	}
+	return discounts
+}
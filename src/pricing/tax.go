@@ -0,0 +1,220 @@
+package pricing
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+
+	"go-graphql-ecom/database"
+)
+
+// TaxLine is an order line to be taxed. Amount is the line value after discounts.
+type TaxLine struct {
+	ItemID   int
+	TaxClass string
+	Amount   float64
+}
+
+// TaxRequest describes the taxable lines of an order and where the order is taxed
+type TaxRequest struct {
+	Country string
+	Region  string
+	Lines   []TaxLine
+}
+
+// LineTax is the tax charged on one order line. Base is the line value excluding tax.
+type LineTax struct {
+	ItemID int
+	Base   float64
+	Rate   float64
+	Name   string
+	Amount float64
+}
+
+// TaxResult is the outcome of a tax calculation. When PricesIncludeTax is set the line
+// amounts already contain the tax and it is not added to the order total.
+type TaxResult struct {
+	Lines            []LineTax
+	PricesIncludeTax bool
+}
+
+// TaxCalculator computes the tax of an order
+type TaxCalculator interface {
+	Calculate(req TaxRequest) (*TaxResult, error)
+}
+
+// TableTaxCalculator looks rates up in a table keyed by country, region and tax class.
+// A rate with an empty region applies to every region of its country that has no rate of its own.
+type TableTaxCalculator struct {
+	PricesIncludeTax bool
+
+	mu    sync.RWMutex
+	rates map[taxKey]database.TaxRate
+}
+
+type taxKey struct {
+	country, region, taxClass string
+}
+
+// NewTableTaxCalculator creates a table-driven calculator with the given rates
+func NewTableTaxCalculator(rates []database.TaxRate, pricesIncludeTax bool) *TableTaxCalculator {
+	c := &TableTaxCalculator{PricesIncludeTax: pricesIncludeTax}
+	c.SetRates(rates)
+	return c
+}
+
+// SetRates replaces the rate table
+func (c *TableTaxCalculator) SetRates(rates []database.TaxRate) {
+	table := make(map[taxKey]database.TaxRate, len(rates))
+	for _, rate := range rates {
+		table[newTaxKey(rate.Country, rate.Region, rate.TaxClass)] = rate
+	}
+	c.mu.Lock()
+	c.rates = table
+	c.mu.Unlock()
+}
+
+// Rate returns the rate for a tax class in a country and region
+func (c *TableTaxCalculator) Rate(country, region, taxClass string) (database.TaxRate, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if rate, ok := c.rates[newTaxKey(country, region, taxClass)]; ok && region != "" {
+		return rate, true
+	}
+	rate, ok := c.rates[newTaxKey(country, "", taxClass)]
+	return rate, ok
+}
+
+// Calculate implements TaxCalculator. Lines without a matching rate are not taxed.
+func (c *TableTaxCalculator) Calculate(req TaxRequest) (*TaxResult, error) {
+	result := &TaxResult{PricesIncludeTax: c.PricesIncludeTax}
+	for _, line := range req.Lines {
+		tax := LineTax{ItemID: line.ItemID, Base: round(line.Amount)}
+		if rate, ok := c.Rate(req.Country, req.Region, line.TaxClass); ok && req.Country != "" {
+			tax.Rate = rate.Rate
+			tax.Name = rate.Name
+			if c.PricesIncludeTax {
+				tax.Base = round(line.Amount / (1 + rate.Rate))
+				tax.Amount = round(line.Amount - tax.Base)
+			} else {
+				tax.Amount = round(line.Amount * rate.Rate)
+			}
+		}
+		result.Lines = append(result.Lines, tax)
+	}
+	return result, nil
+}
+
+func newTaxKey(country, region, taxClass string) taxKey {
+	if taxClass == "" {
+		taxClass = database.TaxClassStandard
+	}
+	return taxKey{strings.ToUpper(country), strings.ToUpper(region), taxClass}
+}
+
+var (
+	taxMu         sync.RWMutex
+	taxCalculator TaxCalculator = NewTableTaxCalculator(nil, false)
+)
+
+// SetTaxCalculator sets the calculator used when order totals are recalculated
+func SetTaxCalculator(c TaxCalculator) {
+	taxMu.Lock()
+	defer taxMu.Unlock()
+	taxCalculator = c
+}
+
+// GetTaxCalculator returns the calculator used when order totals are recalculated
+func GetTaxCalculator() TaxCalculator {
+	taxMu.RLock()
+	defer taxMu.RUnlock()
+	return taxCalculator
+}
+
+// ReloadTaxRates refreshes the rates of the table-driven calculator from the database.
+// Other calculators are left alone.
+func ReloadTaxRates(db *sql.DB) error {
+	table, ok := GetTaxCalculator().(*TableTaxCalculator)
+	if !ok {
+		return nil
+	}
+	rates, err := database.GetAllTaxRates(db)
+	if err != nil {
+		return err
+	}
+	table.SetRates(rates)
+	return nil
+}
+
+// applyTax calculates the tax of every order line after line discounts and stores it on the items
+func applyTax(tx *sql.Tx, order *database.Order, lineDiscounts map[int]float64) error {
+	req := TaxRequest{Country: order.Country, Region: order.Region}
+	for _, item := range order.Items {
+		taxClass := database.TaxClassStandard
+		if item.Product != nil {
+			taxClass = item.Product.TaxClass
+		}
+		amount := float64(item.Quantity)*item.Price - lineDiscounts[item.ID]
+		req.Lines = append(req.Lines, TaxLine{ItemID: item.ID, TaxClass: taxClass, Amount: max(amount, 0)})
+	}
+
+	result, err := GetTaxCalculator().Calculate(req)
+	if err != nil {
+		return err
+	}
+
+	taxes := make(map[int]LineTax, len(result.Lines))
+	for _, line := range result.Lines {
+		taxes[line.ItemID] = line
+	}
+
+	order.TaxTotal = 0
+	order.PricesIncludeTax = result.PricesIncludeTax
+	for i := range order.Items {
+		item := &order.Items[i]
+		tax := taxes[item.ID]
+		item.TaxBase, item.TaxRate, item.TaxName, item.TaxAmount = tax.Base, tax.Rate, tax.Name, tax.Amount
+		if err := database.UpdateOrderItemTax(tx, item); err != nil {
+			return err
+		}
+		order.TaxTotal += tax.Amount
+	}
+	order.TaxTotal = round(order.TaxTotal)
+	return nil
+}
+
+// couponLineDiscounts spreads a coupon discount over the lines it applies to, in proportion
+// to their value after promotions, so tax is charged on what the customer actually pays
+func couponLineDiscounts(db database.Querier, order *database.Order, discount database.OrderDiscount, lineDiscounts map[int]float64) error {
+	if discount.Amount <= 0 {
+		return nil
+	}
+	coupon, err := database.GetCouponByID(db, discount.SourceID)
+	if err != nil {
+		return err
+	}
+
+	var lines []database.OrderItem
+	eligible := 0.0
+	for _, item := range order.Items {
+		if couponAppliesTo(coupon, item) {
+			lines = append(lines, item)
+			eligible += float64(item.Quantity)*item.Price - lineDiscounts[item.ID]
+		}
+	}
+	if eligible <= 0 {
+		return nil
+	}
+
+	distributed := 0.0
+	for i, item := range lines {
+		share := round(discount.Amount * (float64(item.Quantity)*item.Price - lineDiscounts[item.ID]) / eligible)
+		if i == len(lines)-1 {
+			// The last line absorbs rounding differences
+			share = round(discount.Amount - distributed)
+		}
+		distributed += share
+		lineDiscounts[item.ID] += share
+	}
+	return nil
+}
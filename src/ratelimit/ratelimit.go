@@ -0,0 +1,129 @@
+// Package ratelimit limits how much work each client may ask of the API using token
+// buckets. Requests spend tokens according to their cost and buckets refill at a steady
+// rate up to their capacity.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled completely are dropped
+const sweepInterval = time.Minute
+
+// Result describes a client's bucket after a request
+type Result struct {
+	Allowed bool
+	// Limit is the capacity of the bucket
+	Limit int
+	// Remaining is the number of tokens left
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until a rejected request could be afforded. It is zero for
+	// requests costing more than the capacity, which never can be.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter keeps a token bucket per client key
+type Limiter struct {
+	capacity float64
+	rate     float64 // tokens per second
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New returns a limiter whose buckets hold capacity tokens and refill at rate tokens per second
+func New(capacity int, rate float64) *Limiter {
+	return &Limiter{
+		capacity: float64(capacity),
+		rate:     rate,
+		buckets:  make(map[string]*bucket),
+		now:      time.Now,
+	}
+}
+
+// Capacity returns the number of tokens a full bucket holds
+func (l *Limiter) Capacity() int {
+	return int(l.capacity)
+}
+
+// Window returns how long an empty bucket takes to fill
+func (l *Limiter) Window() time.Duration {
+	return seconds(l.capacity / l.rate)
+}
+
+// Take spends cost tokens from the bucket of key if it holds enough. A rejected request
+// spends nothing. Requests costing more than the capacity are always rejected.
+func (l *Limiter) Take(key string, cost int) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.capacity, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.capacity, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	result := Result{Limit: int(l.capacity)}
+	if float64(cost) <= b.tokens {
+		b.tokens -= float64(cost)
+		result.Allowed = true
+	} else if float64(cost) <= l.capacity {
+		result.RetryAfter = seconds((float64(cost) - b.tokens) / l.rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((l.capacity - b.tokens) / l.rate)
+	return result
+}
+
+// sweep forgets buckets that have had time to fill up, since a new bucket starts full
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// seconds rounds a number of seconds up to a whole-second duration
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
+
+var (
+	mu      sync.RWMutex
+	limiter *Limiter
+)
+
+// SetLimiter sets the limiter applied to API requests; nil turns rate limiting off
+func SetLimiter(l *Limiter) {
+	mu.Lock()
+	defer mu.Unlock()
+	limiter = l
+}
+
+// GetLimiter returns the limiter applied to API requests, or nil if there is none
+func GetLimiter() *Limiter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return limiter
+}
@@ -0,0 +1,90 @@
+// Package shipping prices shipping methods for orders.
+package shipping
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"go-graphql-ecom/apperr"
+	"go-graphql-ecom/database"
+)
+
+// VolumetricDivisor converts a parcel volume in cubic centimetres into a volumetric weight in
+// kilograms. Weight-based methods charge whichever of the actual and volumetric weight is higher.
+const VolumetricDivisor = 5000
+
+var ErrUnknownMethodType = errors.New("unknown shipping method type")
+
+// Option is the price of shipping an order with a method
+type Option struct {
+	Method database.ShippingMethod
+	Amount float64
+}
+
+// ItemWeight returns the chargeable weight of one unit of a product in kilograms
+func ItemWeight(product *database.Product) float64 {
+	volumetric := product.Length * product.Width * product.Height / VolumetricDivisor
+	return math.Max(product.Weight, volumetric)
+}
+
+// OrderWeight returns the chargeable weight of an order. It fails if a product has
+// neither a weight nor dimensions, as weight-based rates can't be quoted for it.
+func OrderWeight(order *database.Order) (float64, error) {
+	total := 0.0
+	for _, item := range order.Items {
+		if item.Product == nil {
+			return 0, fmt.Errorf("product %d not loaded", item.ProductID)
+		}
+		weight := ItemWeight(item.Product)
+		if weight <= 0 {
+			return 0, apperr.Newf(apperr.CodeConflict, "product %q has no weight or dimensions", item.Product.Name)
+		}
+		total += weight * float64(item.Quantity)
+	}
+	return total, nil
+}
+
+// Quote prices shipping an order with a method. Orders with free shipping from a coupon ship for nothing.
+func Quote(method *database.ShippingMethod, order *database.Order) (float64, error) {
+	var amount float64
+	switch method.Type {
+	case database.ShippingMethodFlatRate:
+		amount = method.BaseRate
+	case database.ShippingMethodWeightBased:
+		weight, err := OrderWeight(order)
+		if err != nil {
+			return 0, err
+		}
+		amount = method.BaseRate + math.Ceil(weight*10)/10*method.RatePerKg
+	case database.ShippingMethodFreeOverThreshold:
+		amount = method.BaseRate
+		if order.Subtotal-order.DiscountTotal >= method.FreeThreshold {
+			amount = 0
+		}
+	default:
+		return 0, ErrUnknownMethodType
+	}
+
+	if order.FreeShipping {
+		return 0, nil
+	}
+	return math.Round(amount*100) / 100, nil
+}
+
+// Options quotes every method that can ship the order, cheapest first
+func Options(methods []database.ShippingMethod, order *database.Order) []Option {
+	var options []Option
+	for _, method := range methods {
+		amount, err := Quote(&method, order)
+		if err != nil {
+			continue
+		}
+		options = append(options, Option{Method: method, Amount: amount})
+	}
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Amount < options[j].Amount
+	})
+	return options
+}
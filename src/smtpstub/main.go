@@ -0,0 +1,38 @@
+// Command smtpstub runs a local SMTP server that prints every email it receives, so
+// notifications can be checked without a real mail server. Start the API with
+// SMTP_ADDR=localhost:2525 to deliver to it.
+//
+//	go run ./smtpstub -addr localhost:2525 -fail 2
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"go-graphql-ecom/notify"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:2525", "address to listen on")
+	fail := flag.Int("fail", 0, "number of deliveries to reject with a temporary error")
+	flag.Parse()
+
+	server, err := notify.ListenStub(*addr)
+	if err != nil {
+		log.Fatalf("Failed to start SMTP stub: %v", err)
+	}
+	server.FailNext(*fail)
+	server.OnMessage = func(msg notify.StubMessage) {
+		fmt.Printf("----- from %s to %s -----\n%s\n", msg.From, strings.Join(msg.To, ", "), msg.Data)
+	}
+	fmt.Printf("SMTP stub listening on %s\n", server.Addr())
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+	server.Close()
+}
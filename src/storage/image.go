@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	"go-graphql-ecom/apperr"
+
+	// Register GIF decoding for image.Decode
+	_ "image/gif"
+)
+
+// ThumbnailSize is the maximum width and height of generated thumbnails
+const ThumbnailSize = 256
+
+// MaxImagePixels is the largest width x height accepted for uploaded images. A small file can
+// declare a huge image, and decoding one allocates memory for every pixel.
+const MaxImagePixels = 40_000_000
+
+// ErrUnsupportedImage is returned when uploaded data is not a decodable image
+var ErrUnsupportedImage = apperr.Invalid("file", "unsupported image format")
+
+// ErrImageTooLarge is returned when an uploaded image has more than MaxImagePixels pixels
+var ErrImageTooLarge = apperr.Invalid("file", "image dimensions are too large")
+
+// ImageInfo describes a decoded image
+type ImageInfo struct {
+	Format      string
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// DecodeImage decodes data and reports its format and dimensions. The dimensions are checked
+// against MaxImagePixels before the image is decoded.
+func DecodeImage(data []byte) (image.Image, *ImageInfo, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, ErrUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, nil, ErrUnsupportedImage
+	}
+	if int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return nil, nil, ErrImageTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, ErrUnsupportedImage
+	}
+	bounds := img.Bounds()
+	return img, &ImageInfo{
+		Format:      format,
+		ContentType: "image/" + format,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+	}, nil
+}
+
+// Thumbnail scales img down so that it fits in a maxSize x maxSize box, keeping its aspect ratio.
+// Images that already fit are returned unchanged.
+func Thumbnail(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= maxSize && h <= maxSize {
+		return img
+	}
+
+	tw, th := maxSize, maxSize
+	if w > h {
+		th = h * maxSize / w
+	} else {
+		tw = w * maxSize / h
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	// Box filter: every destination pixel averages the source pixels it covers
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		sy0 := bounds.Min.Y + y*h/th
+		sy1 := bounds.Min.Y + (y+1)*h/th
+		if sy1 == sy0 {
+			sy1++
+		}
+		for x := 0; x < tw; x++ {
+			sx0 := bounds.Min.X + x*w/tw
+			sx1 := bounds.Min.X + (x+1)*w/tw
+			if sx1 == sx0 {
+				sx1++
+			}
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// EncodeThumbnail encodes a thumbnail as PNG when the source format supports
+// transparency and as JPEG otherwise. It returns the encoded bytes and their content type.
+func EncodeThumbnail(img image.Image, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if format == "png" || format == "gif" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
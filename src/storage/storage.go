@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// BlobStore stores binary objects such as uploaded product images
+type BlobStore interface {
+	// Put writes the contents of r under key, replacing any existing object
+	Put(key string, r io.Reader) error
+	// Open returns a reader for the object stored under key
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key
+	Delete(key string) error
+	// URL returns the public URL the object is served from
+	URL(key string) string
+}
+
+// ErrNotFound is returned when a key does not exist in the store
+var ErrNotFound = errors.New("object not found")
+
+var (
+	store BlobStore
+	mu    sync.RWMutex
+)
+
+// SetStore sets the blob store used by the application
+func SetStore(s BlobStore) {
+	mu.Lock()
+	defer mu.Unlock()
+	store = s
+}
+
+// GetStore returns the blob store used by the application
+func GetStore() BlobStore {
+	mu.RLock()
+	defer mu.RUnlock()
+	return store
+}